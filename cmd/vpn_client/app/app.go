@@ -52,9 +52,13 @@ func NewCommand() *cobra.Command {
 	flags := cmd.Flags()
 	verflag.AddFlags(flags)
 	cmd.PersistentFlags().BoolVar(&pprofEnabled, "enable-pprof", false, "enable pprof for profiling")
+	utils.AddLogFlags(cmd.PersistentFlags())
 	cmd.AddCommand(pathcontroller.NewCommand())
 	cmd.AddCommand(tunnelcontroller.NewCommand())
 	cmd.AddCommand(setup.NewCommand())
+	cmd.AddCommand(cleanupCommand())
+	cmd.AddCommand(utils.NewConfigCommand(Name, config.KindVPNClient))
+	cmd.AddCommand(renderCommand())
 	return cmd
 }
 
@@ -72,6 +76,7 @@ func vpnConfig(log logr.Logger, cfg config.VPNClient, tunMTU int) openvpn.Client
 		IsHA:                 cfg.IsHA,
 		SeedPodNetwork:       cfg.SeedPodNetwork.String(),
 		TunMTU:               tunMTU,
+		Verb:                 utils.OpenVPNVerbosity(),
 	}
 	vpnSeedServer := "vpn-seed-server"
 
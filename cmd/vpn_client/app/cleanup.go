@@ -0,0 +1,45 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package app
+
+import (
+	"github.com/go-logr/logr"
+	"github.com/spf13/cobra"
+
+	"github.com/gardener/vpn2/pkg/config"
+	"github.com/gardener/vpn2/pkg/constants"
+	"github.com/gardener/vpn2/pkg/utils"
+	"github.com/gardener/vpn2/pkg/vpn_client"
+)
+
+func cleanupCommand() *cobra.Command {
+	var sysctlStateFile string
+
+	cmd := &cobra.Command{
+		Use:   "cleanup",
+		Short: "Revert the changes made on the host",
+		Long: "Revert the changes made on the host by the setup subcommand and the vpn-client, i.e. firewall rules, " +
+			"links and routes, and kernel parameters recorded in the sysctl state file. It can be run repeatedly, e.g. as preStop hook.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			log, err := utils.InitRun(cmd, Name+"-cleanup")
+			if err != nil {
+				return err
+			}
+			return runCleanup(log, sysctlStateFile)
+		},
+	}
+
+	cmd.Flags().StringVar(&sysctlStateFile, "sysctl-state-file", constants.SysctlStateFile, "file with the previous values of kernel parameters recorded by the setup subcommand, kernel parameters are not restored if empty")
+	return cmd
+}
+
+func runCleanup(log logr.Logger, sysctlStateFile string) error {
+	cfg, err := config.GetVPNClientConfig()
+	if err != nil {
+		return err
+	}
+	return vpn_client.RevertHostSetup(log, cfg, sysctlStateFile)
+}
@@ -5,51 +5,103 @@
 package pathcontroller
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
 	"net"
 	"slices"
+	"strconv"
 	"sync"
 	"time"
 
 	"github.com/go-logr/logr"
 	"github.com/vishvananda/netlink"
+	corev1 "k8s.io/api/core/v1"
 
 	"github.com/gardener/vpn2/pkg/constants"
+	"github.com/gardener/vpn2/pkg/events"
 	"github.com/gardener/vpn2/pkg/network"
 	"github.com/gardener/vpn2/pkg/shoot_client/tunnel"
 )
 
+// minScoreImprovement is the minimum improvement of the score required to switch away from a healthy primary.
+const minScoreImprovement = 5 * time.Millisecond
+
 type clientRouter struct {
 	pinger             pinger
 	netRouter          netRouter
 	kubeAPIServerPodIP string
+	// registrationSecret authenticates the registrations of the pod IP at the tunnel-controllers, nil if not configured.
+	registrationSecret []byte
+
+	log       logr.Logger
+	metrics   *pathMetrics
+	recorder  events.Recorder
+	primary   net.IP
+	mu        sync.Mutex
+	goodIPs   map[string]struct{}
+	lastPings map[string]pingResult
+	ticker    *time.Ticker
+	// reconcileTicker triggers the reconciliation of drifted routes, it is nil if the reconciliation is disabled.
+	reconcileTicker *time.Ticker
+
+	// stats are the ping statistics of the shoot clients over the last windowSize pings.
+	stats      map[string]*pathStats
+	windowSize int
+	// hysteresis is the relative improvement of the score required to switch away from a healthy primary.
+	hysteresis float64
+	// minDwellTime is the minimum time a healthy primary is kept after switching to it.
+	minDwellTime time.Duration
+	lastSwitch   time.Time
 
-	log        logr.Logger
-	checkedNet *net.IPNet
-	primary    net.IP
-	mu         sync.Mutex
-	goodIPs    map[string]struct{}
-	ticker     *time.Ticker
+	// multipath routes the shoot networks over all good shoot clients instead of the primary one.
+	multipath bool
+	members   []net.IP
 }
 
 type netRouter interface {
 	updateRouting(net.IP) error
+	updateMultipathRouting([]net.IP) error
+	// installedRoutes describes the routes to the shoot networks installed in the kernel.
+	installedRoutes() ([]string, error)
+	// reconcileRouting restores the routes to the shoot networks which do not point to the given shoot clients.
+	// It returns the shoot networks whose routes have been restored.
+	reconcileRouting(ips []net.IP, multipath bool) ([]string, error)
 }
 
 type pinger interface {
-	Ping(client net.IP) error
+	// Ping pings the client and returns the sample with the round-trip time of the successful echo.
+	Ping(client net.IP) (pingSample, error)
 }
 
 func (r *clientRouter) Run(ctx context.Context, clientIPs []net.IP) error {
+	var reconcile <-chan time.Time
+	if r.reconcileTicker != nil {
+		reconcile = r.reconcileTicker.C
+	}
 	for {
 		select {
 		case <-ctx.Done():
+			r.deregister(clientIPs)
 			return ctx.Err()
+		case <-reconcile:
+			r.mu.Lock()
+			err := r.reconcileRouting()
+			r.mu.Unlock()
+			if err != nil {
+				r.log.Error(err, "")
+			}
 		case <-r.ticker.C:
 			r.pingAllShootClients(clientIPs)
-			err := r.determinePrimaryShootClient()
+			var err error
+			r.mu.Lock()
+			if r.multipath {
+				err = r.updateMultipathMembers()
+			} else {
+				err = r.determinePrimaryShootClient()
+			}
+			r.mu.Unlock()
 			if err != nil {
 				// don't return error here because in creation there will be some time when nothing is
 				// available. If we returned the error we would exit the path-controller
@@ -59,28 +111,142 @@ func (r *clientRouter) Run(ctx context.Context, clientIPs []net.IP) error {
 	}
 }
 
-func (r *clientRouter) selectNewPrimaryShootClient() (net.IP, error) {
-	// just use a random ip that is in goodIps map
-	for ip := range r.goodIPs {
-		return net.ParseIP(ip), nil
+// reconcileRouting restores the routes to the shoot networks if they have been deleted or modified by someone else,
+// r.mu must be held.
+func (r *clientRouter) reconcileRouting() error {
+	routed := r.members
+	if !r.multipath && r.primary != nil {
+		routed = []net.IP{r.primary}
+	}
+	if len(routed) == 0 {
+		// nothing routed yet
+		return nil
+	}
+
+	restored, err := r.netRouter.reconcileRouting(routed, r.multipath)
+	for _, n := range restored {
+		r.log.Info("restored drifted route", "net", n, "clients", routed)
+		r.metrics.routeCorrections.WithLabelValues(n).Inc()
+	}
+	if err != nil {
+		r.metrics.routeUpdateErrors.Inc()
+		return fmt.Errorf("error reconciling routes: %w", err)
 	}
-	return nil, errors.New("no more good ips in pool")
+	return nil
 }
 
-func (r *clientRouter) determinePrimaryShootClient() error {
-	_, ok := r.goodIPs[r.primary.String()]
+// pathStats returns the statistics of a shoot client, creating them if needed.
+func (r *clientRouter) pathStats(ip string) *pathStats {
+	if r.stats == nil {
+		r.stats = map[string]*pathStats{}
+	}
+	stats, ok := r.stats[ip]
 	if !ok {
-		newIP, err := r.selectNewPrimaryShootClient()
-		if err != nil {
-			return fmt.Errorf("error selecting a new shoot client: %w", err)
+		stats = newPathStats(max(r.windowSize, 1))
+		r.stats[ip] = stats
+	}
+	return stats
+}
+
+// selectBestShootClient returns the good shoot client with the lowest score. Ties are broken by the IP address to keep
+// the selection stable.
+func (r *clientRouter) selectBestShootClient() (net.IP, error) {
+	var (
+		best      string
+		bestScore time.Duration
+	)
+	for ip := range r.goodIPs {
+		score := r.pathStats(ip).score()
+		if best == "" || score < bestScore || (score == bestScore && ip < best) {
+			best, bestScore = ip, score
 		}
-		err = r.netRouter.updateRouting(newIP)
-		if err != nil {
-			return err
+	}
+	if best == "" {
+		return nil, errors.New("no more good ips in pool")
+	}
+	return net.ParseIP(best), nil
+}
+
+// shouldSwitch checks whether the healthy primary is markedly worse than the candidate and has been primary for at
+// least the minimum dwell time.
+func (r *clientRouter) shouldSwitch(candidate net.IP) bool {
+	if candidate.Equal(r.primary) || time.Since(r.lastSwitch) < r.minDwellTime {
+		return false
+	}
+	primaryScore := r.pathStats(r.primary.String()).score()
+	candidateScore := r.pathStats(candidate.String()).score()
+	improvement := primaryScore - candidateScore
+	return improvement >= minScoreImprovement && float64(improvement) >= r.hysteresis*float64(primaryScore)
+}
+
+func (r *clientRouter) determinePrimaryShootClient() error {
+	best, err := r.selectBestShootClient()
+	reason := switchReasonUnhealthy
+	if r.primary == nil {
+		reason = switchReasonInitial
+	}
+	if _, ok := r.goodIPs[r.primary.String()]; ok {
+		if err != nil || !r.shouldSwitch(best) {
+			return nil
 		}
-		r.log.Info("switching primary shoot client", "old", r.primary, "new", newIP)
-		r.primary = newIP
+		reason = switchReasonDegraded
+	} else if err != nil {
+		return fmt.Errorf("error selecting a new shoot client: %w", err)
+	}
+
+	if err := r.netRouter.updateRouting(best); err != nil {
+		r.metrics.routeUpdateErrors.Inc()
+		return err
+	}
+	stats := r.pathStats(best.String())
+	r.log.Info("switching primary shoot client", "old", r.primary, "new", best, "reason", reason, "rtt", stats.rtt(), "loss", stats.loss())
+	var old []net.IP
+	if r.primary != nil {
+		old = []net.IP{r.primary}
 	}
+	r.metrics.setPrimaries(reason, old, []net.IP{best})
+	r.recordPrimaryChange(reason, best)
+	r.primary = best
+	r.lastSwitch = time.Now()
+	return nil
+}
+
+// recordPrimaryChange emits an event for the switch of the primary shoot client, which is a warning if the old primary
+// has become unhealthy.
+func (r *clientRouter) recordPrimaryChange(reason string, primary net.IP) {
+	eventType := corev1.EventTypeNormal
+	if reason == switchReasonUnhealthy {
+		eventType = corev1.EventTypeWarning
+	}
+	if r.primary == nil {
+		r.recorder.Eventf(eventType, events.ReasonPrimaryShootClientChanged, "Routing shoot networks over shoot client %s (%s)", primary, reason)
+		return
+	}
+	r.recorder.Eventf(eventType, events.ReasonPrimaryShootClientChanged, "Switched primary shoot client from %s to %s (%s)", r.primary, primary, reason)
+}
+
+// updateMultipathMembers routes the shoot networks over all good shoot clients if they have changed since the last update.
+func (r *clientRouter) updateMultipathMembers() error {
+	members := make([]net.IP, 0, len(r.goodIPs))
+	for ip := range r.goodIPs {
+		members = append(members, net.ParseIP(ip))
+	}
+	if len(members) == 0 {
+		return errors.New("no more good ips in pool")
+	}
+	slices.SortFunc(members, func(a, b net.IP) int { return bytes.Compare(a, b) })
+	if slices.EqualFunc(members, r.members, net.IP.Equal) {
+		return nil
+	}
+
+	if err := r.netRouter.updateMultipathRouting(members); err != nil {
+		r.metrics.routeUpdateErrors.Inc()
+		return err
+	}
+	r.log.Info("updating multipath shoot clients", "old", r.members, "new", members)
+	r.metrics.setPrimaries(switchReasonMembers, r.members, members)
+	r.recorder.Eventf(corev1.EventTypeNormal, events.ReasonShootClientsChanged, "Routing shoot networks over shoot clients %v instead of %v", members, r.members)
+	r.members = members
 	return nil
 }
 
@@ -90,9 +256,16 @@ func (r *clientRouter) pingAllShootClients(clients []net.IP) {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			err := r.pinger.Ping(client)
+			sample, err := r.pinger.Ping(client)
+			sample = sample.normalize(err)
+			r.metrics.observePing(client, sample, err)
 			r.mu.Lock()
 			defer r.mu.Unlock()
+			if r.lastPings == nil {
+				r.lastPings = map[string]pingResult{}
+			}
+			r.lastPings[client.String()] = pingResult{time: time.Now(), sample: sample, err: err}
+			r.pathStats(client.String()).record(sample)
 			if err != nil {
 				r.log.Info("client not healthy, removing from pool", "ip", client)
 				delete(r.goodIPs, client.String())
@@ -104,8 +277,9 @@ func (r *clientRouter) pingAllShootClients(clients []net.IP) {
 		go func() {
 			defer wg.Done()
 			// sending own IP to other side of tunnel so that the back route can be setup correctly
-			err := tunnel.Send(client, r.kubeAPIServerPodIP)
+			err := tunnel.Send(client, r.kubeAPIServerPodIP, r.registrationSecret)
 			if err != nil {
+				r.metrics.sendPodIPFailures.WithLabelValues(client.String()).Inc()
 				r.log.Info("error sending UDP packet with own IP to vpn-shoot", "ip", client, "error", err)
 			}
 		}()
@@ -113,6 +287,17 @@ func (r *clientRouter) pingAllShootClients(clients []net.IP) {
 	wg.Wait()
 }
 
+// deregister deregisters the own IP at the tunnel-controllers on shutdown, so that they delete the tunnels immediately
+// instead of waiting for the registration to expire.
+func (r *clientRouter) deregister(clients []net.IP) {
+	for _, client := range clients {
+		if err := tunnel.Deregister(client, r.kubeAPIServerPodIP, r.registrationSecret); err != nil {
+			r.log.Info("error deregistering own IP at vpn-shoot", "ip", client, "error", err)
+		}
+	}
+	r.log.Info("sent deregistration of own IP to vpn-shoot", "clients", clients)
+}
+
 type netlinkRouter struct {
 	shootPodNetworks     []network.CIDR
 	shootServiceNetworks []network.CIDR
@@ -123,12 +308,140 @@ type netlinkRouter struct {
 }
 
 func (r *netlinkRouter) updateRouting(newIP net.IP) error {
-	clientIndex := network.ClientIndexFromBondingShootClientIP(newIP)
-	tunnelLink, err := netlink.LinkByName(network.BondIP6TunnelLinkName(clientIndex))
+	tunnelLink, err := tunnelLinkForShootClient(newIP)
 	if err != nil {
 		return err
 	}
+	return r.replaceRoutes(func(n *net.IPNet) netlink.Route {
+		return routeForNetwork(n, tunnelLink)
+	})
+}
 
+// updateMultipathRouting routes the shoot networks over the tunnel links of all given shoot clients.
+func (r *netlinkRouter) updateMultipathRouting(ips []net.IP) error {
+	tunnelLinks := make([]netlink.Link, 0, len(ips))
+	for _, ip := range ips {
+		tunnelLink, err := tunnelLinkForShootClient(ip)
+		if err != nil {
+			return err
+		}
+		tunnelLinks = append(tunnelLinks, tunnelLink)
+	}
+	return r.replaceRoutes(func(n *net.IPNet) netlink.Route {
+		return multipathRouteForNetwork(n, tunnelLinks)
+	})
+}
+
+func tunnelLinkForShootClient(ip net.IP) (netlink.Link, error) {
+	return netlink.LinkByName(tunnelLinkNameForShootClient(ip))
+}
+
+// replaceRoutes replaces the routes of all shoot networks with the routes built by routeFor.
+func (r *netlinkRouter) replaceRoutes(routeFor func(*net.IPNet) netlink.Route) error {
+	nets, err := r.shootNetworks()
+	if err != nil {
+		return err
+	}
+	for _, n := range nets {
+		route := routeFor(n.ToIPNet())
+		r.log.Info("replacing route", "route", route, "net", n)
+		err = netlink.RouteReplace(&route)
+		if err != nil {
+			return fmt.Errorf("error replacing route for %s: %w", n, err)
+		}
+	}
+	return nil
+}
+
+func (r *netlinkRouter) installedRoutes() ([]string, error) {
+	nets, err := r.shootNetworks()
+	if err != nil {
+		return nil, err
+	}
+	var descriptions []string
+	for _, n := range nets {
+		routes, err := listRoutes(n)
+		if err != nil {
+			return descriptions, err
+		}
+		for _, route := range routes {
+			descriptions = append(descriptions, describeRoute(route, linkName))
+		}
+	}
+	return descriptions, nil
+}
+
+func (r *netlinkRouter) reconcileRouting(ips []net.IP, multipath bool) ([]string, error) {
+	tunnelLinks := make([]netlink.Link, 0, len(ips))
+	linkIndexes := make([]int, 0, len(ips))
+	for _, ip := range ips {
+		tunnelLink, err := tunnelLinkForShootClient(ip)
+		if err != nil {
+			return nil, err
+		}
+		tunnelLinks = append(tunnelLinks, tunnelLink)
+		linkIndexes = append(linkIndexes, tunnelLink.Attrs().Index)
+	}
+	nets, err := r.shootNetworks()
+	if err != nil {
+		return nil, err
+	}
+
+	var restored []string
+	for _, n := range nets {
+		installed, err := listRoutes(n)
+		if err != nil {
+			return restored, err
+		}
+		if !routeDrifted(installed, linkIndexes) {
+			continue
+		}
+		route := routeForNetwork(n.ToIPNet(), tunnelLinks[0])
+		if multipath {
+			route = multipathRouteForNetwork(n.ToIPNet(), tunnelLinks)
+		}
+		r.log.Info("replacing drifted route", "route", route, "net", n)
+		if err := netlink.RouteReplace(&route); err != nil {
+			return restored, fmt.Errorf("error replacing route for %s: %w", n, err)
+		}
+		restored = append(restored, n.String())
+	}
+	return restored, nil
+}
+
+// listRoutes lists the routes to the network in the main routing table.
+func listRoutes(n network.CIDR) ([]netlink.Route, error) {
+	family := netlink.FAMILY_V6
+	if n.IP.To4() != nil {
+		family = netlink.FAMILY_V4
+	}
+	routes, err := netlink.RouteListFiltered(family, &netlink.Route{Dst: n.ToIPNet()}, netlink.RT_FILTER_DST)
+	if err != nil {
+		return nil, fmt.Errorf("error listing routes for %s: %w", n, err)
+	}
+	return routes, nil
+}
+
+// routeDrifted checks if the effective route to a shoot network, i.e. the one with the lowest metric, is missing or
+// does not point to exactly the tunnel links with the given indexes.
+func routeDrifted(installed []netlink.Route, linkIndexes []int) bool {
+	if len(installed) == 0 {
+		return true
+	}
+	effective := slices.MinFunc(installed, func(a, b netlink.Route) int { return a.Priority - b.Priority })
+	nexthops := []int{effective.LinkIndex}
+	if len(effective.MultiPath) > 0 {
+		nexthops = nexthops[:0]
+		for _, nexthop := range effective.MultiPath {
+			nexthops = append(nexthops, nexthop.LinkIndex)
+		}
+	}
+	slices.Sort(nexthops)
+	return !slices.Equal(nexthops, slices.Sorted(slices.Values(linkIndexes)))
+}
+
+// shootNetworks returns the networks routed to the shoot, mapped if they overlap with the seed pod network.
+func (r *netlinkRouter) shootNetworks() ([]network.CIDR, error) {
 	var (
 		serviceNetworks []network.CIDR
 		podNetworks     []network.CIDR
@@ -136,9 +449,9 @@ func (r *netlinkRouter) updateRouting(newIP net.IP) error {
 	)
 
 	// we don't need the specific mappings here because the /8 routes encompass all shoot networks
-	_, _, _, err = network.ShootNetworksForNetmap(r.shootPodNetworks, r.shootServiceNetworks, r.shootNodeNetworks)
+	_, _, _, err := network.ShootNetworksForNetmap(r.shootPodNetworks, r.shootServiceNetworks, r.shootNodeNetworks)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// Check if there is an overlap between the seed pod network and shoot networks.
@@ -167,23 +480,7 @@ func (r *netlinkRouter) updateRouting(newIP net.IP) error {
 		}
 	}
 
-	nets := [][]network.CIDR{
-		serviceNetworks,
-		podNetworks,
-		nodeNetworks,
-	}
-
-	for _, nw := range nets {
-		for _, n := range nw {
-			route := routeForNetwork(n.ToIPNet(), tunnelLink)
-			r.log.Info("replacing route", "route", route, "net", n)
-			err = netlink.RouteReplace(&route)
-			if err != nil {
-				return fmt.Errorf("error replacing route for %s: %w", n, err)
-			}
-		}
-	}
-	return nil
+	return slices.Concat(serviceNetworks, podNetworks, nodeNetworks), nil
 }
 
 func routeForNetwork(net *net.IPNet, tunnelLink netlink.Link) netlink.Route {
@@ -192,3 +489,32 @@ func routeForNetwork(net *net.IPNet, tunnelLink netlink.Link) netlink.Route {
 		LinkIndex: tunnelLink.Attrs().Index,
 	}
 }
+
+// multipathRouteForNetwork returns an equal-cost multipath route over all tunnel links.
+func multipathRouteForNetwork(net *net.IPNet, tunnelLinks []netlink.Link) netlink.Route {
+	route := netlink.Route{Dst: net}
+	for _, tunnelLink := range tunnelLinks {
+		route.MultiPath = append(route.MultiPath, &netlink.NexthopInfo{LinkIndex: tunnelLink.Attrs().Index})
+	}
+	return route
+}
+
+// describeRoute describes a route in `ip route` notation.
+func describeRoute(route netlink.Route, linkName func(index int) string) string {
+	description := route.Dst.String()
+	if len(route.MultiPath) == 0 {
+		return description + " dev " + linkName(route.LinkIndex)
+	}
+	for _, nexthop := range route.MultiPath {
+		description += " nexthop dev " + linkName(nexthop.LinkIndex)
+	}
+	return description
+}
+
+func linkName(index int) string {
+	link, err := netlink.LinkByIndex(index)
+	if err != nil {
+		return strconv.Itoa(index)
+	}
+	return link.Attrs().Name
+}
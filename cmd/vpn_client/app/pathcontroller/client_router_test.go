@@ -7,10 +7,16 @@ package pathcontroller
 import (
 	"errors"
 	"net"
+	"time"
 
 	"github.com/go-logr/logr"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"github.com/vishvananda/netlink"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+
+	"github.com/gardener/vpn2/pkg/events"
 )
 
 type noopNetRouter struct{}
@@ -19,29 +25,70 @@ func (noopNetRouter) updateRouting(_ net.IP) (_ error) {
 	return nil
 }
 
+func (noopNetRouter) updateMultipathRouting(_ []net.IP) (_ error) {
+	return nil
+}
+
+func (noopNetRouter) installedRoutes() ([]string, error) {
+	return nil, nil
+}
+
+func (noopNetRouter) reconcileRouting(_ []net.IP, _ bool) ([]string, error) {
+	return nil, nil
+}
+
 // fakePinger implements pinger interface and returns and error if clientIP used for ping is part of badIPs
 type fakePinger struct {
 	badIPs map[string]struct{}
 }
 
-func (f *fakePinger) Ping(client net.IP) (_ error) {
+func (f *fakePinger) Ping(client net.IP) (pingSample, error) {
 	if _, ok := f.badIPs[client.String()]; ok {
-		return errors.New("unhealthy")
+		return pingSample{}, errors.New("unhealthy")
 	}
+	return pingSample{}, nil
+}
+
+// recordingNetRouter records the IPs routing was updated to.
+type recordingNetRouter struct {
+	noopNetRouter
+	updates          []net.IP
+	multipathUpdates [][]net.IP
+	// drifted are the networks whose routes are restored on reconciliation
+	drifted    []string
+	reconciled [][]net.IP
+}
+
+func (r *recordingNetRouter) updateRouting(ip net.IP) error {
+	r.updates = append(r.updates, ip)
 	return nil
 }
 
+func (r *recordingNetRouter) updateMultipathRouting(ips []net.IP) error {
+	r.multipathUpdates = append(r.multipathUpdates, ips)
+	return nil
+}
+
+func (r *recordingNetRouter) reconcileRouting(ips []net.IP, _ bool) ([]string, error) {
+	r.reconciled = append(r.reconciled, ips)
+	return r.drifted, nil
+}
+
 var _ = Describe("#ClientRouter", func() {
 	var router *clientRouter
 	var pinger *fakePinger
+	var recorder *record.FakeRecorder
 	BeforeEach(func() {
 		pinger = &fakePinger{
 			badIPs: make(map[string]struct{}),
 		}
+		recorder = record.NewFakeRecorder(10)
 
 		router = &clientRouter{
 			netRouter: noopNetRouter{},
 			log:       logr.Discard(),
+			metrics:   newPathMetrics(),
+			recorder:  events.ForObject(recorder, &corev1.Pod{}),
 			pinger:    pinger,
 			goodIPs:   make(map[string]struct{}),
 		}
@@ -91,4 +138,191 @@ var _ = Describe("#ClientRouter", func() {
 			})
 		})
 	})
+
+	Describe("#pathStats", func() {
+		It("should compute RTT and loss over the sliding window", func() {
+			stats := newPathStats(3)
+			stats.record(pingSample{rtt: 10 * time.Millisecond, sent: 1})
+			stats.record(pingSample{rtt: 30 * time.Millisecond, sent: 2, lost: 1})
+			Expect(stats.rtt()).To(Equal(20 * time.Millisecond))
+			Expect(stats.loss()).To(BeNumerically("~", 1.0/3))
+
+			stats.record(pingSample{sent: 1, lost: 1})
+			stats.record(pingSample{rtt: 50 * time.Millisecond, sent: 1})
+			// the first sample has been pushed out of the window
+			Expect(stats.rtt()).To(Equal(40 * time.Millisecond))
+			Expect(stats.loss()).To(Equal(0.5))
+			Expect(stats.score()).To(Equal(40*time.Millisecond + 500*time.Millisecond))
+		})
+	})
+
+	Describe("#determinePrimaryShootClient with path statistics", func() {
+		var (
+			netRouter *recordingNetRouter
+			fastIP    = net.ParseIP("192.168.0.1")
+			slowIP    = net.ParseIP("192.168.0.2")
+		)
+
+		record := func(ip net.IP, sample pingSample, times int) {
+			for range times {
+				router.pathStats(ip.String()).record(sample)
+			}
+		}
+
+		BeforeEach(func() {
+			netRouter = &recordingNetRouter{}
+			router.netRouter = netRouter
+			router.windowSize = 5
+			router.hysteresis = 0.3
+			router.minDwellTime = time.Minute
+			router.goodIPs[fastIP.String()] = struct{}{}
+			router.goodIPs[slowIP.String()] = struct{}{}
+			record(fastIP, pingSample{rtt: 2 * time.Millisecond, sent: 1}, 5)
+			record(slowIP, pingSample{rtt: 80 * time.Millisecond, sent: 1}, 5)
+		})
+
+		It("should select the client with the best score", func() {
+			Expect(router.determinePrimaryShootClient()).To(Succeed())
+			Expect(router.primary).To(Equal(fastIP))
+			Expect(netRouter.updates).To(Equal([]net.IP{fastIP}))
+			Expect(recorder.Events).To(Receive(Equal("Normal PrimaryShootClientChanged Routing shoot networks over shoot client 192.168.0.1 (initial)")))
+		})
+
+		It("should replace a degraded primary after the minimum dwell time", func() {
+			router.primary = slowIP
+			router.lastSwitch = time.Now()
+			Expect(router.determinePrimaryShootClient()).To(Succeed())
+			Expect(router.primary).To(Equal(slowIP))
+
+			router.lastSwitch = time.Now().Add(-2 * time.Minute)
+			Expect(router.determinePrimaryShootClient()).To(Succeed())
+			Expect(router.primary).To(Equal(fastIP))
+			Expect(netRouter.updates).To(Equal([]net.IP{fastIP}))
+		})
+
+		It("should keep a healthy primary within the hysteresis", func() {
+			record(slowIP, pingSample{rtt: 3 * time.Millisecond, sent: 1}, 5)
+			router.primary = slowIP
+			Expect(router.determinePrimaryShootClient()).To(Succeed())
+			Expect(router.primary).To(Equal(slowIP))
+			Expect(netRouter.updates).To(BeEmpty())
+		})
+
+		It("should prefer the client without loss", func() {
+			record(fastIP, pingSample{rtt: 2 * time.Millisecond, sent: 3, lost: 2}, 5)
+			Expect(router.determinePrimaryShootClient()).To(Succeed())
+			Expect(router.primary).To(Equal(slowIP))
+		})
+
+		It("should replace an unhealthy primary immediately", func() {
+			router.primary = fastIP
+			router.lastSwitch = time.Now()
+			delete(router.goodIPs, fastIP.String())
+			Expect(router.determinePrimaryShootClient()).To(Succeed())
+			Expect(router.primary).To(Equal(slowIP))
+			Expect(recorder.Events).To(Receive(Equal("Warning PrimaryShootClientChanged Switched primary shoot client from 192.168.0.1 to 192.168.0.2 (unhealthy)")))
+		})
+	})
+	Describe("#updateMultipathMembers", func() {
+		var (
+			netRouter *recordingNetRouter
+			ip1       = net.ParseIP("fd8f:6d53:b97a:1::b00:2")
+			ip2       = net.ParseIP("fd8f:6d53:b97a:1::b00:3")
+		)
+
+		BeforeEach(func() {
+			netRouter = &recordingNetRouter{}
+			router.netRouter = netRouter
+			router.multipath = true
+		})
+
+		It("should route over all good clients in a stable order", func() {
+			pinger.badIPs[ip1.String()] = struct{}{}
+			router.pingAllShootClients([]net.IP{ip2, ip1})
+			Expect(router.updateMultipathMembers()).To(Succeed())
+
+			delete(pinger.badIPs, ip1.String())
+			router.pingAllShootClients([]net.IP{ip2, ip1})
+			Expect(router.updateMultipathMembers()).To(Succeed())
+			Expect(router.updateMultipathMembers()).To(Succeed())
+
+			Expect(netRouter.multipathUpdates).To(Equal([][]net.IP{{ip2}, {ip1, ip2}}))
+			Expect(netRouter.updates).To(BeEmpty())
+			Expect(recorder.Events).To(HaveLen(2))
+			Expect(recorder.Events).To(Receive(Equal("Normal ShootClientsChanged Routing shoot networks over shoot clients [fd8f:6d53:b97a:1::b00:3] instead of []")))
+			Expect(recorder.Events).To(Receive(Equal("Normal ShootClientsChanged Routing shoot networks over shoot clients [fd8f:6d53:b97a:1::b00:2 fd8f:6d53:b97a:1::b00:3] instead of [fd8f:6d53:b97a:1::b00:3]")))
+		})
+
+		It("should keep the routes if no client is good", func() {
+			router.members = []net.IP{ip1}
+			Expect(router.updateMultipathMembers()).To(MatchError("no more good ips in pool"))
+			Expect(netRouter.multipathUpdates).To(BeEmpty())
+			Expect(router.members).To(Equal([]net.IP{ip1}))
+		})
+	})
+
+	Describe("#reconcileRouting", func() {
+		var (
+			netRouter *recordingNetRouter
+			ip1       = net.ParseIP("fd8f:6d53:b97a:1::b00:2")
+			ip2       = net.ParseIP("fd8f:6d53:b97a:1::b00:3")
+		)
+
+		BeforeEach(func() {
+			netRouter = &recordingNetRouter{drifted: []string{"100.64.0.0/13"}}
+			router.netRouter = netRouter
+		})
+
+		It("should not reconcile before the routes have been installed", func() {
+			Expect(router.reconcileRouting()).To(Succeed())
+			Expect(netRouter.reconciled).To(BeEmpty())
+		})
+
+		It("should restore the routes over the primary shoot client", func() {
+			router.primary = ip1
+			Expect(router.reconcileRouting()).To(Succeed())
+			Expect(netRouter.reconciled).To(Equal([][]net.IP{{ip1}}))
+		})
+
+		It("should restore the routes over all members in multipath mode", func() {
+			router.multipath = true
+			router.primary = ip1
+			router.members = []net.IP{ip1, ip2}
+			Expect(router.reconcileRouting()).To(Succeed())
+			Expect(netRouter.reconciled).To(Equal([][]net.IP{{ip1, ip2}}))
+		})
+	})
+
+	DescribeTable("#routeDrifted",
+		func(installed []netlink.Route, linkIndexes []int, drifted bool) {
+			Expect(routeDrifted(installed, linkIndexes)).To(Equal(drifted))
+		},
+		Entry("missing route", nil, []int{7}, true),
+		Entry("route over the expected link", []netlink.Route{{LinkIndex: 7}}, []int{7}, false),
+		Entry("route over another link", []netlink.Route{{LinkIndex: 8}}, []int{7}, true),
+		Entry("route with a lower metric over another link",
+			[]netlink.Route{{LinkIndex: 7, Priority: 1024}, {LinkIndex: 8, Priority: 100}}, []int{7}, true),
+		Entry("multipath route in another order",
+			[]netlink.Route{{MultiPath: []*netlink.NexthopInfo{{LinkIndex: 9}, {LinkIndex: 7}}}}, []int{7, 9}, false),
+		Entry("multipath route with a missing nexthop",
+			[]netlink.Route{{MultiPath: []*netlink.NexthopInfo{{LinkIndex: 7}}}}, []int{7, 9}, true),
+		Entry("single route instead of a multipath route", []netlink.Route{{LinkIndex: 7}}, []int{7, 9}, true),
+	)
+
+	Describe("#multipathRouteForNetwork", func() {
+		It("should add a nexthop for each tunnel link", func() {
+			_, dst, _ := net.ParseCIDR("100.64.0.0/13")
+			links := []netlink.Link{
+				&netlink.Ip6tnl{LinkAttrs: netlink.LinkAttrs{Index: 7}},
+				&netlink.Ip6tnl{LinkAttrs: netlink.LinkAttrs{Index: 9}},
+			}
+			route := multipathRouteForNetwork(dst, links)
+			Expect(route.Dst).To(Equal(dst))
+			Expect(route.LinkIndex).To(BeZero())
+			Expect(route.MultiPath).To(ConsistOf(
+				HaveField("LinkIndex", 7),
+				HaveField("LinkIndex", 9),
+			))
+		})
+	})
 })
@@ -0,0 +1,155 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package pathcontroller
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const (
+	// DefaultMetricsAddress is the default address of the metrics endpoint of the path-controller.
+	DefaultMetricsAddress = ":15000"
+	metricsPath           = "/metrics"
+
+	metricsNamespace = "vpn_path_controller"
+
+	// switch reasons of the primary shoot client
+	switchReasonInitial   = "initial"
+	switchReasonUnhealthy = "unhealthy"
+	switchReasonDegraded  = "degraded"
+	switchReasonMembers   = "members-changed"
+)
+
+// pathMetrics are the metrics of the path-controller.
+type pathMetrics struct {
+	registry *prometheus.Registry
+
+	pingRTT           *prometheus.HistogramVec
+	pingFailures      *prometheus.CounterVec
+	pingRetries       *prometheus.CounterVec
+	primary           *prometheus.GaugeVec
+	primarySwitches   *prometheus.CounterVec
+	routeUpdateErrors prometheus.Counter
+	routeCorrections  *prometheus.CounterVec
+	sendPodIPFailures *prometheus.CounterVec
+}
+
+func newPathMetrics() *pathMetrics {
+	m := &pathMetrics{
+		registry: prometheus.NewRegistry(),
+		pingRTT: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "ping_rtt_seconds",
+			Help:      "Round-trip time of the successful pings to a shoot client.",
+			Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+		}, []string{"client"}),
+		pingFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "ping_failures_total",
+			Help:      "Number of pings to a shoot client which failed after all retries.",
+		}, []string{"client"}),
+		pingRetries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "ping_retries_total",
+			Help:      "Number of echo requests to a shoot client which were retried or failed.",
+		}, []string{"client"}),
+		primary: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "primary_shoot_client",
+			Help:      "Whether the shoot networks are routed over the shoot client (1) or not (0).",
+		}, []string{"client"}),
+		primarySwitches: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "primary_switches_total",
+			Help:      "Number of changes of the shoot clients the shoot networks are routed over.",
+		}, []string{"reason"}),
+		routeUpdateErrors: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "route_update_errors_total",
+			Help:      "Number of failed updates of the routes to the shoot networks.",
+		}),
+		routeCorrections: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "route_corrections_total",
+			Help:      "Number of drifted routes to a shoot network restored by the path-controller.",
+		}, []string{"network"}),
+		sendPodIPFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "send_pod_ip_failures_total",
+			Help:      "Number of failures sending the pod IP to the tunnel-controller of a shoot client.",
+		}, []string{"client"}),
+	}
+	m.registry.MustRegister(
+		m.pingRTT,
+		m.pingFailures,
+		m.pingRetries,
+		m.primary,
+		m.primarySwitches,
+		m.routeUpdateErrors,
+		m.routeCorrections,
+		m.sendPodIPFailures,
+	)
+	return m
+}
+
+// observePing records the result of pinging a shoot client.
+func (m *pathMetrics) observePing(client net.IP, sample pingSample, err error) {
+	ip := client.String()
+	if sample.lost > 0 {
+		m.pingRetries.WithLabelValues(ip).Add(float64(sample.lost))
+	}
+	if err != nil {
+		m.pingFailures.WithLabelValues(ip).Inc()
+		return
+	}
+	m.pingRTT.WithLabelValues(ip).Observe(sample.rtt.Seconds())
+}
+
+// setPrimaries marks the given shoot clients as the ones the shoot networks are routed over.
+func (m *pathMetrics) setPrimaries(reason string, old, current []net.IP) {
+	for _, ip := range old {
+		m.primary.WithLabelValues(ip.String()).Set(0)
+	}
+	for _, ip := range current {
+		m.primary.WithLabelValues(ip.String()).Set(1)
+	}
+	m.primarySwitches.WithLabelValues(reason).Inc()
+}
+
+func (m *pathMetrics) handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// serve serves the metrics on the given address until the context is cancelled.
+func (m *pathMetrics) serve(ctx context.Context, log logr.Logger, address string) {
+	if address == "" {
+		return
+	}
+	mux := http.NewServeMux()
+	mux.Handle(metricsPath, m.handler())
+	server := &http.Server{
+		Addr:              address,
+		Handler:           mux,
+		ReadHeaderTimeout: 2 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		_ = server.Close()
+	}()
+	go func() {
+		log.Info("serving metrics", "address", address, "path", metricsPath)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Error(err, "metrics server stopped with error")
+		}
+	}()
+}
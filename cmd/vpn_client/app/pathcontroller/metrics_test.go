@@ -0,0 +1,119 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package pathcontroller
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http/httptest"
+	"time"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("#pathMetrics", func() {
+	var (
+		metrics *pathMetrics
+		ip1     = net.ParseIP("192.168.0.1")
+		ip2     = net.ParseIP("192.168.0.2")
+	)
+
+	BeforeEach(func() {
+		metrics = newPathMetrics()
+	})
+
+	scrape := func() string {
+		recorder := httptest.NewRecorder()
+		metrics.handler().ServeHTTP(recorder, httptest.NewRequest("GET", metricsPath, nil))
+		body, err := io.ReadAll(recorder.Result().Body)
+		Expect(err).NotTo(HaveOccurred())
+		return string(body)
+	}
+
+	It("should record the pings of the shoot clients", func() {
+		metrics.observePing(ip1, pingSample{rtt: 3 * time.Millisecond, sent: 3, lost: 2}, nil)
+		metrics.observePing(ip2, pingSample{sent: 10, lost: 10}, errors.New("timeout"))
+
+		Expect(scrape()).To(And(
+			ContainSubstring(`vpn_path_controller_ping_rtt_seconds_bucket{client="192.168.0.1",le="0.005"} 1`),
+			ContainSubstring(`vpn_path_controller_ping_rtt_seconds_count{client="192.168.0.1"} 1`),
+			ContainSubstring(`vpn_path_controller_ping_retries_total{client="192.168.0.1"} 2`),
+			ContainSubstring(`vpn_path_controller_ping_retries_total{client="192.168.0.2"} 10`),
+			ContainSubstring(`vpn_path_controller_ping_failures_total{client="192.168.0.2"} 1`),
+			Not(ContainSubstring(`vpn_path_controller_ping_failures_total{client="192.168.0.1"}`)),
+		))
+	})
+
+	It("should record the switches of the primary shoot client", func() {
+		metrics.setPrimaries(switchReasonInitial, nil, []net.IP{ip1})
+		metrics.setPrimaries(switchReasonUnhealthy, []net.IP{ip1}, []net.IP{ip2})
+
+		Expect(scrape()).To(And(
+			ContainSubstring(`vpn_path_controller_primary_shoot_client{client="192.168.0.1"} 0`),
+			ContainSubstring(`vpn_path_controller_primary_shoot_client{client="192.168.0.2"} 1`),
+			ContainSubstring(`vpn_path_controller_primary_switches_total{reason="initial"} 1`),
+			ContainSubstring(`vpn_path_controller_primary_switches_total{reason="unhealthy"} 1`),
+		))
+	})
+
+	It("should count failed route updates", func() {
+		router := &clientRouter{
+			netRouter: failingNetRouter{},
+			metrics:   metrics,
+			goodIPs:   map[string]struct{}{ip1.String(): {}},
+		}
+		Expect(router.determinePrimaryShootClient()).NotTo(Succeed())
+		Expect(router.primary).To(BeNil())
+		Expect(scrape()).To(And(
+			ContainSubstring(`vpn_path_controller_route_update_errors_total 1`),
+			Not(ContainSubstring(`vpn_path_controller_primary_switches_total`)),
+		))
+	})
+
+	It("should count restored routes", func() {
+		router := &clientRouter{
+			netRouter: &recordingNetRouter{drifted: []string{"100.64.0.0/13", "100.96.0.0/11"}},
+			log:       logr.Discard(),
+			metrics:   metrics,
+			primary:   ip1,
+		}
+		Expect(router.reconcileRouting()).To(Succeed())
+		Expect(router.reconcileRouting()).To(Succeed())
+		Expect(scrape()).To(And(
+			ContainSubstring(`vpn_path_controller_route_corrections_total{network="100.64.0.0/13"} 2`),
+			ContainSubstring(`vpn_path_controller_route_corrections_total{network="100.96.0.0/11"} 2`),
+		))
+	})
+
+	It("should count failed route reconciliations", func() {
+		router := &clientRouter{
+			netRouter: failingNetRouter{},
+			log:       logr.Discard(),
+			metrics:   metrics,
+			primary:   ip1,
+		}
+		Expect(router.reconcileRouting()).To(MatchError("error reconciling routes: route update failed"))
+		Expect(scrape()).To(ContainSubstring(`vpn_path_controller_route_update_errors_total 1`))
+	})
+})
+
+type failingNetRouter struct {
+	noopNetRouter
+}
+
+func (failingNetRouter) updateRouting(_ net.IP) error {
+	return errors.New("route update failed")
+}
+
+func (failingNetRouter) updateMultipathRouting(_ []net.IP) error {
+	return errors.New("route update failed")
+}
+
+func (failingNetRouter) reconcileRouting(_ []net.IP, _ bool) ([]string, error) {
+	return nil, errors.New("route update failed")
+}
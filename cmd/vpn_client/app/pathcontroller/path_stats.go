@@ -0,0 +1,85 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package pathcontroller
+
+import (
+	"time"
+)
+
+// lossPenalty is the latency added to the score of a path for 100% loss, i.e. 10% loss weighs like 100ms RTT.
+const lossPenalty = time.Second
+
+// pingSample is the result of pinging a shoot client once.
+type pingSample struct {
+	rtt  time.Duration
+	sent int
+	lost int
+}
+
+// pathStats keeps the ping samples of a shoot client over a sliding window.
+type pathStats struct {
+	samples []pingSample
+	pos     int
+	count   int
+}
+
+func newPathStats(windowSize int) *pathStats {
+	return &pathStats{samples: make([]pingSample, windowSize)}
+}
+
+func (s *pathStats) record(sample pingSample) {
+	s.samples[s.pos] = sample
+	s.pos = (s.pos + 1) % len(s.samples)
+	if s.count < len(s.samples) {
+		s.count++
+	}
+}
+
+// rtt returns the average round-trip time of the successful pings in the window.
+func (s *pathStats) rtt() time.Duration {
+	var (
+		sum       time.Duration
+		succeeded int
+	)
+	for _, sample := range s.samples[:s.count] {
+		if sample.lost < sample.sent {
+			sum += sample.rtt
+			succeeded++
+		}
+	}
+	if succeeded == 0 {
+		return 0
+	}
+	return sum / time.Duration(succeeded)
+}
+
+// loss returns the ratio of lost echo requests in the window.
+func (s *pathStats) loss() float64 {
+	var sent, lost int
+	for _, sample := range s.samples[:s.count] {
+		sent += sample.sent
+		lost += sample.lost
+	}
+	if sent == 0 {
+		return 0
+	}
+	return float64(lost) / float64(sent)
+}
+
+// score rates the path, lower is better. Loss is weighted by the lossPenalty and added to the RTT.
+func (s *pathStats) score() time.Duration {
+	return s.rtt() + time.Duration(s.loss()*float64(lossPenalty))
+}
+
+// normalize counts the ping as single echo request if the pinger has not reported any.
+func (s pingSample) normalize(err error) pingSample {
+	if s.sent == 0 {
+		s.sent = 1
+		if err != nil {
+			s.lost = 1
+		}
+	}
+	return s
+}
@@ -8,7 +8,9 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"net"
+	"net/http"
 	"os"
 	"slices"
 	"time"
@@ -18,13 +20,18 @@ import (
 
 	"github.com/gardener/vpn2/pkg/config"
 	"github.com/gardener/vpn2/pkg/constants"
+	"github.com/gardener/vpn2/pkg/events"
 	"github.com/gardener/vpn2/pkg/network"
+	"github.com/gardener/vpn2/pkg/shoot_client/tunnel"
 	"github.com/gardener/vpn2/pkg/utils"
+	"github.com/gardener/vpn2/pkg/vpn_client"
 )
 
 const Name = "path-controller"
 
 func NewCommand() *cobra.Command {
+	var logLevelAddress, metricsAddress, readinessAddress string
+
 	cmd := &cobra.Command{
 		Use:   Name,
 		Short: Name,
@@ -35,27 +42,30 @@ func NewCommand() *cobra.Command {
 				return err
 			}
 			ctx, cancel := context.WithCancel(cmd.Context())
-			return run(ctx, cancel, log)
+			return run(ctx, cancel, log, logLevelAddress, metricsAddress, readinessAddress)
 		},
 	}
 
+	cmd.Flags().StringVar(&logLevelAddress, "log-level-address", utils.DefaultLogLevelAddress, "address of the endpoints to change the log level at runtime and to inspect the state (empty to disable)")
+	cmd.Flags().StringVar(&metricsAddress, "metrics-address", DefaultMetricsAddress, "address of the metrics endpoint (empty to disable)")
+	cmd.Flags().StringVar(&readinessAddress, "readiness-address", DefaultReadinessAddress, "address of the readiness endpoint (empty to disable)")
 	return cmd
 }
 
-func run(ctx context.Context, _ context.CancelFunc, log logr.Logger) error {
+func run(ctx context.Context, _ context.CancelFunc, log logr.Logger, logLevelAddress, metricsAddress, readinessAddress string) error {
 	cfg, err := config.GetPathControllerConfig(log)
 	if err != nil {
 		return err
 	}
 
-	checkNetworks := cfg.ShootNodeNetworks
-	if len(checkNetworks) == 0 {
-		checkNetworks = cfg.ShootServiceNetworks
-	}
-	if len(checkNetworks) == 0 {
+	if len(cfg.ShootServiceNetworks) == 0 {
 		return errors.New("network to check is undefined")
 	}
 
+	if err := checkMultipathHashPolicy(cfg.ECMPRouting, network.HostSysctl("")); err != nil {
+		log.Info("ECMP_ROUTING must be set to the same value for vpn-client-init and path-controller", "error", err)
+	}
+
 	netlinkRouter := &netlinkRouter{
 		seedPodNetwork:       cfg.SeedPodNetwork,
 		shootPodNetworks:     cfg.ShootPodNetworks,
@@ -84,21 +94,124 @@ func run(ctx context.Context, _ context.CancelFunc, log logr.Logger) error {
 		podIP = mappedIP
 	}
 
+	registrationSecret, err := tunnel.LoadSecret(cfg.RegistrationSecretFile)
+	if err != nil {
+		return err
+	}
+
+	metrics := newPathMetrics()
+	metrics.serve(ctx, log, metricsAddress)
+
+	recorder, stopRecording := events.NewRecorder(log.WithName("events"), Name, events.Pod{
+		Namespace: cfg.Namespace,
+		Name:      cfg.PodName,
+		UID:       cfg.PodUID,
+	})
+	defer stopRecording()
+
+	probeTarget := cfg.PathProbeTarget
+	if probeTarget == "" {
+		probeTarget, err = defaultProbeTarget(cfg.ShootServiceNetworks[0], overlap)
+		if err != nil {
+			return err
+		}
+	}
+	pinger, err := newPinger(cfg.PathProbes, probeOptions{
+		log:         log.WithName("ping"),
+		timeout:     cfg.PathProbeTimeout,
+		retries:     cfg.PathProbeRetries,
+		retryJitter: 100 * time.Millisecond,
+		target:      probeTarget,
+	})
+	if err != nil {
+		return err
+	}
+	if closer, ok := pinger.(io.Closer); ok {
+		defer closer.Close()
+	}
+
 	router := &clientRouter{
-		pinger: &icmpPinger{
-			log:     log.WithName("ping"),
-			timeout: 1 * time.Second,
-			retries: 9,
-		},
+		pinger:             pinger,
 		ticker:             time.NewTicker(constants.PathControllerUpdateInterval),
 		kubeAPIServerPodIP: podIP,
+		registrationSecret: registrationSecret,
 		netRouter:          netlinkRouter,
-		checkedNet:         checkNetworks[0].ToIPNet(),
 		goodIPs:            make(map[string]struct{}),
 		log:                log.WithName("pingRouter"),
+		metrics:            metrics,
+		recorder:           recorder,
+		stats:              make(map[string]*pathStats),
+		windowSize:         cfg.PathWindowSize,
+		hysteresis:         cfg.PathSwitchHysteresis,
+		minDwellTime:       cfg.PathMinDwellTime,
+		multipath:          cfg.ECMPRouting,
+	}
+	if cfg.RouteReconcileInterval > 0 {
+		router.reconcileTicker = time.NewTicker(cfg.RouteReconcileInterval)
 	}
 
+	utils.ServeLogLevel(ctx, log, logLevelAddress, map[string]http.Handler{statePath: router.stateHandler()})
+	runReadinessServer(ctx, router, log, readinessAddress)
+
 	// acquired ip is not necessary here, because we don't care about the subnet
 	clientIPs := network.AllBondingShootClientIPs(cfg.VPNNetwork.ToIPNet(), cfg.HAVPNClients)
 	return router.Run(ctx, clientIPs)
 }
+
+// defaultProbeTarget returns the HTTPS port of the kubernetes service, i.e. the first address of the service network.
+// The address is mapped like the routes if the shoot networks overlap with the seed pod network.
+func defaultProbeTarget(serviceNetwork network.CIDR, overlap bool) (string, error) {
+	ip := slices.Clone(serviceNetwork.ToIPNet().IP)
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	ip[len(ip)-1]++
+	address := ip.String()
+	if ip.To4() != nil && overlap {
+		var err error
+		if address, err = network.NetmapIP(address, constants.ShootServiceNetworkMapped); err != nil {
+			return "", fmt.Errorf("error mapping probe target %s: %w", address, err)
+		}
+	}
+	return net.JoinHostPort(address, "443"), nil
+}
+
+// checkMultipathHashPolicy checks that the multipath hash policy set by vpn-client-init in the shared network namespace
+// matches ECMP_ROUTING of the path-controller. Without the L4 policy, the ECMP routes spread the connections only by
+// their addresses. With the L4 policy but without ECMP_ROUTING, vpn-client-init was configured for ECMP routes the
+// path-controller does not install.
+func checkMultipathHashPolicy(ecmpRouting bool, s network.Sysctl) error {
+	state := "disabled"
+	if ecmpRouting {
+		state = "enabled"
+	}
+	var errs []error
+	for _, name := range vpn_client.MultipathHashPolicies {
+		value, err := s.Get(name)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to read %s: %w", name, err))
+			continue
+		}
+		if (value == vpn_client.MultipathHashPolicyL4) != ecmpRouting {
+			errs = append(errs, fmt.Errorf("%s is %s although ECMP routing is %s", name, value, state))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func runReadinessServer(ctx context.Context, router *clientRouter, log logr.Logger, address string) {
+	if address == "" {
+		return
+	}
+	server := router.newReadinessServer(address)
+	go func() {
+		<-ctx.Done()
+		_ = server.Close()
+	}()
+	go func() {
+		log.Info("Starting readiness server", "address", address)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Error(err, "readiness server stopped with error")
+		}
+	}()
+}
@@ -5,6 +5,7 @@
 package pathcontroller
 
 import (
+	"errors"
 	"testing"
 
 	. "github.com/onsi/ginkgo/v2"
@@ -15,3 +16,53 @@ func TestPathcontroller(t *testing.T) {
 	RegisterFailHandler(Fail)
 	RunSpecs(t, "Pathcontroller Suite")
 }
+
+// mapSysctl holds the kernel parameters in memory, missing ones cannot be read.
+type mapSysctl map[string]string
+
+func (m mapSysctl) Get(name string) (string, error) {
+	value, ok := m[name]
+	if !ok {
+		return "", errors.New("no such file or directory")
+	}
+	return value, nil
+}
+
+func (m mapSysctl) Set(name, value string) error {
+	m[name] = value
+	return nil
+}
+
+var _ = Describe("#checkMultipathHashPolicy", func() {
+	It("should succeed if the multipath hash policy matches ECMP_ROUTING", func() {
+		Expect(checkMultipathHashPolicy(true, mapSysctl{
+			"net.ipv4.fib_multipath_hash_policy": "1",
+			"net.ipv6.fib_multipath_hash_policy": "1",
+		})).To(Succeed())
+		Expect(checkMultipathHashPolicy(false, mapSysctl{
+			"net.ipv4.fib_multipath_hash_policy": "0",
+			"net.ipv6.fib_multipath_hash_policy": "0",
+		})).To(Succeed())
+	})
+
+	It("should fail if ECMP_ROUTING is only set for the path-controller", func() {
+		err := checkMultipathHashPolicy(true, mapSysctl{
+			"net.ipv4.fib_multipath_hash_policy": "0",
+			"net.ipv6.fib_multipath_hash_policy": "1",
+		})
+		Expect(err).To(MatchError("net.ipv4.fib_multipath_hash_policy is 0 although ECMP routing is enabled"))
+	})
+
+	It("should fail if ECMP_ROUTING is only set for vpn-client-init", func() {
+		err := checkMultipathHashPolicy(false, mapSysctl{
+			"net.ipv4.fib_multipath_hash_policy": "1",
+			"net.ipv6.fib_multipath_hash_policy": "1",
+		})
+		Expect(err).To(MatchError(ContainSubstring("net.ipv6.fib_multipath_hash_policy is 1 although ECMP routing is disabled")))
+	})
+
+	It("should fail if the multipath hash policy cannot be read", func() {
+		err := checkMultipathHashPolicy(true, mapSysctl{"net.ipv4.fib_multipath_hash_policy": "1"})
+		Expect(err).To(MatchError("failed to read net.ipv6.fib_multipath_hash_policy: no such file or directory"))
+	})
+})
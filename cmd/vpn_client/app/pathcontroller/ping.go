@@ -10,108 +10,242 @@ import (
 	"fmt"
 	"net"
 	"os"
+	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/go-logr/logr"
 	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
 	"golang.org/x/net/ipv6"
 )
 
+const echoPayload = "HELLO-R-U-THERE"
+
+// echoFamily describes the ICMP echo of an IP family.
+type echoFamily struct {
+	network  string
+	protocol int
+	request  icmp.Type
+	reply    icmp.Type
+}
+
+var (
+	echoIPv4 = echoFamily{network: "udp4", protocol: 1, request: ipv4.ICMPTypeEcho, reply: ipv4.ICMPTypeEchoReply}
+	echoIPv6 = echoFamily{network: "udp6", protocol: 58, request: ipv6.ICMPTypeEchoRequest, reply: ipv6.ICMPTypeEchoReply}
+)
+
+// icmpPinger pings the shoot clients over one long-lived ICMP socket per IP family.
+// Pings to different clients are in flight concurrently, the replies are demultiplexed by the receive loop of the socket.
 type icmpPinger struct {
 	log     logr.Logger
 	timeout time.Duration
 	retries int
-	lastSeq atomic.Int32
+	// retryJitter is the maximum random delay before an echo request is retried.
+	retryJitter time.Duration
+	// listen opens the socket of a family, it defaults to an unprivileged ICMP socket.
+	listen func(family echoFamily) (net.PacketConn, error)
+
+	mu      sync.Mutex
+	sockets map[string]*echoSocket
 }
 
-const echoPayload = "HELLO-R-U-THERE"
+func (p *icmpPinger) Ping(client net.IP) (pingSample, error) {
+	socket, err := p.socket(client)
+	if err != nil {
+		return pingSample{}, err
+	}
+	return pingWithRetries(p.log, client, p.retries, p.retryJitter, func() (time.Duration, error) {
+		return socket.probe(client, p.timeout)
+	})
+}
 
-func (p *icmpPinger) Ping(client net.IP) error {
-	var err error
-	tries := p.retries + 1
-	for try := 1; try <= tries; try++ {
-		err = p.pingWithTimer(client)
-		if err == nil {
-			break
-		}
-		p.log.Info("ping failed", "ip", client, "error", err, "try", fmt.Sprintf("%d/%d", try, tries))
+// Close closes the sockets of the pinger.
+func (p *icmpPinger) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for network, socket := range p.sockets {
+		socket.close()
+		delete(p.sockets, network)
 	}
-	return err
+	return nil
 }
 
-func (p *icmpPinger) pingWithTimer(client net.IP) error {
-	timer := time.Now()
-	err := p.ping(client)
+// socket returns the socket of the IP family of the client, opening it if needed.
+func (p *icmpPinger) socket(client net.IP) (*echoSocket, error) {
+	family := echoIPv6
+	if client.To4() != nil {
+		family = echoIPv4
+	}
 
-	if d := time.Since(timer); d > 100*time.Millisecond {
-		if err == nil {
-			p.log.Info("ping to client took more than 100ms", "ip", client, "duration", fmt.Sprintf("%dms", d.Milliseconds()))
-		} else {
-			if neterr, ok := errors.AsType[net.Error](err); ok && neterr.Timeout() {
-				err = fmt.Errorf("i/o timeout after %dms", d.Milliseconds())
-			}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if socket, ok := p.sockets[family.network]; ok && !socket.isClosed() {
+		return socket, nil
+	}
+	listen := p.listen
+	if listen == nil {
+		listen = func(family echoFamily) (net.PacketConn, error) {
+			return icmp.ListenPacket(family.network, "")
 		}
 	}
-	return err
-}
-
-func (p *icmpPinger) ping(client net.IP) error {
-	c, err := icmp.ListenPacket("udp6", "")
+	conn, err := listen(family)
 	if err != nil {
-		return fmt.Errorf("error listening for packets: %w", err)
+		return nil, fmt.Errorf("error listening for packets: %w", err)
+	}
+	if p.sockets == nil {
+		p.sockets = map[string]*echoSocket{}
 	}
-	defer c.Close()
+	socket := newEchoSocket(p.log, family, conn)
+	p.sockets[family.network] = socket
+	return socket, nil
+}
 
-	deadline := time.Now().Add(p.timeout)
-	err = c.SetReadDeadline(deadline)
-	if err != nil {
-		return fmt.Errorf("error setting deadline: %w", err)
+// echoSocket sends echo requests over a socket and demultiplexes the replies by ID and sequence number.
+type echoSocket struct {
+	log    logr.Logger
+	family echoFamily
+	conn   net.PacketConn
+	id     int
+
+	lastSeq   atomic.Uint32
+	mu        sync.Mutex
+	pending   map[int]*probe
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+// probe is an echo request waiting for its reply.
+type probe struct {
+	peer    net.IP
+	replies chan time.Time
+}
+
+func newEchoSocket(log logr.Logger, family echoFamily, conn net.PacketConn) *echoSocket {
+	id := os.Getpid() & 0xffff // is marshaled as uint16 so we need to mask it
+	if addr, ok := conn.LocalAddr().(*net.UDPAddr); ok {
+		// the kernel replaces the ID of echo requests sent over unprivileged ICMP sockets by the local port
+		id = addr.Port & 0xffff
 	}
+	s := &echoSocket{
+		log:     log,
+		family:  family,
+		conn:    conn,
+		id:      id,
+		pending: map[int]*probe{},
+		closed:  make(chan struct{}),
+	}
+	go s.receive()
+	return s
+}
+
+// probe sends an echo request to the client and returns the round-trip time of its reply.
+func (s *echoSocket) probe(client net.IP, timeout time.Duration) (time.Duration, error) {
+	seq := int(s.lastSeq.Add(1) & 0xffff) // is marshaled as uint16 so we need to mask it
+	p := &probe{peer: client, replies: make(chan time.Time, 1)}
+	s.mu.Lock()
+	s.pending[seq] = p
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.pending, seq)
+		s.mu.Unlock()
+	}()
 
-	seq := p.lastSeq.Add(1) & 0xffff // is marshaled as uint16 so we need to mask it
 	msg := icmp.Message{
-		Type: ipv6.ICMPTypeEchoRequest,
+		Type: s.family.request,
 		Code: 0,
 		Body: &icmp.Echo{
-			ID:   os.Getpid() & 0xffff, // is marshaled as uint16 so we need to mask it
-			Seq:  int(seq),
+			ID:   s.id,
+			Seq:  seq,
 			Data: []byte(echoPayload),
 		},
 	}
 	marshaledMsg, err := msg.Marshal(nil)
 	if err != nil {
-		return fmt.Errorf("error marshaling msg: %w", err)
+		return 0, fmt.Errorf("error marshaling msg: %w", err)
+	}
 
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	sent := time.Now()
+	if _, err := s.conn.WriteTo(marshaledMsg, &net.UDPAddr{IP: client}); err != nil {
+		return 0, fmt.Errorf("error writing to client: %w", err)
 	}
-	if _, err := c.WriteTo(marshaledMsg, &net.UDPAddr{IP: client}); err != nil {
-		return fmt.Errorf("error writing to client: %w", err)
+	select {
+	case received := <-p.replies:
+		return received.Sub(sent), nil
+	case <-timer.C:
+		return 0, fmt.Errorf("i/o timeout after %dms", timeout.Milliseconds())
+	case <-s.closed:
+		return 0, net.ErrClosed
 	}
+}
 
+// receive reads the replies from the socket and passes them to the pending probes until the socket is closed.
+func (s *echoSocket) receive() {
+	defer s.close()
 	rb := make([]byte, 1500)
-	n, _, err := c.ReadFrom(rb)
-	if err != nil {
-		return fmt.Errorf("error reading response: %w", err)
+	for {
+		n, addr, err := s.conn.ReadFrom(rb)
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				s.log.Error(err, "error reading response, closing socket", "network", s.family.network)
+			}
+			return
+		}
+		received := time.Now()
 
-	}
-	rm, err := icmp.ParseMessage(ipv6.ICMPTypeEchoReply.Protocol(), rb[:n])
-	if err != nil {
-		return fmt.Errorf("error parsing response: %w", err)
-	}
-	switch rm.Type {
-	case ipv6.ICMPTypeEchoReply:
-		echo, ok := rm.Body.(*icmp.Echo)
-		if !ok {
-			return fmt.Errorf("error parsing response as ICMPTypeEchoReply")
+		rm, err := icmp.ParseMessage(s.family.protocol, rb[:n])
+		if err != nil {
+			s.log.V(1).Info("error parsing response", "error", err)
+			continue
 		}
-		if echo.Seq != int(seq) {
-			return fmt.Errorf("unexpected sequence number: %d != %d", echo.Seq, seq)
+		echo, ok := rm.Body.(*icmp.Echo)
+		if rm.Type != s.family.reply || !ok || echo.ID != s.id {
+			continue
 		}
 		if !bytes.Equal(echo.Data, []byte(echoPayload)) {
-			return fmt.Errorf("payload mismatch: %s", string(echo.Data))
+			s.log.V(1).Info("payload mismatch", "payload", string(echo.Data))
+			continue
+		}
+
+		s.mu.Lock()
+		p := s.pending[echo.Seq]
+		s.mu.Unlock()
+		if p == nil || !p.peer.Equal(peerIP(addr)) {
+			// late reply to a timed out probe
+			continue
 		}
-		return nil
+		select {
+		case p.replies <- received:
+		default:
+		}
+	}
+}
+
+func (s *echoSocket) close() {
+	s.closeOnce.Do(func() {
+		close(s.closed)
+		_ = s.conn.Close()
+	})
+}
+
+func (s *echoSocket) isClosed() bool {
+	select {
+	case <-s.closed:
+		return true
 	default:
-		return err
+		return false
+	}
+}
+
+func peerIP(addr net.Addr) net.IP {
+	switch addr := addr.(type) {
+	case *net.UDPAddr:
+		return addr.IP
+	case *net.IPAddr:
+		return addr.IP
 	}
+	return nil
 }
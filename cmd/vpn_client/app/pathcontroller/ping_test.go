@@ -0,0 +1,209 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package pathcontroller
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"golang.org/x/net/icmp"
+)
+
+type echoReply struct {
+	data []byte
+	from net.Addr
+}
+
+// fakeEchoConn answers echo requests like the kernel does for an unprivileged ICMP socket.
+type fakeEchoConn struct {
+	family echoFamily
+
+	mu sync.Mutex
+	// delays are the delays of the replies per peer
+	delays map[string]time.Duration
+	// dropped are the peers not answering
+	dropped map[string]struct{}
+	// foreignID answers with another ID, as if the reply belonged to another socket
+	foreignID bool
+
+	replies   chan echoReply
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+func newFakeEchoConn(family echoFamily) *fakeEchoConn {
+	return &fakeEchoConn{
+		family:  family,
+		delays:  map[string]time.Duration{},
+		dropped: map[string]struct{}{},
+		replies: make(chan echoReply, 100),
+		closed:  make(chan struct{}),
+	}
+}
+
+func (c *fakeEchoConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	select {
+	case reply := <-c.replies:
+		return copy(b, reply.data), reply.from, nil
+	case <-c.closed:
+		return 0, nil, net.ErrClosed
+	}
+}
+
+func (c *fakeEchoConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	request, err := icmp.ParseMessage(c.family.protocol, b)
+	if err != nil {
+		return 0, err
+	}
+	echo := request.Body.(*icmp.Echo)
+	peer := addr.(*net.UDPAddr)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.dropped[peer.IP.String()]; ok {
+		return len(b), nil
+	}
+	if c.foreignID {
+		echo.ID++
+	}
+	data, err := (&icmp.Message{Type: c.family.reply, Body: echo}).Marshal(nil)
+	if err != nil {
+		return 0, err
+	}
+	time.AfterFunc(c.delays[peer.IP.String()], func() {
+		c.replies <- echoReply{data: data, from: peer}
+	})
+	return len(b), nil
+}
+
+func (c *fakeEchoConn) Close() error {
+	c.closeOnce.Do(func() { close(c.closed) })
+	return nil
+}
+
+func (c *fakeEchoConn) LocalAddr() net.Addr                { return &net.UDPAddr{Port: 4242} }
+func (c *fakeEchoConn) SetDeadline(_ time.Time) error      { return nil }
+func (c *fakeEchoConn) SetReadDeadline(_ time.Time) error  { return nil }
+func (c *fakeEchoConn) SetWriteDeadline(_ time.Time) error { return nil }
+
+var _ = Describe("#icmpPinger", func() {
+	var (
+		conn   *fakeEchoConn
+		pinger *icmpPinger
+		opened int
+		ip1    = net.ParseIP("fd8f:6d53:b97a:1::b00:2")
+		ip2    = net.ParseIP("fd8f:6d53:b97a:1::b00:3")
+	)
+
+	BeforeEach(func() {
+		conn = newFakeEchoConn(echoIPv6)
+		opened = 0
+		pinger = &icmpPinger{
+			log:         logr.Discard(),
+			timeout:     50 * time.Millisecond,
+			retries:     2,
+			retryJitter: 5 * time.Millisecond,
+			listen: func(family echoFamily) (net.PacketConn, error) {
+				Expect(family).To(Equal(echoIPv6))
+				opened++
+				return conn, nil
+			},
+		}
+		DeferCleanup(pinger.Close)
+	})
+
+	It("should measure the round-trip time", func() {
+		conn.delays[ip1.String()] = 10 * time.Millisecond
+		sample, err := pinger.Ping(ip1)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(sample.sent).To(Equal(1))
+		Expect(sample.lost).To(BeZero())
+		Expect(sample.rtt).To(BeNumerically(">=", 10*time.Millisecond))
+	})
+
+	It("should retry lost echo requests", func() {
+		conn.dropped[ip1.String()] = struct{}{}
+		start := time.Now()
+		sample, err := pinger.Ping(ip1)
+		Expect(err).To(MatchError("i/o timeout after 50ms"))
+		Expect(sample).To(Equal(pingSample{sent: 3, lost: 3}))
+		Expect(time.Since(start)).To(BeNumerically("<", 3*50*time.Millisecond+2*5*time.Millisecond+50*time.Millisecond))
+	})
+
+	It("should ping all clients concurrently over one socket", func() {
+		conn.delays[ip1.String()] = 40 * time.Millisecond
+		conn.dropped[ip2.String()] = struct{}{}
+
+		var (
+			wg               sync.WaitGroup
+			sample1, sample2 pingSample
+			err1, err2       error
+		)
+		start := time.Now()
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			sample1, err1 = pinger.Ping(ip1)
+		}()
+		go func() {
+			defer wg.Done()
+			sample2, err2 = pinger.Ping(ip2)
+		}()
+		wg.Wait()
+
+		Expect(err1).NotTo(HaveOccurred())
+		Expect(sample1.sent).To(Equal(1))
+		Expect(sample1.rtt).To(BeNumerically(">=", 40*time.Millisecond))
+		Expect(err2).To(HaveOccurred())
+		Expect(sample2.lost).To(Equal(3))
+		// the dead client does not delay the healthy one
+		Expect(time.Since(start)).To(BeNumerically("<", 3*50*time.Millisecond+2*5*time.Millisecond+50*time.Millisecond))
+		Expect(opened).To(Equal(1))
+	})
+
+	It("should demultiplex replies arriving out of order", func() {
+		conn.delays[ip1.String()] = 30 * time.Millisecond
+		conn.delays[ip2.String()] = 0
+
+		var (
+			wg      sync.WaitGroup
+			slow    pingSample
+			errSlow error
+		)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			slow, errSlow = pinger.Ping(ip1)
+		}()
+		fast, err := pinger.Ping(ip2)
+		wg.Wait()
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(errSlow).NotTo(HaveOccurred())
+		Expect(fast.rtt).To(BeNumerically("<", 30*time.Millisecond))
+		Expect(slow.rtt).To(BeNumerically(">=", 30*time.Millisecond))
+	})
+
+	It("should ignore replies to other sockets", func() {
+		conn.foreignID = true
+		_, err := pinger.Ping(ip1)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should reopen the socket after it has been closed", func() {
+		_, err := pinger.Ping(ip1)
+		Expect(err).NotTo(HaveOccurred())
+		pinger.Close()
+
+		conn = newFakeEchoConn(echoIPv6)
+		_, err = pinger.Ping(ip1)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(opened).To(Equal(2))
+	})
+})
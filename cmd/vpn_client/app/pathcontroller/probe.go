@@ -0,0 +1,217 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package pathcontroller
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/go-logr/logr"
+	"golang.org/x/sys/unix"
+
+	"github.com/gardener/vpn2/pkg/network"
+	"github.com/gardener/vpn2/pkg/shoot_client/tunnel"
+)
+
+// Probe types checking the health of the paths to the shoot clients.
+const (
+	// ProbeICMP pings the bond IP of the shoot client, which proves that the tunnel is up.
+	ProbeICMP = "icmp"
+	// ProbeTCP connects to the probe target in the shoot over the shoot client, which proves that traffic reaches the shoot.
+	ProbeTCP = "tcp"
+	// ProbeUDP sends an echo request to the tunnel-controller of the shoot client.
+	ProbeUDP = "udp"
+)
+
+// probeOptions are the options of the probes.
+type probeOptions struct {
+	log         logr.Logger
+	timeout     time.Duration
+	retries     int
+	retryJitter time.Duration
+	// target is the address in the shoot the TCP probe connects to.
+	target string
+}
+
+// probeFactories is the registry of the probe types.
+var probeFactories = map[string]func(opts probeOptions) (pinger, error){
+	ProbeICMP: func(opts probeOptions) (pinger, error) {
+		return &icmpPinger{
+			log:         opts.log,
+			timeout:     opts.timeout,
+			retries:     opts.retries,
+			retryJitter: opts.retryJitter,
+		}, nil
+	},
+	ProbeTCP: func(opts probeOptions) (pinger, error) {
+		if opts.target == "" {
+			return nil, errors.New("tcp probe requires a target")
+		}
+		return &tcpProbe{probeOptions: opts, linkName: tunnelLinkNameForShootClient}, nil
+	},
+	ProbeUDP: func(opts probeOptions) (pinger, error) {
+		return &udpProbe{probeOptions: opts, echo: tunnel.Echo}, nil
+	},
+}
+
+// newPinger returns the pinger for the given probe types. Several probe types are combined by a compositePinger.
+func newPinger(types []string, opts probeOptions) (pinger, error) {
+	var pingers compositePinger
+	for _, probeType := range types {
+		factory, ok := probeFactories[probeType]
+		if !ok {
+			return nil, fmt.Errorf("unknown probe type %q", probeType)
+		}
+		p, err := factory(opts.withName(probeType))
+		if err != nil {
+			return nil, fmt.Errorf("error creating %s probe: %w", probeType, err)
+		}
+		pingers = append(pingers, p)
+	}
+	switch len(pingers) {
+	case 0:
+		return nil, errors.New("no probe types configured")
+	case 1:
+		return pingers[0], nil
+	}
+	return pingers, nil
+}
+
+func (o probeOptions) withName(name string) probeOptions {
+	o.log = o.log.WithName(name)
+	return o
+}
+
+// pingWithRetries runs the probe until it succeeds or all tries failed. Retries are delayed by a random jitter.
+func pingWithRetries(log logr.Logger, client net.IP, retries int, retryJitter time.Duration, probe func() (time.Duration, error)) (pingSample, error) {
+	var (
+		sample pingSample
+		err    error
+	)
+	tries := retries + 1
+	for try := 1; try <= tries; try++ {
+		if try > 1 && retryJitter > 0 {
+			time.Sleep(rand.N(retryJitter))
+		}
+		sample.sent++
+		var rtt time.Duration
+		rtt, err = probe()
+		if err == nil {
+			sample.rtt = rtt
+			if rtt > 100*time.Millisecond {
+				log.Info("ping to client took more than 100ms", "ip", client, "duration", fmt.Sprintf("%dms", rtt.Milliseconds()))
+			}
+			break
+		}
+		sample.lost++
+		log.Info("ping failed", "ip", client, "error", err, "try", fmt.Sprintf("%d/%d", try, tries))
+	}
+	return sample, err
+}
+
+// tcpProbe connects to the target in the shoot. The connection is bound to the tunnel link of the shoot client, so that
+// it is routed over this client regardless of the primary one.
+type tcpProbe struct {
+	probeOptions
+	// linkName returns the name of the link to bind the connection to, no binding if empty.
+	linkName func(client net.IP) string
+}
+
+func (p *tcpProbe) Ping(client net.IP) (pingSample, error) {
+	return pingWithRetries(p.log, client, p.retries, p.retryJitter, func() (time.Duration, error) {
+		dialer := net.Dialer{Timeout: p.timeout}
+		if name := p.linkName(client); name != "" {
+			dialer.Control = bindToDevice(name)
+		}
+		start := time.Now()
+		conn, err := dialer.Dial("tcp", p.target)
+		if err != nil {
+			return 0, fmt.Errorf("error connecting to %s: %w", p.target, err)
+		}
+		rtt := time.Since(start)
+		_ = conn.Close()
+		return rtt, nil
+	})
+}
+
+func bindToDevice(name string) func(network, address string, c syscall.RawConn) error {
+	return func(_, _ string, c syscall.RawConn) error {
+		var bindErr error
+		if err := c.Control(func(fd uintptr) {
+			bindErr = unix.BindToDevice(int(fd), name)
+		}); err != nil {
+			return err
+		}
+		if bindErr != nil {
+			return fmt.Errorf("error binding to device %s: %w", name, bindErr)
+		}
+		return nil
+	}
+}
+
+// udpProbe sends echo requests to the tunnel-controller of the shoot client.
+type udpProbe struct {
+	probeOptions
+	echo func(tunnelControllerIP net.IP, timeout time.Duration) (time.Duration, error)
+}
+
+func (p *udpProbe) Ping(client net.IP) (pingSample, error) {
+	return pingWithRetries(p.log, client, p.retries, p.retryJitter, func() (time.Duration, error) {
+		return p.echo(client, p.timeout)
+	})
+}
+
+// compositePinger runs all probes concurrently. A shoot client is only healthy if all probes succeed.
+type compositePinger []pinger
+
+func (c compositePinger) Ping(client net.IP) (pingSample, error) {
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		sample pingSample
+		errs   []error
+	)
+	for _, p := range c {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s, err := p.Ping(client)
+			s = s.normalize(err)
+
+			mu.Lock()
+			defer mu.Unlock()
+			sample.sent += s.sent
+			sample.lost += s.lost
+			if err != nil {
+				errs = append(errs, err)
+			} else {
+				sample.rtt = max(sample.rtt, s.rtt)
+			}
+		}()
+	}
+	wg.Wait()
+	return sample, errors.Join(errs...)
+}
+
+// Close closes all probes holding resources.
+func (c compositePinger) Close() error {
+	var errs []error
+	for _, p := range c {
+		if closer, ok := p.(io.Closer); ok {
+			errs = append(errs, closer.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func tunnelLinkNameForShootClient(ip net.IP) string {
+	return network.BondIP6TunnelLinkName(network.ClientIndexFromBondingShootClientIP(ip))
+}
@@ -0,0 +1,182 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package pathcontroller
+
+import (
+	"errors"
+	"net"
+	"time"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/gardener/vpn2/pkg/constants"
+	"github.com/gardener/vpn2/pkg/network"
+)
+
+// samplePinger returns a fixed sample.
+type samplePinger struct {
+	sample pingSample
+	err    error
+	closed bool
+}
+
+func (p *samplePinger) Ping(_ net.IP) (pingSample, error) {
+	return p.sample, p.err
+}
+
+func (p *samplePinger) Close() error {
+	p.closed = true
+	return nil
+}
+
+var _ = Describe("#Probes", func() {
+	var (
+		opts   probeOptions
+		client = net.ParseIP("fd8f:6d53:b97a:1::b00:2")
+	)
+
+	BeforeEach(func() {
+		opts = probeOptions{
+			log:     logr.Discard(),
+			timeout: 100 * time.Millisecond,
+			retries: 1,
+		}
+	})
+
+	Describe("#newPinger", func() {
+		It("should create a single probe", func() {
+			p, err := newPinger([]string{ProbeICMP}, opts)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(p).To(BeAssignableToTypeOf(&icmpPinger{}))
+		})
+
+		It("should combine several probes", func() {
+			opts.target = "100.64.0.1:443"
+			p, err := newPinger([]string{ProbeICMP, ProbeTCP, ProbeUDP}, opts)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(p).To(ConsistOf(
+				BeAssignableToTypeOf(&icmpPinger{}),
+				BeAssignableToTypeOf(&tcpProbe{}),
+				BeAssignableToTypeOf(&udpProbe{}),
+			))
+		})
+
+		It("should fail for unknown probe types", func() {
+			_, err := newPinger([]string{ProbeICMP, "http"}, opts)
+			Expect(err).To(MatchError(`unknown probe type "http"`))
+		})
+
+		It("should fail for a tcp probe without target", func() {
+			_, err := newPinger([]string{ProbeTCP}, opts)
+			Expect(err).To(MatchError("error creating tcp probe: tcp probe requires a target"))
+		})
+
+		It("should fail without probe types", func() {
+			_, err := newPinger(nil, opts)
+			Expect(err).To(MatchError("no probe types configured"))
+		})
+	})
+
+	Describe("#tcpProbe", func() {
+		var listener net.Listener
+
+		BeforeEach(func() {
+			var err error
+			listener, err = net.Listen("tcp", "127.0.0.1:0")
+			Expect(err).NotTo(HaveOccurred())
+			DeferCleanup(func() { _ = listener.Close() })
+			opts.target = listener.Addr().String()
+		})
+
+		It("should connect to the target over the link of the client", func() {
+			var linkNames []net.IP
+			probe := &tcpProbe{probeOptions: opts, linkName: func(ip net.IP) string {
+				linkNames = append(linkNames, ip)
+				return ""
+			}}
+			sample, err := probe.Ping(client)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(sample.sent).To(Equal(1))
+			Expect(sample.lost).To(BeZero())
+			Expect(linkNames).To(Equal([]net.IP{client}))
+		})
+
+		It("should retry if the target refuses the connection", func() {
+			Expect(listener.Close()).To(Succeed())
+			probe := &tcpProbe{probeOptions: opts, linkName: func(net.IP) string { return "" }}
+			sample, err := probe.Ping(client)
+			Expect(err).To(MatchError(ContainSubstring("error connecting to " + opts.target)))
+			Expect(sample).To(Equal(pingSample{sent: 2, lost: 2}))
+		})
+
+		It("should name the tunnel link of the client", func() {
+			Expect(tunnelLinkNameForShootClient(client)).To(Equal(network.BondIP6TunnelLinkName(network.ClientIndexFromBondingShootClientIP(client))))
+		})
+	})
+
+	Describe("#udpProbe", func() {
+		It("should send echo requests to the tunnel-controller of the client", func() {
+			var tries int
+			probe := &udpProbe{probeOptions: opts, echo: func(ip net.IP, timeout time.Duration) (time.Duration, error) {
+				Expect(ip).To(Equal(client))
+				Expect(timeout).To(Equal(opts.timeout))
+				tries++
+				if tries == 1 {
+					return 0, errors.New("timeout")
+				}
+				return 3 * time.Millisecond, nil
+			}}
+			sample, err := probe.Ping(client)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(sample).To(Equal(pingSample{rtt: 3 * time.Millisecond, sent: 2, lost: 1}))
+		})
+	})
+
+	Describe("#compositePinger", func() {
+		It("should only succeed if all probes succeed", func() {
+			healthy := &samplePinger{sample: pingSample{rtt: 2 * time.Millisecond, sent: 1}}
+			slow := &samplePinger{sample: pingSample{rtt: 8 * time.Millisecond, sent: 2, lost: 1}}
+			sample, err := compositePinger{healthy, slow}.Ping(client)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(sample).To(Equal(pingSample{rtt: 8 * time.Millisecond, sent: 3, lost: 1}))
+
+			failing := &samplePinger{err: errors.New("connection refused")}
+			sample, err = compositePinger{healthy, failing}.Ping(client)
+			Expect(err).To(MatchError("connection refused"))
+			Expect(sample).To(Equal(pingSample{rtt: 2 * time.Millisecond, sent: 2, lost: 1}))
+		})
+
+		It("should close all probes", func() {
+			p1, p2 := &samplePinger{}, &samplePinger{}
+			Expect(compositePinger{p1, &fakePinger{}, p2}.Close()).To(Succeed())
+			Expect(p1.closed).To(BeTrue())
+			Expect(p2.closed).To(BeTrue())
+		})
+	})
+
+	Describe("#defaultProbeTarget", func() {
+		It("should return the kubernetes service", func() {
+			target, err := defaultProbeTarget(network.ParseIPNetIgnoreError("100.64.0.0/13"), false)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(target).To(Equal("100.64.0.1:443"))
+		})
+
+		It("should map the kubernetes service if the networks overlap", func() {
+			mapped, err := network.NetmapIP("100.64.0.1", constants.ShootServiceNetworkMapped)
+			Expect(err).NotTo(HaveOccurred())
+			target, err := defaultProbeTarget(network.ParseIPNetIgnoreError("100.64.0.0/13"), true)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(target).To(Equal(mapped + ":443"))
+		})
+
+		It("should support IPv6 service networks", func() {
+			target, err := defaultProbeTarget(network.ParseIPNetIgnoreError("2001:db8:1::/108"), true)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(target).To(Equal("[2001:db8:1::1]:443"))
+		})
+	})
+})
@@ -0,0 +1,160 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package pathcontroller
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// DefaultReadinessAddress is the default address of the readiness endpoint of the path-controller.
+const DefaultReadinessAddress = ":15001"
+
+// statePath is the path of the state endpoint of the path-controller served on the log level address.
+const statePath = "/state"
+
+// pingResult is the result of the last ping of a shoot client.
+type pingResult struct {
+	time   time.Time
+	sample pingSample
+	err    error
+}
+
+// routerState is the JSON view of the state of the path-controller served by stateHandler.
+type routerState struct {
+	Ready       bool          `json:"ready"`
+	Reason      string        `json:"reason"`
+	Multipath   bool          `json:"multipath"`
+	Primary     string        `json:"primary,omitempty"`
+	Members     []string      `json:"members,omitempty"`
+	GoodIPs     []string      `json:"goodIPs"`
+	Clients     []clientState `json:"clients"`
+	Routes      []string      `json:"routes"`
+	RoutesError string        `json:"routesError,omitempty"`
+}
+
+// clientState is the state of a shoot client in the routerState.
+type clientState struct {
+	IP       string    `json:"ip"`
+	LastPing time.Time `json:"lastPing"`
+	RTT      string    `json:"rtt"`
+	Lost     int       `json:"lost"`
+	Sent     int       `json:"sent"`
+	Error    string    `json:"error,omitempty"`
+	AvgRTT   string    `json:"avgRTT"`
+	Loss     float64   `json:"loss"`
+	Score    string    `json:"score"`
+}
+
+func (r *clientRouter) newReadinessServer(address string) *http.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, _ *http.Request) {
+		ready, msg := r.isReady()
+		if !ready {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		} else {
+			w.WriteHeader(http.StatusOK)
+		}
+		_, _ = w.Write([]byte(msg))
+	})
+	return &http.Server{
+		Addr:              address,
+		Handler:           mux,
+		ReadHeaderTimeout: 2 * time.Second,
+	}
+}
+
+// stateHandler returns the handler serving the state of the path-controller as JSON. It is not authenticated and must
+// therefore only be served on a loopback address.
+func (r *clientRouter) stateHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(r.state())
+	})
+}
+
+// isReady checks if the shoot networks are routed over a healthy shoot client.
+// It returns a boolean indicating readiness and a message.
+func (r *clientRouter) isReady() (bool, string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.readyLocked()
+}
+
+// readyLocked implements isReady, r.mu must be held.
+// The primary and the members are only set after their routes have been installed.
+func (r *clientRouter) readyLocked() (bool, string) {
+	if r.multipath {
+		if len(r.members) == 0 {
+			return false, "no routes to shoot clients installed"
+		}
+		for _, member := range r.members {
+			if _, ok := r.goodIPs[member.String()]; ok {
+				return true, "ok"
+			}
+		}
+		return false, fmt.Sprintf("shoot clients %v are unhealthy", r.members)
+	}
+	if r.primary == nil {
+		return false, "no primary shoot client selected"
+	}
+	if _, ok := r.goodIPs[r.primary.String()]; !ok {
+		return false, fmt.Sprintf("primary shoot client %s is unhealthy", r.primary)
+	}
+	return true, "ok"
+}
+
+// state returns the current state of the path-controller including the routes installed in the kernel.
+func (r *clientRouter) state() routerState {
+	r.mu.Lock()
+	state := routerState{
+		Multipath: r.multipath,
+		GoodIPs:   []string{},
+		Clients:   []clientState{},
+		Routes:    []string{},
+	}
+	state.Ready, state.Reason = r.readyLocked()
+	if r.primary != nil {
+		state.Primary = r.primary.String()
+	}
+	for _, member := range r.members {
+		state.Members = append(state.Members, member.String())
+	}
+	for ip := range r.goodIPs {
+		state.GoodIPs = append(state.GoodIPs, ip)
+	}
+	for ip, result := range r.lastPings {
+		stats := r.pathStats(ip)
+		client := clientState{
+			IP:       ip,
+			LastPing: result.time,
+			RTT:      result.sample.rtt.String(),
+			Sent:     result.sample.sent,
+			Lost:     result.sample.lost,
+			AvgRTT:   stats.rtt().String(),
+			Loss:     stats.loss(),
+			Score:    stats.score().String(),
+		}
+		if result.err != nil {
+			client.Error = result.err.Error()
+		}
+		state.Clients = append(state.Clients, client)
+	}
+	r.mu.Unlock()
+
+	slices.Sort(state.GoodIPs)
+	slices.SortFunc(state.Clients, func(a, b clientState) int { return strings.Compare(a.IP, b.IP) })
+
+	routes, err := r.netRouter.installedRoutes()
+	if err != nil {
+		state.RoutesError = err.Error()
+	}
+	state.Routes = append(state.Routes, routes...)
+	return state
+}
@@ -0,0 +1,147 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package pathcontroller
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"time"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/vishvananda/netlink"
+
+	"github.com/gardener/vpn2/pkg/events"
+)
+
+// staticRoutesNetRouter returns fixed installed routes.
+type staticRoutesNetRouter struct {
+	noopNetRouter
+	routes []string
+	err    error
+}
+
+func (r staticRoutesNetRouter) installedRoutes() ([]string, error) {
+	return r.routes, r.err
+}
+
+var _ = Describe("#Readiness", func() {
+	var (
+		router *clientRouter
+		pinger *fakePinger
+		ip1    = net.ParseIP("192.168.0.1")
+		ip2    = net.ParseIP("192.168.0.2")
+	)
+
+	BeforeEach(func() {
+		pinger = &fakePinger{badIPs: map[string]struct{}{}}
+		router = &clientRouter{
+			netRouter: staticRoutesNetRouter{routes: []string{"100.64.0.0/13 dev bond0ip6tnl0"}},
+			log:       logr.Discard(),
+			metrics:   newPathMetrics(),
+			recorder:  events.Discard(),
+			pinger:    pinger,
+			goodIPs:   map[string]struct{}{},
+		}
+	})
+
+	get := func(path string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		router.newReadinessServer("").Handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+		return recorder
+	}
+
+	Describe("/readyz", func() {
+		It("should not be ready before a primary is selected", func() {
+			recorder := get("/readyz")
+			Expect(recorder.Code).To(Equal(http.StatusServiceUnavailable))
+			Expect(recorder.Body.String()).To(Equal("no primary shoot client selected"))
+		})
+
+		It("should be ready if the routes point to a healthy primary", func() {
+			router.pingAllShootClients([]net.IP{ip1, ip2})
+			Expect(router.determinePrimaryShootClient()).To(Succeed())
+			recorder := get("/readyz")
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+			Expect(recorder.Body.String()).To(Equal("ok"))
+		})
+
+		It("should not be ready if the primary is unhealthy", func() {
+			router.primary = ip1
+			router.goodIPs[ip2.String()] = struct{}{}
+			recorder := get("/readyz")
+			Expect(recorder.Code).To(Equal(http.StatusServiceUnavailable))
+			Expect(recorder.Body.String()).To(Equal("primary shoot client 192.168.0.1 is unhealthy"))
+		})
+
+		It("should be ready in multipath mode if a member is healthy", func() {
+			router.multipath = true
+			Expect(get("/readyz").Code).To(Equal(http.StatusServiceUnavailable))
+
+			router.members = []net.IP{ip1, ip2}
+			router.goodIPs[ip2.String()] = struct{}{}
+			Expect(get("/readyz").Code).To(Equal(http.StatusOK))
+		})
+
+		It("should not serve the state", func() {
+			Expect(get(statePath).Code).To(Equal(http.StatusNotFound))
+		})
+	})
+
+	Describe("#stateHandler", func() {
+		It("should report the pings, the primary and the installed routes", func() {
+			pinger.badIPs[ip2.String()] = struct{}{}
+			before := time.Now()
+			router.pingAllShootClients([]net.IP{ip2, ip1})
+			Expect(router.determinePrimaryShootClient()).To(Succeed())
+
+			recorder := httptest.NewRecorder()
+			router.stateHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, statePath, nil))
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+			Expect(recorder.Header().Get("Content-Type")).To(Equal("application/json"))
+			var state routerState
+			Expect(json.Unmarshal(recorder.Body.Bytes(), &state)).To(Succeed())
+
+			Expect(state.Ready).To(BeTrue())
+			Expect(state.Primary).To(Equal(ip1.String()))
+			Expect(state.GoodIPs).To(Equal([]string{ip1.String()}))
+			Expect(state.Routes).To(Equal([]string{"100.64.0.0/13 dev bond0ip6tnl0"}))
+			Expect(state.Clients).To(HaveLen(2))
+			Expect(state.Clients[0].IP).To(Equal(ip1.String()))
+			Expect(state.Clients[0].Error).To(BeEmpty())
+			Expect(state.Clients[0].LastPing).To(BeTemporally(">=", before))
+			Expect(state.Clients[1].IP).To(Equal(ip2.String()))
+			Expect(state.Clients[1].Error).To(Equal("unhealthy"))
+			Expect(state.Clients[1].Loss).To(Equal(1.0))
+		})
+
+		It("should report errors listing the routes", func() {
+			router.netRouter = staticRoutesNetRouter{err: errors.New("permission denied")}
+			state := router.state()
+			Expect(state.Ready).To(BeFalse())
+			Expect(state.Routes).To(BeEmpty())
+			Expect(state.RoutesError).To(Equal("permission denied"))
+		})
+	})
+
+	Describe("#describeRoute", func() {
+		_, dst, _ := net.ParseCIDR("100.64.0.0/13")
+		name := func(index int) string { return "bond0ip6tnl" + strconv.Itoa(index) }
+
+		It("should describe a route over a single link", func() {
+			Expect(describeRoute(netlink.Route{Dst: dst, LinkIndex: 1}, name)).To(Equal("100.64.0.0/13 dev bond0ip6tnl1"))
+		})
+
+		It("should describe a multipath route", func() {
+			route := netlink.Route{Dst: dst, MultiPath: []*netlink.NexthopInfo{{LinkIndex: 0}, {LinkIndex: 1}}}
+			Expect(describeRoute(route, name)).To(Equal("100.64.0.0/13 nexthop dev bond0ip6tnl0 nexthop dev bond0ip6tnl1"))
+		})
+	})
+})
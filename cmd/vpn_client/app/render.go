@@ -0,0 +1,88 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package app
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/go-logr/logr"
+	"github.com/spf13/cobra"
+
+	"github.com/gardener/vpn2/pkg/config"
+	"github.com/gardener/vpn2/pkg/network"
+	"github.com/gardener/vpn2/pkg/openvpn"
+	"github.com/gardener/vpn2/pkg/utils"
+	"github.com/gardener/vpn2/pkg/vpn_client"
+)
+
+func renderCommand() *cobra.Command {
+	var file string
+
+	cmd := &cobra.Command{
+		Use:   "render",
+		Short: "print the openvpn config, iptables rules, sysctls and links the " + Name + " would set up without changing the host",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			log, err := utils.InitRun(cmd, Name+"-render")
+			if err != nil {
+				return err
+			}
+			if err := utils.UseFile(file); err != nil {
+				return err
+			}
+			return runRender(cmd.OutOrStdout(), log)
+		},
+	}
+
+	utils.AddFileFlag(cmd, &file, "render")
+	return cmd
+}
+
+func runRender(w io.Writer, log logr.Logger) error {
+	cfg, err := config.GetVPNClientConfig()
+	if err != nil {
+		return err
+	}
+
+	if cfg.AutoMTU {
+		_, _ = fmt.Fprintln(w, "# the tunnel MTU is detected at runtime and therefore not rendered")
+		_, _ = fmt.Fprintln(w)
+	}
+
+	files, err := openvpn.ClientConfigFiles(vpnConfig(log, cfg, 0))
+	if err != nil {
+		return err
+	}
+	utils.WriteFiles(w, files)
+
+	rules, err := vpn_client.IPTableRules(cfg)
+	if err != nil {
+		return err
+	}
+	commands, err := network.FirewallCommands(rules, cfg.FirewallBackend)
+	if err != nil {
+		return err
+	}
+	utils.WriteSection(w, cfg.FirewallBackend, commands)
+
+	settings, err := vpn_client.RenderKernelSettings(log, cfg)
+	if err != nil {
+		return err
+	}
+	utils.WriteSection(w, "sysctl", utils.Strings(settings))
+
+	var links, routes []string
+	if cfg.IsHA {
+		plan, err := vpn_client.PlanBonding(&cfg, 0)
+		if err != nil {
+			return err
+		}
+		links, routes = plan.Links(), plan.Routes()
+	}
+	utils.WriteSection(w, "links", links)
+	utils.WriteSection(w, "routes", routes)
+	return nil
+}
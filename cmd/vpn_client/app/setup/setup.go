@@ -11,6 +11,8 @@ import (
 	"github.com/spf13/cobra"
 
 	"github.com/gardener/vpn2/pkg/config"
+	"github.com/gardener/vpn2/pkg/constants"
+	"github.com/gardener/vpn2/pkg/network"
 	"github.com/gardener/vpn2/pkg/utils"
 	"github.com/gardener/vpn2/pkg/vpn_client"
 )
@@ -18,6 +20,8 @@ import (
 const Name = "setup"
 
 func NewCommand() *cobra.Command {
+	var sysctlStateFile string
+
 	cmd := &cobra.Command{
 		Use:   Name,
 		Short: Name,
@@ -28,14 +32,15 @@ func NewCommand() *cobra.Command {
 				return err
 			}
 			ctx, cancel := context.WithCancel(cmd.Context())
-			return run(ctx, cancel, log)
+			return run(ctx, cancel, log, sysctlStateFile)
 		},
 	}
 
+	cmd.Flags().StringVar(&sysctlStateFile, "sysctl-state-file", constants.SysctlStateFile, "file to record the previous values of changed kernel parameters in for the cleanup subcommand, nothing is recorded if empty")
 	return cmd
 }
 
-func run(ctx context.Context, _ context.CancelFunc, log logr.Logger) error {
+func run(ctx context.Context, _ context.CancelFunc, log logr.Logger, sysctlStateFile string) error {
 	cfg, err := config.GetVPNClientConfig()
 	if err != nil {
 		log.Info("failed to parse config", "error", err)
@@ -43,7 +48,14 @@ func run(ctx context.Context, _ context.CancelFunc, log logr.Logger) error {
 	}
 	log.Info("config parsed", "config", cfg)
 
-	err = vpn_client.KernelSettings(log, cfg)
+	if sysctlStateFile != "" {
+		if err := network.InitSysctlState(sysctlStateFile); err != nil {
+			// the kernel parameters are still set, they are just not restored by the cleanup subcommand
+			log.Info("failed to initialize sysctl state file, previous values of kernel parameters are not recorded", "error", err)
+			sysctlStateFile = ""
+		}
+	}
+	err = vpn_client.KernelSettings(log, cfg, network.HostSysctl(sysctlStateFile))
 	if err != nil {
 		return err
 	}
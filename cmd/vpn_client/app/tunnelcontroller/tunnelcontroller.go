@@ -5,6 +5,7 @@
 package tunnelcontroller
 
 import (
+	"context"
 	"errors"
 	"net/http"
 
@@ -12,6 +13,7 @@ import (
 	"github.com/spf13/cobra"
 
 	"github.com/gardener/vpn2/pkg/config"
+	"github.com/gardener/vpn2/pkg/events"
 	"github.com/gardener/vpn2/pkg/shoot_client/tunnel"
 	"github.com/gardener/vpn2/pkg/utils"
 )
@@ -19,6 +21,8 @@ import (
 const Name = "tunnel-controller"
 
 func NewCommand() *cobra.Command {
+	var logLevelAddress string
+
 	cmd := &cobra.Command{
 		Use:   Name,
 		Short: Name,
@@ -28,10 +32,11 @@ func NewCommand() *cobra.Command {
 			if err != nil {
 				return err
 			}
-			return run(log)
+			return run(cmd.Context(), log, logLevelAddress)
 		},
 	}
 
+	cmd.Flags().StringVar(&logLevelAddress, "log-level-address", utils.DefaultLogLevelAddress, "address of the endpoints to change the log level at runtime and to inspect the state (empty to disable)")
 	return cmd
 }
 
@@ -45,13 +50,24 @@ func runReadinessServer(c *tunnel.Controller, log logr.Logger) {
 	}()
 }
 
-func run(log logr.Logger) error {
+func run(ctx context.Context, log logr.Logger, logLevelAddress string) error {
 	cfg, err := config.GetTunnelControllerConfig(log)
 	if err != nil {
 		return err
 	}
 
-	c := tunnel.NewController(cfg)
+	recorder, stopRecording := events.NewRecorder(log.WithName("events"), Name, events.Pod{
+		Namespace: cfg.Namespace,
+		Name:      cfg.PodName,
+		UID:       cfg.PodUID,
+	})
+	defer stopRecording()
+
+	c := tunnel.NewController(cfg, recorder)
+	if logLevelAddress == "" {
+		log.Info("log level address is empty, not serving the state", "path", tunnel.DebugStatePath)
+	}
+	utils.ServeLogLevel(ctx, log, logLevelAddress, map[string]http.Handler{tunnel.DebugStatePath: c.DebugStateHandler()})
 	runReadinessServer(c, log)
 
 	return c.Run(log)
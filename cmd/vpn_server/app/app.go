@@ -27,6 +27,7 @@ const Name = "vpn-server"
 
 const (
 	metricsPort = 15000
+	healthPort  = 8080
 )
 
 var pprofEnabled bool
@@ -56,37 +57,51 @@ func NewCommand() *cobra.Command {
 	cmd.AddCommand(exporterCommand())
 	cmd.AddCommand(readinessCommand())
 	cmd.AddCommand(livenessCommand())
+	cmd.AddCommand(healthServerCommand())
 	cmd.AddCommand(setup.NewCommand())
+	cmd.AddCommand(cleanupCommand())
+	cmd.AddCommand(utils.NewConfigCommand(Name, config.KindVPNServer))
+	cmd.AddCommand(renderCommand())
+	cmd.AddCommand(reloadCommand())
 	cmd.PersistentFlags().BoolVar(&pprofEnabled, "enable-pprof", false, "enable pprof for profiling")
+	utils.AddLogFlags(cmd.PersistentFlags())
 	return cmd
 }
 
 func run(_ context.Context, log logr.Logger) error {
-	cfg, err := config.GetVPNServerConfig(log)
+	cfg, v, err := serverValues(log)
 	if err != nil {
-		return fmt.Errorf("could not parse environment")
+		return err
 	}
 
-	v, err := vpn_server.BuildValues(cfg)
+	err = vpn_server.SetIPTableRules(log, cfg)
 	if err != nil {
 		return err
 	}
 
-	err = vpn_server.SetIPTableRules(log, cfg)
+	log.Info("writing openvpn config file", "values", v)
+	return openvpn.WriteServerConfigFiles(v)
+}
+
+// serverValues reads the configuration and builds the values of the OpenVPN server configuration from it.
+func serverValues(log logr.Logger) (config.VPNServer, openvpn.SeedServerValues, error) {
+	cfg, err := config.GetVPNServerConfig(log)
 	if err != nil {
-		return err
+		return cfg, openvpn.SeedServerValues{}, fmt.Errorf("could not parse environment: %w", err)
 	}
 
-	tunMTU := 0
+	v, err := vpn_server.BuildValues(cfg)
+	if err != nil {
+		return cfg, v, err
+	}
+	v.Verb = utils.OpenVPNVerbosity()
+
 	if cfg.AutoMTU {
-		tunMTU, err = network.DetectTunnelMTU(constants.TunnelMTUOverhead)
+		v.TunMTU, err = network.DetectTunnelMTU(constants.TunnelMTUOverhead)
 		if err != nil {
-			return fmt.Errorf("failed to detect tunnel MTU: %w", err)
+			return cfg, v, fmt.Errorf("failed to detect tunnel MTU: %w", err)
 		}
-		log.Info("detected tunnel MTU", "MTU", tunMTU)
+		log.Info("detected tunnel MTU", "MTU", v.TunMTU)
 	}
-	v.TunMTU = tunMTU
-
-	log.Info("writing openvpn config file", "values", v)
-	return openvpn.WriteServerConfigFiles(v)
+	return cfg, v, nil
 }
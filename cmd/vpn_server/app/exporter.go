@@ -35,7 +35,7 @@ func exporterCommand() *cobra.Command {
 func runExporter(log logr.Logger) error {
 	cfg, err := config.GetVPNServerConfig(log)
 	if err != nil {
-		return fmt.Errorf("could not parse environment")
+		return fmt.Errorf("could not parse environment: %w", err)
 	}
 	exporterConfig := exporter.NewDefaultConfig()
 	exporterConfig.OpenvpnStatusPaths = cfg.StatusPath
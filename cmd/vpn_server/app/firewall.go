@@ -9,7 +9,6 @@ import (
 	"fmt"
 	"net"
 	"os"
-	"strings"
 
 	"github.com/coreos/go-iptables/iptables"
 	"github.com/go-logr/logr"
@@ -19,6 +18,7 @@ import (
 	"github.com/gardener/vpn2/pkg/constants"
 	"github.com/gardener/vpn2/pkg/network"
 	"github.com/gardener/vpn2/pkg/utils"
+	"github.com/gardener/vpn2/pkg/vpn_server"
 )
 
 func firewallCommand() *cobra.Command {
@@ -27,6 +27,7 @@ func firewallCommand() *cobra.Command {
 		mode           string
 		shootNetworks  []string
 		seedPodNetwork string
+		backend        string
 	)
 
 	cmd := &cobra.Command{
@@ -38,7 +39,7 @@ func firewallCommand() *cobra.Command {
 			if err != nil {
 				return err
 			}
-			return runFirewallCommand(log, device, mode, shootNetworks, seedPodNetwork)
+			return runFirewallCommand(log, device, mode, shootNetworks, seedPodNetwork, backend)
 		},
 	}
 
@@ -46,66 +47,51 @@ func firewallCommand() *cobra.Command {
 	cmd.Flags().StringVar(&mode, "mode", "", "mode of firewall (up or down)")
 	cmd.Flags().StringSliceVar(&shootNetworks, "shoot-network", nil, "shoot networks to add routes for")
 	cmd.Flags().StringVar(&seedPodNetwork, "seed-pod-network", "", "seed pod network to add double-nat mapping rules for (IPv4 only)")
+	cmd.Flags().StringVar(&backend, "backend", constants.FirewallBackendIPTables, fmt.Sprintf("firewall backend to use (one of %v)", constants.FirewallBackends))
 	cmd.MarkFlagsRequiredTogether("device", "mode")
 
 	return cmd
 }
 
-func runFirewallCommand(log logr.Logger, device, mode string, networks []string, seedPodNetwork string) error {
+// firewallRules generates the rules blocking all traffic originating from the shoot cluster.
+func firewallRules(device, seedPodNetwork string) *network.RuleSet {
+	rules := network.NewRuleSet(vpn_server.FirewallIPTablesOwner)
+	for _, spec := range [][]string{
+		{"-m", "state", "--state", "RELATED,ESTABLISHED", "-i", device, "-j", "ACCEPT"},
+		{"-i", device, "-j", "DROP"},
+	} {
+		rules.Add(iptables.ProtocolIPv4, "filter", "INPUT", spec...)
+		rules.Add(iptables.ProtocolIPv6, "filter", "INPUT", spec...)
+	}
+
+	if device == constants.TunnelDevice {
+		cidr, err := network.ParseIPNet(seedPodNetwork)
+		if err == nil && cidr.IsIPv4() {
+			rules.Add(iptables.ProtocolIPv4, "nat", "PREROUTING", "--in-interface", device, "-d", constants.SeedPodNetworkMapped, "-j", "NETMAP", "--to", seedPodNetwork)
+			rules.Add(iptables.ProtocolIPv4, "nat", "POSTROUTING", "--out-interface", device, "-s", seedPodNetwork, "-j", "NETMAP", "--to", constants.SeedPodNetworkMapped)
+		}
+	}
+	return rules
+}
+
+func runFirewallCommand(log logr.Logger, device, mode string, networks []string, seedPodNetwork, backend string) error {
 	// Firewall subcommand is called indirectly from openvpn. As PATH env variables seems not to be set,
 	// it is injected here.
 	if err := os.Setenv("PATH", "/sbin"); err != nil {
 		return fmt.Errorf("setting PATH environment variable failed: %w", err)
 	}
-	iptable4, err := network.NewIPTables(log, iptables.ProtocolIPv4)
-	if err != nil {
-		return err
-	}
-	iptable6, err := network.NewIPTables(log, iptables.ProtocolIPv6)
-	if err != nil {
-		return err
-	}
-
-	var op4, op6 func(table, chain string, spec ...string) error
-	var opName string
+	var rules *network.RuleSet
 	switch mode {
 	case "up":
-		op4 = iptable4.Append
-		op6 = iptable6.Append
-		opName = "-A"
+		rules = firewallRules(device, seedPodNetwork)
 	case "down":
-		op4 = iptable4.DeleteIfExists
-		op6 = iptable6.DeleteIfExists
-		opName = "-D"
+		// an empty rule set removes all firewall chains
+		rules = network.NewRuleSet(vpn_server.FirewallIPTablesOwner)
 	default:
 		return errors.New("mode flag must be down or up")
 	}
-
-	for _, spec := range [][]string{
-		{"-m", "state", "--state", "RELATED,ESTABLISHED", "-i", device, "-j", "ACCEPT"},
-		{"-i", device, "-j", "DROP"},
-	} {
-		if err := op4("filter", "INPUT", spec...); err != nil {
-			return err
-		}
-		if err := op6("filter", "INPUT", spec...); err != nil {
-			return err
-		}
-		log.Info(fmt.Sprintf("iptables %s INPUT %s", opName, strings.Join(spec, " ")))
-	}
-
-	if device == constants.TunnelDevice {
-		cidr, err := network.ParseIPNet(seedPodNetwork)
-		if err == nil && cidr.IsIPv4() {
-			err = op4("nat", "PREROUTING", "--in-interface", device, "-d", constants.SeedPodNetworkMapped, "-j", "NETMAP", "--to", seedPodNetwork)
-			if err != nil {
-				return err
-			}
-			err = op4("nat", "POSTROUTING", "--out-interface", device, "-s", seedPodNetwork, "-j", "NETMAP", "--to", constants.SeedPodNetworkMapped)
-			if err != nil {
-				return err
-			}
-		}
+	if err := network.ReconcileFirewall(log, rules, backend); err != nil {
+		return err
 	}
 
 	if mode == "up" {
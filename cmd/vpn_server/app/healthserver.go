@@ -0,0 +1,73 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/spf13/cobra"
+
+	"github.com/gardener/vpn2/pkg/config"
+	"github.com/gardener/vpn2/pkg/openvpn/health"
+	"github.com/gardener/vpn2/pkg/utils"
+)
+
+func healthServerCommand() *cobra.Command {
+	var (
+		port     int
+		cacheTTL time.Duration
+	)
+
+	cmd := &cobra.Command{
+		Use:   "health-server",
+		Short: "serve the liveness and readiness of the openvpn server on /livez, /readyz and /healthz",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			log, err := utils.InitRun(cmd, Name+"-health-server")
+			if err != nil {
+				return err
+			}
+			return runHealthServer(cmd.Context(), log, port, cacheTTL)
+		},
+	}
+
+	cmd.Flags().IntVar(&port, "port", healthPort, "port of the health server")
+	cmd.Flags().DurationVar(&cacheTTL, "cache-ttl", 2*time.Second, "duration for which check results are reused")
+	return cmd
+}
+
+func runHealthServer(ctx context.Context, log logr.Logger, port int, cacheTTL time.Duration) error {
+	cfg, err := config.GetVPNServerConfig(log)
+	if err != nil {
+		return fmt.Errorf("could not parse environment: %w", err)
+	}
+	healthCfg := health.NewDefaultConfig()
+	healthCfg.OpenVPNStatusPath = cfg.StatusPath
+	healthCfg.IsHA = cfg.IsHA
+	healthCfg.ManagementAddress = fmt.Sprintf("127.0.0.1:%d", cfg.ManagementPort)
+
+	server := &http.Server{
+		Addr:              fmt.Sprintf(":%d", port),
+		Handler:           health.NewServer(log, healthCfg, cacheTTL).Handler(),
+		ReadHeaderTimeout: 2 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = server.Shutdown(shutdownCtx)
+	}()
+
+	log.Info("starting health server", "port", port, "cacheTTL", cacheTTL)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
@@ -36,11 +36,12 @@ func readinessCommand() *cobra.Command {
 func runReadiness(log logr.Logger) error {
 	cfg, err := config.GetVPNServerConfig(log)
 	if err != nil {
-		return fmt.Errorf("could not parse environment")
+		return fmt.Errorf("could not parse environment: %w", err)
 	}
 	healthCfg := health.NewDefaultConfig()
 	healthCfg.OpenVPNStatusPath = cfg.StatusPath
 	healthCfg.IsHA = cfg.IsHA
+	healthCfg.ManagementAddress = fmt.Sprintf("127.0.0.1:%d", cfg.ManagementPort)
 
 	if !health.IsReady(healthCfg, log) {
 		os.Exit(1)
@@ -0,0 +1,158 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package app
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/spf13/cobra"
+	"github.com/vishvananda/netlink"
+
+	"github.com/gardener/vpn2/pkg/config"
+	"github.com/gardener/vpn2/pkg/network"
+	"github.com/gardener/vpn2/pkg/openvpn"
+	"github.com/gardener/vpn2/pkg/utils"
+	"github.com/gardener/vpn2/pkg/vpn_server"
+)
+
+func reloadCommand() *cobra.Command {
+	var interval time.Duration
+
+	cmd := &cobra.Command{
+		Use:   "reload",
+		Short: "watch the configuration file and apply changes of the shoot networks to the running openvpn server",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			log, err := utils.InitRun(cmd, Name+"-reload")
+			if err != nil {
+				return err
+			}
+			return runReload(cmd.Context(), log, interval)
+		},
+	}
+
+	cmd.Flags().DurationVar(&interval, "interval", 10*time.Second, "interval for checking the configuration file for changes")
+	return cmd
+}
+
+// reloadableFields are the fields of the configuration file whose changes are applied without restarting openvpn.
+var reloadableFields = []string{"shootServiceNetworks", "shootPodNetworks", "shootNodeNetworks"}
+
+func runReload(ctx context.Context, log logr.Logger, interval time.Duration) error {
+	file := os.Getenv(config.FileEnvVar)
+	if file == "" {
+		return fmt.Errorf("%s must point to the mounted configuration file", config.FileEnvVar)
+	}
+	// environment variables take precedence over the file, so changes of these fields in the file would be ignored
+	if overrides := config.EnvOverrides(&config.VPNServer{}, reloadableFields...); len(overrides) > 0 {
+		return fmt.Errorf("%s must be set in the configuration file instead of the environment to be reloaded",
+			strings.Join(overrides, ", "))
+	}
+	content, err := os.ReadFile(file) // #nosec: G304 -- path is provided by the operator
+	if err != nil {
+		return fmt.Errorf("failed to read configuration file: %w", err)
+	}
+	// the configuration may have changed since openvpn has been started, e.g. while the reload sidecar was restarting
+	current, pending, err := reconcile(log)
+	if err != nil {
+		return err
+	}
+
+	log.Info("watching configuration file for changes", "file", file, "interval", interval)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	// pending are the clients which still need to reconnect to pick up their new configuration
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		next, err := os.ReadFile(file) // #nosec: G304 -- path is provided by the operator
+		if err != nil {
+			log.Error(err, "failed to read configuration file")
+		} else if !bytes.Equal(next, content) {
+			log.Info("configuration file changed, reloading")
+			desired, reconnect, err := reload(log, current)
+			if err != nil {
+				log.Error(err, "failed to reload configuration, retrying")
+			} else {
+				content = next
+				current = desired
+				pending = slices.Compact(slices.Sorted(slices.Values(append(pending, reconnect...))))
+			}
+		}
+
+		if len(pending) > 0 {
+			address := fmt.Sprintf("127.0.0.1:%d", current.ManagementPort)
+			if pending, err = vpn_server.DisconnectClients(log, address, pending, vpn_server.DefaultDisconnectBackoff); err != nil {
+				log.Error(err, "failed to disconnect clients, retrying", "pending", pending)
+			}
+		}
+	}
+}
+
+// reload applies the configuration to the host of the openvpn server configured with the current values. It returns
+// the applied values and the common names of the clients which need to reconnect. The VPN-FIREWALL rules are left to
+// the firewall script run by openvpn, as they do not depend on the shoot networks.
+func reload(log logr.Logger, current openvpn.SeedServerValues) (openvpn.SeedServerValues, []string, error) {
+	cfg, desired, err := serverValues(log)
+	if err != nil {
+		return current, nil, err
+	}
+	plan, err := vpn_server.PlanReload(current, desired)
+	if err != nil {
+		return current, nil, err
+	}
+	if len(plan.RestartRequired) > 0 {
+		log.Info("changed settings only take effect after restarting openvpn", "settings", plan.RestartRequired)
+	}
+	log.Info("applying configuration", "addedRoutes", plan.AddedRoutes, "removedRoutes", plan.RemovedRoutes, "reconnect", plan.Reconnect)
+	if err := vpn_server.ApplyReload(log, cfg, desired, plan); err != nil {
+		return current, nil, err
+	}
+	return desired, plan.Reconnect, nil
+}
+
+// reconcile applies the configuration to the host as it is found: the client-config-dir files on disk and the routes
+// on the tunnel device. It returns the applied values and the common names of the clients which need to reconnect.
+func reconcile(log logr.Logger) (openvpn.SeedServerValues, []string, error) {
+	cfg, desired, err := serverValues(log)
+	if err != nil {
+		return desired, nil, err
+	}
+	applied, err := openvpn.ReadServerConfigFiles(desired)
+	if err != nil {
+		return desired, nil, fmt.Errorf("failed to read configuration files: %w", err)
+	}
+	dev, err := netlink.LinkByName(desired.Device)
+	if err != nil {
+		return desired, nil, fmt.Errorf("failed to get link %s: %w", desired.Device, err)
+	}
+	routed, err := network.RoutedNetworks(dev)
+	if err != nil {
+		return desired, nil, err
+	}
+	plan, err := vpn_server.PlanStartup(desired, applied, routed)
+	if err != nil {
+		return desired, nil, err
+	}
+	if len(plan.RestartRequired) > 0 {
+		log.Info("changed files only take effect after restarting openvpn", "files", plan.RestartRequired)
+	}
+	log.Info("reconciling configuration", "addedRoutes", plan.AddedRoutes, "removedRoutes", plan.RemovedRoutes, "reconnect", plan.Reconnect)
+	if err := vpn_server.ApplyReload(log, cfg, desired, plan); err != nil {
+		return desired, nil, err
+	}
+	return desired, plan.Reconnect, nil
+}
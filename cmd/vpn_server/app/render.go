@@ -0,0 +1,90 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package app
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/go-logr/logr"
+	"github.com/spf13/cobra"
+
+	"github.com/gardener/vpn2/pkg/config"
+	"github.com/gardener/vpn2/pkg/network"
+	"github.com/gardener/vpn2/pkg/openvpn"
+	"github.com/gardener/vpn2/pkg/utils"
+	"github.com/gardener/vpn2/pkg/vpn_client"
+	"github.com/gardener/vpn2/pkg/vpn_server"
+)
+
+func renderCommand() *cobra.Command {
+	var file string
+
+	cmd := &cobra.Command{
+		Use:   "render",
+		Short: "print the openvpn config, client-config-dir files, iptables rules and sysctls the " + Name + " would set up without changing the host",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			log, err := utils.InitRun(cmd, Name+"-render")
+			if err != nil {
+				return err
+			}
+			if err := utils.UseFile(file); err != nil {
+				return err
+			}
+			return runRender(cmd.OutOrStdout(), log)
+		},
+	}
+
+	utils.AddFileFlag(cmd, &file, "render")
+	return cmd
+}
+
+func runRender(w io.Writer, log logr.Logger) error {
+	cfg, err := config.GetVPNServerConfig(log)
+	if err != nil {
+		return err
+	}
+
+	v, err := vpn_server.BuildValues(cfg)
+	if err != nil {
+		return err
+	}
+	v.Verb = utils.OpenVPNVerbosity()
+
+	if cfg.AutoMTU {
+		_, _ = fmt.Fprintln(w, "# the tunnel MTU is detected at runtime and therefore not rendered")
+		_, _ = fmt.Fprintln(w)
+	}
+
+	files, err := openvpn.ServerConfigFiles(v)
+	if err != nil {
+		return err
+	}
+	utils.WriteFiles(w, files)
+
+	rules, err := vpn_server.IPTableRules(cfg)
+	if err != nil {
+		return err
+	}
+	commands, err := network.FirewallCommands(rules, cfg.FirewallBackend)
+	if err != nil {
+		return err
+	}
+	utils.WriteSection(w, cfg.FirewallBackend, commands)
+	commands, err = network.FirewallCommands(firewallRules(v.Device, v.SeedPodNetwork.String()), cfg.FirewallBackend)
+	if err != nil {
+		return err
+	}
+	utils.WriteSection(w, cfg.FirewallBackend+" (firewall up)", commands)
+
+	// sysctls set by the setup init container
+	settings, err := vpn_client.RenderEnableIPv6Networking(log)
+	if err != nil {
+		return err
+	}
+	utils.WriteSection(w, "sysctl", utils.Strings(settings))
+	return nil
+}
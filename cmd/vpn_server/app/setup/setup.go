@@ -10,6 +10,8 @@ import (
 	"github.com/go-logr/logr"
 	"github.com/spf13/cobra"
 
+	"github.com/gardener/vpn2/pkg/constants"
+	"github.com/gardener/vpn2/pkg/network"
 	"github.com/gardener/vpn2/pkg/utils"
 	"github.com/gardener/vpn2/pkg/vpn_client"
 )
@@ -17,6 +19,8 @@ import (
 const Name = "setup"
 
 func NewCommand() *cobra.Command {
+	var sysctlStateFile string
+
 	cmd := &cobra.Command{
 		Use:   Name,
 		Short: Name,
@@ -27,13 +31,21 @@ func NewCommand() *cobra.Command {
 				return err
 			}
 			ctx, cancel := context.WithCancel(cmd.Context())
-			return run(ctx, cancel, log)
+			return run(ctx, cancel, log, sysctlStateFile)
 		},
 	}
 
+	cmd.Flags().StringVar(&sysctlStateFile, "sysctl-state-file", constants.SysctlStateFile, "file to record the previous values of changed kernel parameters in for the cleanup subcommand, nothing is recorded if empty")
 	return cmd
 }
 
-func run(_ context.Context, _ context.CancelFunc, log logr.Logger) error {
-	return vpn_client.EnableIPv6Networking(log)
+func run(_ context.Context, _ context.CancelFunc, log logr.Logger, sysctlStateFile string) error {
+	if sysctlStateFile != "" {
+		if err := network.InitSysctlState(sysctlStateFile); err != nil {
+			// the kernel parameters are still set, they are just not restored by the cleanup subcommand
+			log.Info("failed to initialize sysctl state file, previous values of kernel parameters are not recorded", "error", err)
+			sysctlStateFile = ""
+		}
+	}
+	return vpn_client.EnableIPv6Networking(log, network.HostSysctl(sysctlStateFile))
 }
@@ -0,0 +1,185 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/caarlos0/env/v11"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// FileEnvVar is the environment variable pointing to an optional configuration file.
+	FileEnvVar = "CONFIG_FILE"
+	// APIVersion is the version of the configuration file format.
+	APIVersion = "vpn.gardener.cloud/v1alpha1"
+
+	// KindVPNClient is the kind of the vpn-client configuration file.
+	KindVPNClient = "VPNClientConfiguration"
+	// KindVPNServer is the kind of the vpn-server configuration file.
+	KindVPNServer = "VPNServerConfiguration"
+	// KindPathController is the kind of the path-controller configuration file.
+	KindPathController = "PathControllerConfiguration"
+	// KindTunnelController is the kind of the tunnel-controller configuration file.
+	KindTunnelController = "TunnelControllerConfiguration"
+)
+
+// parse fills cfg from the configuration file referenced by FileEnvVar (if any) and the environment.
+// Non-empty environment variables take precedence over values from the file.
+// Errors are collected, so that all problems are reported at once.
+func parse(kind string, cfg any) error {
+	environ := env.ToMap(os.Environ())
+	fileEnviron, fileErr := readFile(environ[FileEnvVar], kind, cfg)
+	for key, value := range environ {
+		if _, ok := fileEnviron[key]; ok && value == "" {
+			continue
+		}
+		fileEnviron[key] = value
+	}
+	return errors.Join(fileErr, env.ParseWithOptions(cfg, env.Options{Environment: fileEnviron}))
+}
+
+// EnvOverrides returns the environment variables of the fields of cfg with the given json names which are set to a
+// non-empty value, i.e. which take precedence over the values of the configuration file.
+func EnvOverrides(cfg any, fieldNames ...string) []string {
+	envKeys := envKeysByFieldName(cfg)
+	var overrides []string
+	for _, name := range fieldNames {
+		if envKey, ok := envKeys[name]; ok && os.Getenv(envKey) != "" {
+			overrides = append(overrides, envKey)
+		}
+	}
+	return overrides
+}
+
+// readFile reads the configuration file at path and translates its fields to the environment variables of cfg.
+func readFile(path, kind string, cfg any) (map[string]string, error) {
+	environ := map[string]string{}
+	if path == "" {
+		return environ, nil
+	}
+
+	values, err := readValues(path)
+	if err != nil {
+		return environ, err
+	}
+
+	var errs []error
+	if apiVersion := values["apiVersion"]; apiVersion != APIVersion {
+		errs = append(errs, fmt.Errorf("%s: unsupported apiVersion %v, expected %s", path, apiVersion, APIVersion))
+	}
+	if fileKind := values["kind"]; fileKind != kind {
+		errs = append(errs, fmt.Errorf("%s: unexpected kind %v, expected %s", path, fileKind, kind))
+	}
+	delete(values, "apiVersion")
+	delete(values, "kind")
+
+	envKeys := envKeysByFieldName(cfg)
+	for _, name := range slices.Sorted(maps.Keys(values)) {
+		envKey, ok := envKeys[name]
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: unknown field %q", path, name))
+			continue
+		}
+		value, err := toEnvValue(values[name])
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: field %q: %w", path, name, err))
+			continue
+		}
+		environ[envKey] = value
+	}
+	return environ, errors.Join(errs...)
+}
+
+// ReadKind returns the kind of the configuration file at path.
+func ReadKind(path string) (string, error) {
+	values, err := readValues(path)
+	if err != nil {
+		return "", err
+	}
+	kind, ok := values["kind"].(string)
+	if !ok || kind == "" {
+		return "", fmt.Errorf("%s: kind is not set", path)
+	}
+	return kind, nil
+}
+
+// readValues reads a YAML or JSON configuration file as flat map.
+func readValues(path string) (map[string]any, error) {
+	data, err := os.ReadFile(path) // #nosec: G304 -- path is provided by the operator of the component.
+	if err != nil {
+		return nil, fmt.Errorf("failed to read configuration file: %w", err)
+	}
+	jsonData, err := yaml.YAMLToJSON(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: failed to parse configuration file: %w", path, err)
+	}
+	values := map[string]any{}
+	decoder := json.NewDecoder(bytes.NewReader(jsonData))
+	// keep numbers as they are written, e.g. to avoid "1e+06" for large integers
+	decoder.UseNumber()
+	if err := decoder.Decode(&values); err != nil {
+		return nil, fmt.Errorf("%s: configuration file must contain an object: %w", path, err)
+	}
+	return values, nil
+}
+
+// envKeysByFieldName maps the json field names of cfg to the corresponding environment variables.
+func envKeysByFieldName(cfg any) map[string]string {
+	keys := map[string]string{}
+	t := reflect.TypeOf(cfg)
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	for i := range t.NumField() {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		envKey, _, _ := strings.Cut(field.Tag.Get("env"), ",")
+		if name == "" || name == "-" || envKey == "" {
+			continue
+		}
+		keys[name] = envKey
+	}
+	return keys
+}
+
+// toEnvValue converts a value of the configuration file to the string representation used in environment variables.
+func toEnvValue(value any) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case json.Number:
+		return v.String(), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case []any:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			if _, ok := item.([]any); ok {
+				return "", fmt.Errorf("nested lists are not supported")
+			}
+			s, err := toEnvValue(item)
+			if err != nil {
+				return "", err
+			}
+			items = append(items, s)
+		}
+		return strings.Join(items, ","), nil
+	default:
+		return "", fmt.Errorf("unsupported value of type %T", value)
+	}
+}
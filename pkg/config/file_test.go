@@ -0,0 +1,221 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package config_test
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/gardener/vpn2/pkg/config"
+	"github.com/gardener/vpn2/pkg/network"
+)
+
+var _ = Describe("Configuration file", func() {
+	var path string
+
+	writeFile := func(content string) {
+		Expect(os.WriteFile(path, []byte(content), 0o600)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		path = filepath.Join(GinkgoT().TempDir(), "config.yaml")
+		Expect(os.Setenv(config.FileEnvVar, path)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		Expect(os.Unsetenv(config.FileEnvVar)).To(Succeed())
+		Expect(os.Unsetenv("ENDPOINT")).To(Succeed())
+		Expect(os.Unsetenv("WAIT_TIME")).To(Succeed())
+		Expect(os.Unsetenv("IS_HA")).To(Succeed())
+	})
+
+	It("should read the vpn-client configuration from the file", func() {
+		writeFile(`apiVersion: vpn.gardener.cloud/v1alpha1
+kind: VPNClientConfiguration
+ipFamilies: [IPv6, IPv4]
+endpoint: from-file
+shootPodNetworks:
+- 100.96.0.0/11
+- 100.97.0.0/16
+isShootClient: true
+podName: vpn-shoot-1
+waitTime: 5s
+`)
+		cfg, err := config.GetVPNClientConfig()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cfg.IPFamilies).To(Equal([]string{"IPv4", "IPv6"}))
+		Expect(cfg.Endpoint).To(Equal("from-file"))
+		Expect(cfg.ShootPodNetworks).To(ConsistOf(
+			network.ParseIPNetIgnoreError("100.96.0.0/11"),
+			network.ParseIPNetIgnoreError("100.97.0.0/16"),
+		))
+		Expect(cfg.WaitTime).To(Equal(5 * time.Second))
+		Expect(cfg.VPNClientIndex).To(Equal(1))
+		// defaults still apply for fields missing in the file
+		Expect(cfg.OpenVPNPort).To(Equal(uint(8132)))
+	})
+
+	It("should reject the vpn-client index, as it is derived from the pod name", func() {
+		writeFile(`{"apiVersion": "vpn.gardener.cloud/v1alpha1", "kind": "VPNClientConfiguration", "podName": "vpn-shoot-1", "vpnClientIndex": 2}`)
+		_, err := config.GetVPNClientConfig()
+		Expect(err).To(MatchError(ContainSubstring(`unknown field "vpnClientIndex"`)))
+	})
+
+	It("should read a JSON file", func() {
+		writeFile(`{"apiVersion": "vpn.gardener.cloud/v1alpha1", "kind": "TunnelControllerConfiguration", "watchdogThreshold": 5}`)
+		cfg, err := config.GetTunnelControllerConfig(logr.Discard())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cfg.WatchdogThreshold).To(Equal(5))
+		Expect(cfg.WatchdogWindowSize).To(Equal(config.DefaultTunnelControllerConfig.WatchdogWindowSize))
+		Expect(cfg.WatchdogEscalation).To(Equal([]string{"SIGUSR1", "SIGHUP", "SIGTERM"}))
+	})
+
+	It("should reject an unsupported signal in the watchdog escalation", func() {
+		writeFile(`{"apiVersion": "vpn.gardener.cloud/v1alpha1", "kind": "TunnelControllerConfiguration", "watchdogEscalation": ["SIGHUP", "SIGKILL"]}`)
+		_, err := config.GetTunnelControllerConfig(logr.Discard())
+		Expect(err).To(MatchError(`WATCHDOG_ESCALATION contains unsupported signal "SIGKILL", must be one of [SIGUSR1 SIGHUP SIGTERM]`))
+	})
+
+	It("should read the time-based watchdog and its action", func() {
+		writeFile(`{"apiVersion": "vpn.gardener.cloud/v1alpha1", "kind": "TunnelControllerConfiguration", "watchdogWindow": "30s", "watchdogFailureRatio": 0.8, "watchdogAction": "exit"}`)
+		cfg, err := config.GetTunnelControllerConfig(logr.Discard())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cfg.WatchdogWindow).To(Equal(30 * time.Second))
+		Expect(cfg.WatchdogFailureRatio).To(Equal(0.8))
+		Expect(cfg.WatchdogCooldownPeriod).To(Equal(config.DefaultTunnelControllerConfig.WatchdogCooldownPeriod))
+		Expect(cfg.WatchdogAction).To(Equal("exit"))
+	})
+
+	It("should reject an unsupported watchdog action", func() {
+		writeFile(`{"apiVersion": "vpn.gardener.cloud/v1alpha1", "kind": "TunnelControllerConfiguration", "watchdogAction": "reboot"}`)
+		_, err := config.GetTunnelControllerConfig(logr.Discard())
+		Expect(err).To(MatchError(`WATCHDOG_ACTION must be one of [restart exit], but is set to "reboot"`))
+	})
+
+	It("should reject an invalid watchdog failure ratio", func() {
+		writeFile(`{"apiVersion": "vpn.gardener.cloud/v1alpha1", "kind": "TunnelControllerConfiguration", "watchdogFailureRatio": 1.5}`)
+		_, err := config.GetTunnelControllerConfig(logr.Discard())
+		Expect(err).To(MatchError("WATCHDOG_FAILURE_RATIO must be > 0 and <= 1, got 1.5"))
+	})
+
+	It("should report all invalid tunnel-controller settings at once", func() {
+		writeFile(`{"apiVersion": "vpn.gardener.cloud/v1alpha1", "kind": "TunnelControllerConfiguration", "registrationExpiry": "-1s", "watchdogEscalation": ["SIGKILL"], "watchdogFailureRatio": 2, "watchdogAction": "reboot"}`)
+		cfg, err := config.GetTunnelControllerConfig(logr.Discard())
+		Expect(cfg).To(BeNil())
+		Expect(err).To(MatchError(And(
+			ContainSubstring("REGISTRATION_EXPIRY must be > 0, got -1s"),
+			ContainSubstring(`WATCHDOG_ESCALATION contains unsupported signal "SIGKILL"`),
+			ContainSubstring("WATCHDOG_FAILURE_RATIO must be > 0 and <= 1, got 2"),
+			ContainSubstring(`WATCHDOG_ACTION must be one of [restart exit], but is set to "reboot"`),
+		)))
+	})
+
+	It("should let non-empty environment variables override the file", func() {
+		writeFile(`apiVersion: vpn.gardener.cloud/v1alpha1
+kind: VPNClientConfiguration
+endpoint: from-file
+waitTime: 5s
+`)
+		Expect(os.Setenv("ENDPOINT", "from-env")).To(Succeed())
+		Expect(os.Setenv("WAIT_TIME", "")).To(Succeed())
+		cfg, err := config.GetVPNClientConfig()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cfg.Endpoint).To(Equal("from-env"))
+		Expect(cfg.WaitTime).To(Equal(5 * time.Second))
+	})
+
+	It("should report the environment variables overriding fields of the file", func() {
+		Expect(config.EnvOverrides(&config.VPNServer{}, "shootPodNetworks", "shootNodeNetworks")).To(BeEmpty())
+
+		GinkgoT().Setenv("SHOOT_NODE_NETWORKS", "10.250.0.0/16")
+		GinkgoT().Setenv("SHOOT_POD_NETWORKS", "")
+		Expect(config.EnvOverrides(&config.VPNServer{}, "shootPodNetworks", "shootNodeNetworks", "unknown")).To(Equal([]string{"SHOOT_NODE_NETWORKS"}))
+	})
+
+	It("should reject unknown fields, wrong kinds and unsupported versions", func() {
+		writeFile(`apiVersion: vpn.gardener.cloud/v1
+kind: VPNServerConfiguration
+endpont: typo
+`)
+		_, err := config.GetVPNClientConfig()
+		Expect(config.Errors(err)).To(ConsistOf(
+			MatchError(ContainSubstring("unsupported apiVersion")),
+			MatchError(ContainSubstring("unexpected kind")),
+			MatchError(ContainSubstring(`unknown field "endpont"`)),
+		))
+	})
+
+	It("should read the probe timeout and retries of the path-controller", func() {
+		writeFile(`{"apiVersion": "vpn.gardener.cloud/v1alpha1", "kind": "PathControllerConfiguration", "pathProbeTimeout": "500ms", "pathProbeRetries": 2}`)
+		cfg, err := config.GetPathControllerConfig(logr.Discard())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cfg.PathProbeTimeout).To(Equal(500 * time.Millisecond))
+		Expect(cfg.PathProbeRetries).To(Equal(2))
+	})
+
+	It("should default the probe timeout and retries of the path-controller", func() {
+		writeFile(`{"apiVersion": "vpn.gardener.cloud/v1alpha1", "kind": "PathControllerConfiguration"}`)
+		cfg, err := config.GetPathControllerConfig(logr.Discard())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cfg.PathProbeTimeout).To(Equal(500 * time.Millisecond))
+		Expect(cfg.PathProbeRetries).To(Equal(2))
+	})
+
+	It("should reject an invalid probe timeout and retries of the path-controller", func() {
+		writeFile(`{"apiVersion": "vpn.gardener.cloud/v1alpha1", "kind": "PathControllerConfiguration", "pathProbeTimeout": "0s", "pathProbeRetries": -1}`)
+		_, err := config.GetPathControllerConfig(logr.Discard())
+		Expect(err).To(MatchError(And(
+			ContainSubstring("PATH_PROBE_TIMEOUT must be > 0, got 0s"),
+			ContainSubstring("PATH_PROBE_RETRIES must be >= 0, got -1"),
+		)))
+	})
+
+	It("should reject probe timeout and retries of the path-controller exceeding the update interval", func() {
+		writeFile(`{"apiVersion": "vpn.gardener.cloud/v1alpha1", "kind": "PathControllerConfiguration", "pathProbeTimeout": "1s", "pathProbeRetries": 9}`)
+		_, err := config.GetPathControllerConfig(logr.Discard())
+		Expect(err).To(MatchError(ContainSubstring("PATH_PROBE_TIMEOUT * (PATH_PROBE_RETRIES + 1) must be <= 2s, got 10s")))
+	})
+
+	It("should report a missing file", func() {
+		_, err := config.GetPathControllerConfig(logr.Discard())
+		Expect(err).To(MatchError(ContainSubstring("failed to read configuration file")))
+	})
+
+	It("should read the kind of a file", func() {
+		writeFile(`apiVersion: vpn.gardener.cloud/v1alpha1
+kind: PathControllerConfiguration
+`)
+		Expect(config.ReadKind(path)).To(Equal(config.KindPathController))
+	})
+
+	Describe("#Validate", func() {
+		It("should return all errors at once", func() {
+			writeFile(`apiVersion: vpn.gardener.cloud/v1alpha1
+kind: VPNClientConfiguration
+ipFamilies: [IPv4, IPv7]
+isShootClient: true
+haVPNClients: 2
+waitTime: -1s
+`)
+			Expect(os.Setenv("IS_HA", "true")).To(Succeed())
+			errs := config.Errors(config.Validate(logr.Discard(), config.KindVPNClient))
+			Expect(errs).To(ConsistOf(
+				MatchError(ContainSubstring("POD_NAME is not set")),
+				MatchError(ContainSubstring("HA_VPN_SERVERS is set to 0")),
+				MatchError(ContainSubstring(`found value "IPv7"`)),
+				MatchError(ContainSubstring("WAIT_TIME must not be negative")),
+			))
+		})
+
+		It("should fail for unknown kinds", func() {
+			Expect(config.Validate(logr.Discard(), "Foo")).To(MatchError(ContainSubstring("unknown configuration kind")))
+		})
+	})
+})
@@ -5,33 +5,49 @@
 package config
 
 import (
+	"errors"
+	"fmt"
 	"strings"
+	"time"
 
-	"github.com/caarlos0/env/v11"
 	"github.com/go-logr/logr"
 
+	"github.com/gardener/vpn2/pkg/constants"
 	"github.com/gardener/vpn2/pkg/network"
 )
 
 type PathController struct {
-	IPFamilies           string         `env:"IP_FAMILIES" envDefault:"IPv4"`
-	VPNNetwork           network.CIDR   `env:"VPN_NETWORK"`
-	HAVPNClients         int            `env:"HA_VPN_CLIENTS"`
-	ShootServiceNetworks []network.CIDR `env:"SHOOT_SERVICE_NETWORKS" envDefault:"100.64.0.0/13"`
-	ShootPodNetworks     []network.CIDR `env:"SHOOT_POD_NETWORKS" envDefault:"100.96.0.0/11"`
-	ShootNodeNetworks    []network.CIDR `env:"SHOOT_NODE_NETWORKS"`
-	SeedPodNetwork       network.CIDR   `env:"SEED_POD_NETWORK"`
+	IPFamilies             string         `json:"ipFamilies" env:"IP_FAMILIES" envDefault:"IPv4"`
+	VPNNetwork             network.CIDR   `json:"vpnNetwork" env:"VPN_NETWORK"`
+	HAVPNClients           int            `json:"haVPNClients" env:"HA_VPN_CLIENTS"`
+	ShootServiceNetworks   []network.CIDR `json:"shootServiceNetworks" env:"SHOOT_SERVICE_NETWORKS" envDefault:"100.64.0.0/13"`
+	ShootPodNetworks       []network.CIDR `json:"shootPodNetworks" env:"SHOOT_POD_NETWORKS" envDefault:"100.96.0.0/11"`
+	ShootNodeNetworks      []network.CIDR `json:"shootNodeNetworks" env:"SHOOT_NODE_NETWORKS"`
+	SeedPodNetwork         network.CIDR   `json:"seedPodNetwork" env:"SEED_POD_NETWORK"`
+	PathWindowSize         int            `json:"pathWindowSize" env:"PATH_WINDOW_SIZE" envDefault:"10"`
+	PathSwitchHysteresis   float64        `json:"pathSwitchHysteresis" env:"PATH_SWITCH_HYSTERESIS" envDefault:"0.3"`
+	PathMinDwellTime       time.Duration  `json:"pathMinDwellTime" env:"PATH_MIN_DWELL_TIME" envDefault:"60s"`
+	ECMPRouting            bool           `json:"ecmpRouting" env:"ECMP_ROUTING"`
+	PathProbes             []string       `json:"pathProbes" env:"PATH_PROBES" envDefault:"icmp"`
+	PathProbeTarget        string         `json:"pathProbeTarget" env:"PATH_PROBE_TARGET"`
+	PathProbeTimeout       time.Duration  `json:"pathProbeTimeout" env:"PATH_PROBE_TIMEOUT" envDefault:"500ms"`
+	PathProbeRetries       int            `json:"pathProbeRetries" env:"PATH_PROBE_RETRIES" envDefault:"2"`
+	PodName                string         `json:"podName" env:"POD_NAME"`
+	Namespace              string         `json:"namespace" env:"NAMESPACE"`
+	PodUID                 string         `json:"podUID" env:"POD_UID"`
+	RegistrationSecretFile string         `json:"registrationSecretFile" env:"REGISTRATION_SECRET_FILE"`
+	RouteReconcileInterval time.Duration  `json:"routeReconcileInterval" env:"ROUTE_RECONCILE_INTERVAL" envDefault:"10s"`
 }
 
 func (v PathController) PrimaryIPFamily() string {
 	return strings.Split(v.IPFamilies, ",")[0]
 }
 
+// GetPathControllerConfig returns the path-controller configuration read from the configuration file and the environment.
 func GetPathControllerConfig(log logr.Logger) (PathController, error) {
 	cfg := PathController{}
-	if err := env.Parse(&cfg); err != nil {
-		return cfg, err
-	}
+	errs := []error{parse(KindPathController, &cfg)}
+
 	if cfg.VPNNetwork.String() == "" {
 		var err error
 		cfg.VPNNetwork, err = getVPNNetworkDefault()
@@ -39,7 +55,31 @@ func GetPathControllerConfig(log logr.Logger) (PathController, error) {
 			return PathController{}, err
 		}
 	}
-	if err := validateVPNNetworkCIDR(cfg.VPNNetwork); err != nil {
+	errs = append(errs, validateVPNNetworkCIDR(cfg.VPNNetwork))
+	if cfg.PathWindowSize <= 0 {
+		errs = append(errs, fmt.Errorf("PATH_WINDOW_SIZE must be > 0, got %d", cfg.PathWindowSize))
+	}
+	if cfg.PathSwitchHysteresis < 0 {
+		errs = append(errs, fmt.Errorf("PATH_SWITCH_HYSTERESIS must be >= 0, got %g", cfg.PathSwitchHysteresis))
+	}
+	if cfg.PathMinDwellTime < 0 {
+		errs = append(errs, fmt.Errorf("PATH_MIN_DWELL_TIME must be >= 0, got %s", cfg.PathMinDwellTime))
+	}
+	if cfg.PathProbeTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("PATH_PROBE_TIMEOUT must be > 0, got %s", cfg.PathProbeTimeout))
+	}
+	if cfg.PathProbeRetries < 0 {
+		errs = append(errs, fmt.Errorf("PATH_PROBE_RETRIES must be >= 0, got %d", cfg.PathProbeRetries))
+	}
+	// a dead shoot client must not delay the update of the routes beyond the update interval
+	if probeDuration := cfg.PathProbeTimeout * time.Duration(cfg.PathProbeRetries+1); cfg.PathProbeTimeout > 0 && cfg.PathProbeRetries >= 0 && probeDuration > constants.PathControllerUpdateInterval {
+		errs = append(errs, fmt.Errorf("PATH_PROBE_TIMEOUT * (PATH_PROBE_RETRIES + 1) must be <= %s, got %s", constants.PathControllerUpdateInterval, probeDuration))
+	}
+	if cfg.RouteReconcileInterval < 0 {
+		errs = append(errs, fmt.Errorf("ROUTE_RECONCILE_INTERVAL must be >= 0, got %s", cfg.RouteReconcileInterval))
+	}
+
+	if err := errors.Join(errs...); err != nil {
 		return PathController{}, err
 	}
 
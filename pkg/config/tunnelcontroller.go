@@ -5,32 +5,91 @@
 package config
 
 import (
-	"github.com/caarlos0/env/v11"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
 	"github.com/go-logr/logr"
 
 	"github.com/gardener/vpn2/pkg/constants"
 )
 
 type TunnelController struct {
-	HAVPNClients       int `env:"HA_VPN_CLIENTS"`
-	WatchdogWindowSize int `env:"WATCHDOG_WINDOW_SIZE"`
-	WatchdogThreshold  int `env:"WATCHDOG_THRESHOLD"`
-	WatchdogCooldown   int `env:"WATCHDOG_COOLDOWN"`
+	HAVPNClients           int           `json:"haVPNClients" env:"HA_VPN_CLIENTS"`
+	WatchdogWindowSize     int           `json:"watchdogWindowSize" env:"WATCHDOG_WINDOW_SIZE"`
+	WatchdogThreshold      int           `json:"watchdogThreshold" env:"WATCHDOG_THRESHOLD"`
+	WatchdogCooldown       int           `json:"watchdogCooldown" env:"WATCHDOG_COOLDOWN"`
+	WatchdogEscalation     []string      `json:"watchdogEscalation" env:"WATCHDOG_ESCALATION"`
+	WatchdogWindow         time.Duration `json:"watchdogWindow" env:"WATCHDOG_WINDOW"`
+	WatchdogFailureRatio   float64       `json:"watchdogFailureRatio" env:"WATCHDOG_FAILURE_RATIO"`
+	WatchdogCooldownPeriod time.Duration `json:"watchdogCooldownPeriod" env:"WATCHDOG_COOLDOWN_PERIOD"`
+	WatchdogAction         string        `json:"watchdogAction" env:"WATCHDOG_ACTION"`
+	PodName                string        `json:"podName" env:"POD_NAME"`
+	Namespace              string        `json:"namespace" env:"NAMESPACE"`
+	PodUID                 string        `json:"podUID" env:"POD_UID"`
+	RegistrationSecretFile string        `json:"registrationSecretFile" env:"REGISTRATION_SECRET_FILE"`
+	// RequireRegistrationSecret refuses to start without registration secret instead of accepting unauthenticated
+	// registrations.
+	RequireRegistrationSecret bool          `json:"requireRegistrationSecret" env:"REQUIRE_REGISTRATION_SECRET"`
+	RegistrationExpiry        time.Duration `json:"registrationExpiry" env:"REGISTRATION_EXPIRY"`
+	AdoptionGracePeriod       time.Duration `json:"adoptionGracePeriod" env:"ADOPTION_GRACE_PERIOD"`
 }
 
+// watchdogSignals are the signals of the OpenVPN management interface which restart a vpn-shoot-client: SIGUSR1
+// reconnects, SIGHUP re-reads the configuration, and SIGTERM stops the process so that its container is restarted.
+// In this order, they are also the default escalation.
+var watchdogSignals = []string{"SIGUSR1", "SIGHUP", "SIGTERM"}
+
 var DefaultTunnelControllerConfig = &TunnelController{
-	HAVPNClients:       2,
-	WatchdogWindowSize: constants.WatchdogWindowSize,
-	WatchdogCooldown:   constants.WatchdogCooldown,
-	WatchdogThreshold:  constants.WatchdogThreshold,
+	HAVPNClients:           2,
+	WatchdogWindowSize:     constants.WatchdogWindowSize,
+	WatchdogCooldown:       constants.WatchdogCooldown,
+	WatchdogThreshold:      constants.WatchdogThreshold,
+	WatchdogEscalation:     slices.Clone(watchdogSignals),
+	WatchdogFailureRatio:   constants.WatchdogFailureRatio,
+	WatchdogCooldownPeriod: constants.WatchdogCooldownPeriod,
+	WatchdogAction:         constants.WatchdogActionRestart,
+	RegistrationExpiry:     constants.TunnelControllerRegistrationExpiry,
+	AdoptionGracePeriod:    constants.TunnelControllerAdoptionGracePeriod,
 }
 
+// GetTunnelControllerConfig returns the tunnel-controller configuration read from the configuration file and the environment.
 func GetTunnelControllerConfig(log logr.Logger) (*TunnelController, error) {
-	cfg := DefaultTunnelControllerConfig
-	if err := env.Parse(cfg); err != nil {
-		return cfg, err
+	cfg := *DefaultTunnelControllerConfig
+	errs := []error{parse(KindTunnelController, &cfg)}
+
+	if cfg.RegistrationExpiry <= 0 {
+		errs = append(errs, fmt.Errorf("REGISTRATION_EXPIRY must be > 0, got %s", cfg.RegistrationExpiry))
+	}
+	if cfg.AdoptionGracePeriod <= 0 {
+		errs = append(errs, fmt.Errorf("ADOPTION_GRACE_PERIOD must be > 0, got %s", cfg.AdoptionGracePeriod))
+	}
+	if len(cfg.WatchdogEscalation) == 0 {
+		errs = append(errs, errors.New("WATCHDOG_ESCALATION must not be empty"))
+	}
+	for _, signal := range cfg.WatchdogEscalation {
+		if !slices.Contains(watchdogSignals, signal) {
+			errs = append(errs, fmt.Errorf("WATCHDOG_ESCALATION contains unsupported signal %q, must be one of %v", signal, watchdogSignals))
+		}
+	}
+	if cfg.WatchdogWindow < 0 {
+		errs = append(errs, fmt.Errorf("WATCHDOG_WINDOW must be >= 0, got %s", cfg.WatchdogWindow))
+	}
+	if cfg.WatchdogFailureRatio <= 0 || cfg.WatchdogFailureRatio > 1 {
+		errs = append(errs, fmt.Errorf("WATCHDOG_FAILURE_RATIO must be > 0 and <= 1, got %g", cfg.WatchdogFailureRatio))
+	}
+	if cfg.WatchdogCooldownPeriod <= 0 {
+		errs = append(errs, fmt.Errorf("WATCHDOG_COOLDOWN_PERIOD must be > 0, got %s", cfg.WatchdogCooldownPeriod))
+	}
+	if !slices.Contains(constants.WatchdogActions, cfg.WatchdogAction) {
+		errs = append(errs, fmt.Errorf("WATCHDOG_ACTION must be one of %v, but is set to %q", constants.WatchdogActions, cfg.WatchdogAction))
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
 	}
 
 	log.Info("config parsed", "config", cfg)
-	return cfg, nil
+	return &cfg, nil
 }
@@ -0,0 +1,46 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import (
+	"fmt"
+
+	"github.com/go-logr/logr"
+)
+
+// Validate parses the configuration of the given kind from the configuration file and the environment.
+// The returned error contains all problems found, use Errors to get them one by one.
+func Validate(log logr.Logger, kind string) error {
+	var err error
+	switch kind {
+	case KindVPNClient:
+		_, err = GetVPNClientConfig()
+	case KindVPNServer:
+		_, err = GetVPNServerConfig(log)
+	case KindPathController:
+		_, err = GetPathControllerConfig(log)
+	case KindTunnelController:
+		_, err = GetTunnelControllerConfig(log)
+	default:
+		err = fmt.Errorf("unknown configuration kind %q", kind)
+	}
+	return err
+}
+
+// Errors flattens joined errors into a list of individual errors.
+func Errors(err error) []error {
+	if err == nil {
+		return nil
+	}
+	joined, ok := err.(interface{ Unwrap() []error })
+	if !ok {
+		return []error{err}
+	}
+	var errs []error
+	for _, e := range joined.Unwrap() {
+		errs = append(errs, Errors(e)...)
+	}
+	return errs
+}
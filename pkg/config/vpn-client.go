@@ -5,52 +5,53 @@
 package config
 
 import (
+	"errors"
 	"fmt"
 	"slices"
 	"strconv"
 	"strings"
 	"time"
 
-	"github.com/caarlos0/env/v11"
-
 	"github.com/gardener/vpn2/pkg/constants"
 	"github.com/gardener/vpn2/pkg/network"
 )
 
 type VPNClient struct {
-	IPFamilies           []string       `env:"IP_FAMILIES" envDefault:"IPv4"`
-	Endpoint             string         `env:"ENDPOINT"`
-	OpenVPNPort          uint           `env:"OPENVPN_PORT" envDefault:"8132"`
-	VPNNetwork           network.CIDR   `env:"VPN_NETWORK"`
-	SeedPodNetwork       network.CIDR   `env:"SEED_POD_NETWORK"`
-	ShootServiceNetworks []network.CIDR `env:"SHOOT_SERVICE_NETWORKS"`
-	ShootPodNetworks     []network.CIDR `env:"SHOOT_POD_NETWORKS"`
-	ShootNodeNetworks    []network.CIDR `env:"SHOOT_NODE_NETWORKS"`
-	IsShootClient        bool           `env:"IS_SHOOT_CLIENT"`
-	PodName              string         `env:"POD_NAME"`
-	Namespace            string         `env:"NAMESPACE"`
-	VPNServerIndex       string         `env:"VPN_SERVER_INDEX"`
-	VPNClientIndex       int
-	IsHA                 bool          `env:"IS_HA"`
-	ReversedVPNHeader    string        `env:"REVERSED_VPN_HEADER" envDefault:"invalid-host"`
-	ReversedVPNHeaderKey string        `env:"REVERSED_VPN_HEADER_KEY" envDefault:"Reversed-VPN"`
-	HAVPNClients         uint          `env:"HA_VPN_CLIENTS"`
-	HAVPNServers         uint          `env:"HA_VPN_SERVERS"`
-	PodLabelSelector     string        `env:"POD_LABEL_SELECTOR" envDefault:"app=kubernetes,role=apiserver"`
-	WaitTime             time.Duration `env:"WAIT_TIME" envDefault:"2s"`
-	BondingMode          string        `env:"BONDING_MODE" envDefault:"active-backup"`
-	AutoMTU              bool          `env:"OPENVPN_AUTO_MTU"`
+	IPFamilies           []string       `json:"ipFamilies" env:"IP_FAMILIES" envDefault:"IPv4"`
+	Endpoint             string         `json:"endpoint" env:"ENDPOINT"`
+	OpenVPNPort          uint           `json:"openVPNPort" env:"OPENVPN_PORT" envDefault:"8132"`
+	VPNNetwork           network.CIDR   `json:"vpnNetwork" env:"VPN_NETWORK"`
+	SeedPodNetwork       network.CIDR   `json:"seedPodNetwork" env:"SEED_POD_NETWORK"`
+	ShootServiceNetworks []network.CIDR `json:"shootServiceNetworks" env:"SHOOT_SERVICE_NETWORKS"`
+	ShootPodNetworks     []network.CIDR `json:"shootPodNetworks" env:"SHOOT_POD_NETWORKS"`
+	ShootNodeNetworks    []network.CIDR `json:"shootNodeNetworks" env:"SHOOT_NODE_NETWORKS"`
+	IsShootClient        bool           `json:"isShootClient" env:"IS_SHOOT_CLIENT"`
+	PodName              string         `json:"podName" env:"POD_NAME"`
+	Namespace            string         `json:"namespace" env:"NAMESPACE"`
+	VPNServerIndex       string         `json:"vpnServerIndex" env:"VPN_SERVER_INDEX"`
+	VPNClientIndex       int            // derived from POD_NAME, not configurable
+	IsHA                 bool           `json:"isHA" env:"IS_HA"`
+	ReversedVPNHeader    string         `json:"reversedVPNHeader" env:"REVERSED_VPN_HEADER" envDefault:"invalid-host"`
+	ReversedVPNHeaderKey string         `json:"reversedVPNHeaderKey" env:"REVERSED_VPN_HEADER_KEY" envDefault:"Reversed-VPN"`
+	HAVPNClients         uint           `json:"haVPNClients" env:"HA_VPN_CLIENTS"`
+	HAVPNServers         uint           `json:"haVPNServers" env:"HA_VPN_SERVERS"`
+	PodLabelSelector     string         `json:"podLabelSelector" env:"POD_LABEL_SELECTOR" envDefault:"app=kubernetes,role=apiserver"`
+	WaitTime             time.Duration  `json:"waitTime" env:"WAIT_TIME" envDefault:"2s"`
+	BondingMode          string         `json:"bondingMode" env:"BONDING_MODE" envDefault:"active-backup"`
+	AutoMTU              bool           `json:"autoMTU" env:"OPENVPN_AUTO_MTU"`
+	FirewallBackend      string         `json:"firewallBackend" env:"FIREWALL_BACKEND" envDefault:"iptables"`
+	ECMPRouting          bool           `json:"ecmpRouting" env:"ECMP_ROUTING"`
 }
 
 func (v VPNClient) PrimaryIPFamily() string {
 	return v.IPFamilies[0]
 }
 
+// GetVPNClientConfig returns the vpn-client configuration read from the configuration file and the environment.
 func GetVPNClientConfig() (VPNClient, error) {
 	cfg := VPNClient{}
-	if err := env.Parse(&cfg); err != nil {
-		return cfg, err
-	}
+	errs := []error{parse(KindVPNClient, &cfg)}
+
 	if cfg.VPNNetwork.String() == "" {
 		var err error
 		cfg.VPNNetwork, err = getVPNNetworkDefault()
@@ -58,44 +59,48 @@ func GetVPNClientConfig() (VPNClient, error) {
 			return VPNClient{}, err
 		}
 	}
-	if err := validateVPNNetworkCIDR(cfg.VPNNetwork); err != nil {
-		return VPNClient{}, err
-	}
-	cfg.VPNClientIndex = -1
+	errs = append(errs, validateVPNNetworkCIDR(cfg.VPNNetwork))
 
+	cfg.VPNClientIndex = -1
 	if cfg.IsHA {
 		if cfg.IsShootClient {
 			if cfg.PodName == "" {
-				return VPNClient{}, fmt.Errorf("IS_HA and IS_SHOOT_CLIENT are set to true but POD_NAME is not set")
+				errs = append(errs, fmt.Errorf("IS_HA and IS_SHOOT_CLIENT are set to true but POD_NAME is not set"))
 			}
 		}
 		if cfg.HAVPNServers > 0 && cfg.HAVPNClients == 0 {
-			return VPNClient{}, fmt.Errorf("HA_VPN_SERVERS is set to %d but HA_VPN_CLIENTS is set to 0", cfg.HAVPNServers)
+			errs = append(errs, fmt.Errorf("HA_VPN_SERVERS is set to %d but HA_VPN_CLIENTS is set to 0", cfg.HAVPNServers))
 		}
 		if cfg.HAVPNClients > 0 && cfg.HAVPNServers == 0 {
-			return VPNClient{}, fmt.Errorf("HA_VPN_CLIENTS is set to %d but HA_VPN_SERVERS is set to 0", cfg.HAVPNClients)
+			errs = append(errs, fmt.Errorf("HA_VPN_CLIENTS is set to %d but HA_VPN_SERVERS is set to 0", cfg.HAVPNClients))
 		}
 		if slices.Contains(constants.BondingModes, cfg.BondingMode) == false {
-			return VPNClient{}, fmt.Errorf("BONDING_MODE must be one of %v, but is set to %q", constants.BondingModes, cfg.BondingMode)
+			errs = append(errs, fmt.Errorf("BONDING_MODE must be one of %v, but is set to %q", constants.BondingModes, cfg.BondingMode))
 		}
 	}
 
 	if len(cfg.IPFamilies) < 1 || len(cfg.IPFamilies) > 2 {
-		return VPNClient{}, fmt.Errorf("IP_FAMILIES must contain at least one but no more than 2 elements")
+		errs = append(errs, fmt.Errorf("IP_FAMILIES must contain at least one but no more than 2 elements"))
 	}
-
 	for _, ipFamily := range cfg.IPFamilies {
 		if ipFamily != network.IPv4Family && ipFamily != constants.IPv6Family {
-			return VPNClient{}, fmt.Errorf("IP_FAMILIES can only contain %s or %s, found value %q", network.IPv4Family, constants.IPv6Family, ipFamily)
+			errs = append(errs, fmt.Errorf("IP_FAMILIES can only contain %s or %s, found value %q", network.IPv4Family, constants.IPv6Family, ipFamily))
 		}
 	}
-
 	// Remove ip family duplicates
 	slices.Sort(cfg.IPFamilies)
 	cfg.IPFamilies = slices.Compact(cfg.IPFamilies)
 
+	if !slices.Contains(constants.FirewallBackends, cfg.FirewallBackend) {
+		errs = append(errs, fmt.Errorf("FIREWALL_BACKEND must be one of %v, but is set to %q", constants.FirewallBackends, cfg.FirewallBackend))
+	}
+
 	if cfg.WaitTime < 0 {
-		return VPNClient{}, fmt.Errorf("WAIT_TIME must not be negative")
+		errs = append(errs, fmt.Errorf("WAIT_TIME must not be negative"))
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return VPNClient{}, err
 	}
 
 	if cfg.PodName != "" {
@@ -105,5 +110,6 @@ func GetVPNClientConfig() (VPNClient, error) {
 			cfg.VPNClientIndex = clientIndex
 		}
 	}
+
 	return cfg, nil
 }
@@ -64,6 +64,7 @@ var _ = Describe("GetVPNClientConfig", func() {
 		Expect(os.Unsetenv("HA_VPN_SERVERS")).To(Succeed())
 		Expect(os.Unsetenv("POD_LABEL_SELECTOR")).To(Succeed())
 		Expect(os.Unsetenv("WAIT_TIME")).To(Succeed())
+		Expect(os.Unsetenv("FIREWALL_BACKEND")).To(Succeed())
 	})
 
 	type testCase struct {
@@ -302,5 +303,15 @@ var _ = Describe("GetVPNClientConfig", func() {
 			},
 			expectedMatcher: MatchFields(IgnoreExtras, Fields{"PodLabelSelector": Equal("app=kubernetes,role=apiserver")}),
 		}),
+		Entry("missing FIREWALL_BACKEND value should yield the default", testCase{
+			envVars:         map[string]string{},
+			expectedMatcher: MatchFields(IgnoreExtras, Fields{"FirewallBackend": Equal("iptables")}),
+		}),
+		Entry("unknown FIREWALL_BACKEND value should fail", testCase{
+			envVars: map[string]string{
+				"FIREWALL_BACKEND": "ebtables",
+			},
+			expectedError: true,
+		}),
 	)
 })
@@ -5,33 +5,37 @@
 package config
 
 import (
+	"errors"
 	"fmt"
+	"slices"
 
-	"github.com/caarlos0/env/v11"
 	"github.com/go-logr/logr"
 
+	"github.com/gardener/vpn2/pkg/constants"
 	"github.com/gardener/vpn2/pkg/network"
 )
 
 type VPNServer struct {
-	ShootServiceNetworks []network.CIDR `env:"SHOOT_SERVICE_NETWORKS" envDefault:"100.64.0.0/13"`
-	ShootPodNetworks     []network.CIDR `env:"SHOOT_POD_NETWORKS" envDefault:"100.96.0.0/11"`
-	ShootNodeNetworks    []network.CIDR `env:"SHOOT_NODE_NETWORKS"`
-	VPNNetwork           network.CIDR   `env:"VPN_NETWORK"`
-	SeedPodNetwork       network.CIDR   `env:"SEED_POD_NETWORK"`
-	PodName              string         `env:"POD_NAME"`
-	StatusPath           string         `env:"OPENVPN_STATUS_PATH"`
-	IsHA                 bool           `env:"IS_HA"`
-	HAVPNClients         int            `env:"HA_VPN_CLIENTS"`
-	LocalNodeIP          string         `env:"LOCAL_NODE_IP" envDefault:"255.255.255.255"`
-	AutoMTU              bool           `env:"OPENVPN_AUTO_MTU"`
+	ShootServiceNetworks []network.CIDR `json:"shootServiceNetworks" env:"SHOOT_SERVICE_NETWORKS" envDefault:"100.64.0.0/13"`
+	ShootPodNetworks     []network.CIDR `json:"shootPodNetworks" env:"SHOOT_POD_NETWORKS" envDefault:"100.96.0.0/11"`
+	ShootNodeNetworks    []network.CIDR `json:"shootNodeNetworks" env:"SHOOT_NODE_NETWORKS"`
+	VPNNetwork           network.CIDR   `json:"vpnNetwork" env:"VPN_NETWORK"`
+	SeedPodNetwork       network.CIDR   `json:"seedPodNetwork" env:"SEED_POD_NETWORK"`
+	PodName              string         `json:"podName" env:"POD_NAME"`
+	StatusPath           string         `json:"statusPath" env:"OPENVPN_STATUS_PATH"`
+	IsHA                 bool           `json:"isHA" env:"IS_HA"`
+	HAVPNClients         int            `json:"haVPNClients" env:"HA_VPN_CLIENTS"`
+	LocalNodeIP          string         `json:"localNodeIP" env:"LOCAL_NODE_IP" envDefault:"255.255.255.255"`
+	AutoMTU              bool           `json:"autoMTU" env:"OPENVPN_AUTO_MTU"`
+	FirewallBackend      string         `json:"firewallBackend" env:"FIREWALL_BACKEND" envDefault:"iptables"`
+	ManagementPort       uint           `json:"managementPort" env:"MANAGEMENT_PORT" envDefault:"7505"`
 }
 
+// GetVPNServerConfig returns the vpn-server configuration read from the configuration file and the environment.
 func GetVPNServerConfig(log logr.Logger) (VPNServer, error) {
 	cfg := VPNServer{}
-	if err := env.Parse(&cfg); err != nil {
-		return cfg, err
-	}
+	errs := []error{parse(KindVPNServer, &cfg)}
+
 	if cfg.VPNNetwork.String() == "" {
 		var err error
 		cfg.VPNNetwork, err = getVPNNetworkDefault()
@@ -39,21 +43,31 @@ func GetVPNServerConfig(log logr.Logger) (VPNServer, error) {
 			return VPNServer{}, err
 		}
 	}
-	if err := validateVPNNetworkCIDR(cfg.VPNNetwork); err != nil {
-		return VPNServer{}, err
-	}
+	errs = append(errs, validateVPNNetworkCIDR(cfg.VPNNetwork))
 
 	if cfg.IsHA {
 		if cfg.PodName == "" {
-			return VPNServer{}, fmt.Errorf("IS_HA is set to true but POD_NAME is not set")
+			errs = append(errs, fmt.Errorf("IS_HA is set to true but POD_NAME is not set"))
 		}
 		if cfg.HAVPNClients <= 0 {
-			return VPNServer{}, fmt.Errorf("IS_HA is set to true but HA_VPN_CLIENTS is not set or invalid")
+			errs = append(errs, fmt.Errorf("IS_HA is set to true but HA_VPN_CLIENTS is not set or invalid"))
 		}
 	}
 
+	if !slices.Contains(constants.FirewallBackends, cfg.FirewallBackend) {
+		errs = append(errs, fmt.Errorf("FIREWALL_BACKEND must be one of %v, but is set to %q", constants.FirewallBackends, cfg.FirewallBackend))
+	}
+
+	if cfg.ManagementPort == 0 || cfg.ManagementPort > 65535 {
+		errs = append(errs, fmt.Errorf("MANAGEMENT_PORT must be a valid port, got %d", cfg.ManagementPort))
+	}
+
 	if cfg.StatusPath == "" {
-		return VPNServer{}, fmt.Errorf("OPENVPN_STATUS_PATH is not set")
+		errs = append(errs, fmt.Errorf("OPENVPN_STATUS_PATH is not set"))
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return VPNServer{}, err
 	}
 
 	log.Info("config parsed", "config", cfg)
@@ -55,6 +55,8 @@ var _ = Describe("GetVPNServerConfig", func() {
 		Expect(os.Unsetenv("IS_HA")).To(Succeed())
 		Expect(os.Unsetenv("HA_VPN_CLIENTS")).To(Succeed())
 		Expect(os.Unsetenv("LOCAL_NODE_IP")).To(Succeed())
+		Expect(os.Unsetenv("FIREWALL_BACKEND")).To(Succeed())
+		Expect(os.Unsetenv("MANAGEMENT_PORT")).To(Succeed())
 	})
 
 	type testCase struct {
@@ -162,6 +164,46 @@ var _ = Describe("GetVPNServerConfig", func() {
 				"LocalNodeIP": Equal("255.255.255.255"),
 			}),
 		}),
+		Entry("missing FIREWALL_BACKEND should yield iptables", testCase{
+			envVars: map[string]string{},
+			expectedMatcher: MatchFields(IgnoreExtras, Fields{
+				"FirewallBackend": Equal("iptables"),
+			}),
+		}),
+		Entry("nftables firewall backend", testCase{
+			envVars: map[string]string{
+				"FIREWALL_BACKEND": "nftables",
+			},
+			expectedMatcher: MatchFields(IgnoreExtras, Fields{
+				"FirewallBackend": Equal("nftables"),
+			}),
+		}),
+		Entry("unknown FIREWALL_BACKEND should fail", testCase{
+			envVars: map[string]string{
+				"FIREWALL_BACKEND": "ebtables",
+			},
+			expectedError: true,
+		}),
+		Entry("missing MANAGEMENT_PORT should yield 7505", testCase{
+			envVars: map[string]string{},
+			expectedMatcher: MatchFields(IgnoreExtras, Fields{
+				"ManagementPort": Equal(uint(7505)),
+			}),
+		}),
+		Entry("custom MANAGEMENT_PORT", testCase{
+			envVars: map[string]string{
+				"MANAGEMENT_PORT": "7600",
+			},
+			expectedMatcher: MatchFields(IgnoreExtras, Fields{
+				"ManagementPort": Equal(uint(7600)),
+			}),
+		}),
+		Entry("invalid MANAGEMENT_PORT should fail", testCase{
+			envVars: map[string]string{
+				"MANAGEMENT_PORT": "70000",
+			},
+			expectedError: true,
+		}),
 		Entry("multiple pod networks with spaces should fail", testCase{
 			envVars: map[string]string{
 				"SHOOT_POD_NETWORKS": "100.96.0.0/11, 100.97.0.0/11 , 100.98.0.0/11",
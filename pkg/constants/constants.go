@@ -28,12 +28,23 @@ const (
 	TapDevice = "tap0"
 	// TunnelDevice is the name of the tunnel device used for non-HA VPN.
 	TunnelDevice = "tun0"
+	// SysctlStateFile is the default file in which the setup subcommands record the previous values of the changed
+	// kernel parameters for the cleanup subcommands.
+	SysctlStateFile = "/var/lib/vpn2/sysctl.json"
 	// VPNNetworkMask is the required prefix size for the VPN network.
 	VPNNetworkMask = 96
 
 	BondingModeActiveBackup = "active-backup"
 	BondingModeBalanceRR    = "balance-rr"
 
+	FirewallBackendIPTables = "iptables"
+	FirewallBackendNFTables = "nftables"
+
+	// WatchdogActionRestart restarts the vpn-shoot-client with the signals of the watchdog escalation.
+	WatchdogActionRestart = "restart"
+	// WatchdogActionExit stops the tunnel-controller with an error, so that its container is restarted.
+	WatchdogActionExit = "exit"
+
 	ShootPodNetworkMapped     = constants.ReservedShootPodNetworkMappedRange
 	ShootServiceNetworkMapped = constants.ReservedShootServiceNetworkMappedRange
 	ShootNodeNetworkMapped    = constants.ReservedShootNodeNetworkMappedRange
@@ -45,10 +56,20 @@ const (
 
 	PathControllerUpdateInterval  = 2 * time.Second
 	TunnelControllerUpdateTimeout = 2 * PathControllerUpdateInterval
+	// TunnelControllerRegistrationExpiry is the default time after which the tunnel to a silent kube-apiserver is deleted.
+	TunnelControllerRegistrationExpiry = 10 * time.Minute
+	// TunnelControllerAdoptionGracePeriod is the default time within which the kube-apiservers of the tunnel devices
+	// adopted after a restart of the tunnel-controller must announce themselves again.
+	TunnelControllerAdoptionGracePeriod = time.Minute
 
 	WatchdogWindowSize = 20
 	WatchdogThreshold  = 10
 	WatchdogCooldown   = 20
+	// WatchdogFailureRatio is the default ratio of failed checks within the window of a time-based watchdog which
+	// triggers it.
+	WatchdogFailureRatio = 0.5
+	// WatchdogCooldownPeriod is the default time a time-based watchdog ignores the checks after it has been triggered.
+	WatchdogCooldownPeriod = WatchdogCooldown * TunnelControllerUpdateTimeout
 
 	EnvoyVPNGroupId = constants.EnvoyVPNGroupId
 )
@@ -56,6 +77,12 @@ const (
 // BondingModes are the supported bonding modes for the HA VPN.
 var BondingModes = []string{BondingModeActiveBackup, BondingModeBalanceRR}
 
+// FirewallBackends are the supported backends for programming the firewall and NAT rules.
+var FirewallBackends = []string{FirewallBackendIPTables, FirewallBackendNFTables}
+
+// WatchdogActions are the supported actions of the watchdogs of the tunnel-controller.
+var WatchdogActions = []string{WatchdogActionRestart, WatchdogActionExit}
+
 // DefaultVPNNetwork is the default IPv6 transfer network used by VPN.
 var DefaultVPNNetwork net.IPNet
 
@@ -0,0 +1,102 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package events
+
+import (
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
+)
+
+// Reasons of the events emitted by the vpn-client controllers.
+const (
+	// ReasonPrimaryShootClientChanged is the reason of the event emitted when the path-controller routes the shoot
+	// networks over another shoot client.
+	ReasonPrimaryShootClientChanged = "PrimaryShootClientChanged"
+	// ReasonShootClientsChanged is the reason of the event emitted when the path-controller changes the nexthops of the
+	// ECMP routes to the shoot networks.
+	ReasonShootClientsChanged = "ShootClientsChanged"
+	// ReasonTunnelCreationFailed is the reason of the event emitted when the tunnel-controller fails to set up the
+	// ip6tnl device to a kube-apiserver pod.
+	ReasonTunnelCreationFailed = "TunnelCreationFailed"
+)
+
+// Recorder records events on the pod of the controller.
+type Recorder interface {
+	// Eventf records an event of the given type (Normal or Warning) with the message built like fmt.Sprintf.
+	Eventf(eventType, reason, messageFmt string, args ...any)
+}
+
+// Pod identifies the pod the events are recorded on. The UID is needed for `kubectl describe pod` to show the events.
+type Pod struct {
+	Namespace string
+	Name      string
+	UID       string
+}
+
+// NewRecorder returns a recorder for events on the given pod and a function to stop the recording.
+// Similar events are aggregated and rate-limited by the event correlator of client-go.
+// If the pod is unknown or the controller is not running in a cluster, the events are discarded.
+func NewRecorder(log logr.Logger, component string, pod Pod) (Recorder, func()) {
+	if pod.Namespace == "" || pod.Name == "" {
+		log.Info("pod is unknown, discarding events")
+		return Discard(), func() {}
+	}
+	config, err := rest.InClusterConfig()
+	if err != nil {
+		log.Info("no in-cluster config, discarding events", "error", err)
+		return Discard(), func() {}
+	}
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		log.Info("error creating clientset, discarding events", "error", err)
+		return Discard(), func() {}
+	}
+	return newRecorder(log, clientset, component, pod)
+}
+
+func newRecorder(log logr.Logger, clientset kubernetes.Interface, component string, pod Pod) (Recorder, func()) {
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: clientset.CoreV1().Events(pod.Namespace)})
+	log.Info("recording events", "namespace", pod.Namespace, "pod", pod.Name)
+
+	recorder := broadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: component})
+	return ForObject(recorder, &corev1.ObjectReference{
+		APIVersion: "v1",
+		Kind:       "Pod",
+		Namespace:  pod.Namespace,
+		Name:       pod.Name,
+		UID:        types.UID(pod.UID),
+	}), broadcaster.Shutdown
+}
+
+// ForObject returns a recorder recording the events on the given object.
+func ForObject(recorder record.EventRecorder, object runtime.Object) Recorder {
+	return &objectRecorder{recorder: recorder, object: object}
+}
+
+type objectRecorder struct {
+	recorder record.EventRecorder
+	object   runtime.Object
+}
+
+func (r *objectRecorder) Eventf(eventType, reason, messageFmt string, args ...any) {
+	r.recorder.Eventf(r.object, eventType, reason, messageFmt, args...)
+}
+
+// Discard returns a recorder discarding all events.
+func Discard() Recorder {
+	return discardRecorder{}
+}
+
+type discardRecorder struct{}
+
+func (discardRecorder) Eventf(_, _, _ string, _ ...any) {}
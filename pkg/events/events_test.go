@@ -0,0 +1,62 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package events
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+)
+
+var _ = Describe("#Recorder", func() {
+	pod := Pod{Namespace: "shoot--foo--bar", Name: "kube-apiserver-0", UID: "1234"}
+
+	It("should record aggregated events on the pod", func() {
+		clientset := fake.NewClientset()
+		recorder, stop := newRecorder(logr.Discard(), clientset, "path-controller", pod)
+		DeferCleanup(stop)
+
+		recorder.Eventf(corev1.EventTypeNormal, ReasonPrimaryShootClientChanged, "switched to %s", "192.168.123.195")
+		recorder.Eventf(corev1.EventTypeNormal, ReasonPrimaryShootClientChanged, "switched to %s", "192.168.123.195")
+
+		var events []corev1.Event
+		Eventually(func(g Gomega) {
+			list, err := clientset.CoreV1().Events(pod.Namespace).List(context.Background(), metav1.ListOptions{})
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(list.Items).To(ConsistOf(HaveField("Count", BeEquivalentTo(2))))
+			events = list.Items
+		}).Should(Succeed())
+
+		Expect(events[0].InvolvedObject).To(Equal(corev1.ObjectReference{
+			APIVersion: "v1",
+			Kind:       "Pod",
+			Namespace:  pod.Namespace,
+			Name:       pod.Name,
+			UID:        types.UID(pod.UID),
+		}))
+		Expect(events[0].Source.Component).To(Equal("path-controller"))
+		Expect(events[0].Reason).To(Equal(ReasonPrimaryShootClientChanged))
+		Expect(events[0].Message).To(Equal("switched to 192.168.123.195"))
+	})
+
+	It("should discard events if the pod is unknown", func() {
+		recorder, stop := NewRecorder(logr.Discard(), "tunnel-controller", Pod{})
+		DeferCleanup(stop)
+		Expect(recorder).To(Equal(Discard()))
+	})
+
+	It("should record events on the given object", func() {
+		fakeRecorder := record.NewFakeRecorder(1)
+		ForObject(fakeRecorder, &corev1.Pod{}).Eventf(corev1.EventTypeWarning, ReasonTunnelCreationFailed, "failed: %s", "boom")
+		Expect(fakeRecorder.Events).To(Receive(Equal("Warning TunnelCreationFailed failed: boom")))
+	})
+})
@@ -37,3 +37,50 @@ func iptablesWorks(path string) bool {
 	// check both iptables and ip6tables
 	return exec.Command(path, "-L").Run() == nil && exec.Command(adjustPath(path, iptables.ProtocolIPv6), "-L").Run() == nil // #nosec: G204 -- Command line is completely static "/usr/sbin/(iptables|ip6tables)-(legacy|nft) -L".
 }
+
+// IPTables is the subset of iptables operations used to reconcile the VPN rules.
+type IPTables interface {
+	AppendUnique(table, chain string, rulespec ...string) error
+	Exists(table, chain string, rulespec ...string) (bool, error)
+	DeleteIfExists(table, chain string, rulespec ...string) error
+	Insert(table, chain string, pos int, rulespec ...string) error
+	DeleteById(table, chain string, id int) error
+	List(table, chain string) ([]string, error)
+	ListChains(table string) ([]string, error)
+	ChainExists(table, chain string) (bool, error)
+	NewChain(table, chain string) error
+	ClearChain(table, chain string) error
+	ClearAndDeleteChain(table, chain string) error
+}
+
+// IPTablesFactory creates an IPTables for the given protocol.
+type IPTablesFactory func(log logr.Logger, proto iptables.Protocol) (IPTables, error)
+
+// HostIPTables is an IPTablesFactory operating on the iptables of the host.
+func HostIPTables(log logr.Logger, proto iptables.Protocol) (IPTables, error) {
+	ipTable, err := NewIPTables(log, proto)
+	if err != nil {
+		return nil, err
+	}
+	return ipTable, nil
+}
+
+// IPTablesRule is an iptables rule appended to a chain.
+type IPTablesRule struct {
+	Protocol iptables.Protocol
+	Table    string
+	Chain    string
+	RuleSpec []string
+}
+
+// String returns the rule as iptables command line.
+func (r IPTablesRule) String() string {
+	return strings.Join(append([]string{iptablesCommand(r.Protocol), "-t", r.Table, "-A", r.Chain}, r.RuleSpec...), " ")
+}
+
+func iptablesCommand(proto iptables.Protocol) string {
+	if proto == iptables.ProtocolIPv6 {
+		return "ip6tables"
+	}
+	return "iptables"
+}
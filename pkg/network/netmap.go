@@ -6,8 +6,11 @@ package network
 
 import (
 	"fmt"
+	"maps"
 	"net"
+	"slices"
 	"sort"
+	"strings"
 
 	"github.com/gardener/vpn2/pkg/constants"
 )
@@ -230,3 +233,11 @@ func ShootNetworksForNetmap(
 
 	return ipv4PodNetworkMappings, ipv4ServiceNetworkMappings, ipv4NodeNetworkMappings, nil
 }
+
+// SortedNetmapSources returns the source CIDRs of the given mappings sorted by their string representation.
+// It is used to iterate over mappings in a stable order.
+func SortedNetmapSources(mappings map[*CIDR]CIDR) []*CIDR {
+	return slices.SortedFunc(maps.Keys(mappings), func(a, b *CIDR) int {
+		return strings.Compare(a.String(), b.String())
+	})
+}
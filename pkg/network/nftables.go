@@ -0,0 +1,508 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package network
+
+import (
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/coreos/go-iptables/iptables"
+	"github.com/go-logr/logr"
+	"github.com/google/nftables"
+	"github.com/google/nftables/binaryutil"
+	"github.com/google/nftables/expr"
+	"github.com/google/nftables/userdata"
+	"golang.org/x/sys/unix"
+
+	"github.com/gardener/vpn2/pkg/constants"
+)
+
+// NFTablesTable is the name of the nftables table holding the chains of all rule sets.
+const NFTablesTable = "vpn2"
+
+// NFTables is the subset of nftables operations used to reconcile the VPN rules.
+// All changes are collected in a batch and applied atomically by Flush.
+type NFTables interface {
+	AddTable(t *nftables.Table) *nftables.Table
+	DelTable(t *nftables.Table)
+	ListTablesOfFamily(family nftables.TableFamily) ([]*nftables.Table, error)
+	ListChainsOfTableFamily(family nftables.TableFamily) ([]*nftables.Chain, error)
+	AddChain(c *nftables.Chain) *nftables.Chain
+	FlushChain(c *nftables.Chain)
+	DelChain(c *nftables.Chain)
+	AddRule(r *nftables.Rule) *nftables.Rule
+	Flush() error
+}
+
+// NFTablesFactory creates an NFTables connection.
+type NFTablesFactory func() (NFTables, error)
+
+// HostNFTables is an NFTablesFactory operating on the nftables of the host via netlink.
+func HostNFTables() (NFTables, error) {
+	conn, err := nftables.New()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open nftables netlink connection: %w", err)
+	}
+	return conn, nil
+}
+
+// nftChainSpec describes how the built-in iptables chains map to nftables base chains.
+type nftChainSpec struct {
+	chainType nftables.ChainType
+	hook      *nftables.ChainHook
+	priority  *nftables.ChainPriority
+}
+
+// nftChainSpecs uses the types and priorities of the base chains iptables-nft creates for the built-in chains, so that
+// the rules are evaluated in the same order relative to the other tables as with the iptables backend.
+// Unlike an ACCEPT in a chain jumped to from a built-in chain, an accept in a base chain of the vpn2 table only ends
+// the evaluation of this base chain. A packet is still dropped by other base chains of the same hook, e.g. by the
+// filter table of iptables-nft, no matter their priority.
+// The mangle OUTPUT chain is a route chain, as iptables reroutes locally generated packets whose addresses or mark are
+// changed in this chain. A filter chain would not trigger the rerouting.
+var nftChainSpecs = map[string]map[string]nftChainSpec{
+	"filter": {
+		"INPUT":   {nftables.ChainTypeFilter, nftables.ChainHookInput, nftables.ChainPriorityFilter},
+		"FORWARD": {nftables.ChainTypeFilter, nftables.ChainHookForward, nftables.ChainPriorityFilter},
+		"OUTPUT":  {nftables.ChainTypeFilter, nftables.ChainHookOutput, nftables.ChainPriorityFilter},
+	},
+	"nat": {
+		"PREROUTING":  {nftables.ChainTypeNAT, nftables.ChainHookPrerouting, nftables.ChainPriorityNATDest},
+		"OUTPUT":      {nftables.ChainTypeNAT, nftables.ChainHookOutput, nftables.ChainPriorityNATDest},
+		"INPUT":       {nftables.ChainTypeNAT, nftables.ChainHookInput, nftables.ChainPriorityNATSource},
+		"POSTROUTING": {nftables.ChainTypeNAT, nftables.ChainHookPostrouting, nftables.ChainPriorityNATSource},
+	},
+	"mangle": {
+		"PREROUTING":  {nftables.ChainTypeFilter, nftables.ChainHookPrerouting, nftables.ChainPriorityMangle},
+		"INPUT":       {nftables.ChainTypeFilter, nftables.ChainHookInput, nftables.ChainPriorityMangle},
+		"FORWARD":     {nftables.ChainTypeFilter, nftables.ChainHookForward, nftables.ChainPriorityMangle},
+		"OUTPUT":      {nftables.ChainTypeRoute, nftables.ChainHookOutput, nftables.ChainPriorityMangle},
+		"POSTROUTING": {nftables.ChainTypeFilter, nftables.ChainHookPostrouting, nftables.ChainPriorityMangle},
+	},
+}
+
+func nftFamily(proto iptables.Protocol) nftables.TableFamily {
+	if proto == iptables.ProtocolIPv6 {
+		return nftables.TableFamilyIPv6
+	}
+	return nftables.TableFamilyIPv4
+}
+
+// nftChainName returns the name of the base chain of the rule set for the given table and built-in chain.
+func (s *RuleSet) nftChainName(table, builtin string) string {
+	return strings.ToLower(s.owner + "-" + table + "-" + builtin)
+}
+
+// NFTablesCommands returns the nft commands equivalent to the batch applied by ReconcileNFTables on hosts without any
+// rules of the owner.
+func (s *RuleSet) NFTablesCommands() ([]string, error) {
+	var (
+		commands []string
+		families []nftables.TableFamily
+	)
+	for _, chain := range s.chains() {
+		family := nftFamily(chain.proto)
+		if !slices.Contains(families, family) {
+			families = append(families, family)
+			commands = append(commands, fmt.Sprintf("nft add table %s %s", nftFamilyName(family), NFTablesTable))
+		}
+		spec, ok := nftChainSpecs[chain.table][chain.builtin]
+		if !ok {
+			return nil, fmt.Errorf("chain %s of table %s is not supported by nftables", chain.builtin, chain.table)
+		}
+		name := s.nftChainName(chain.table, chain.builtin)
+		commands = append(commands, fmt.Sprintf("nft add chain %s %s %s { type %s hook %s priority %d; }",
+			nftFamilyName(family), NFTablesTable, name, spec.chainType, strings.ToLower(chain.builtin), *spec.priority))
+		for _, rule := range s.chainRules(chain) {
+			r, err := translateRule(rule)
+			if err != nil {
+				return nil, err
+			}
+			commands = append(commands, fmt.Sprintf("nft add rule %s %s %s %s comment %q", nftFamilyName(family), NFTablesTable, name, strings.Join(r.text, " "), ruleID(rule)))
+		}
+	}
+	return commands, nil
+}
+
+func nftFamilyName(family nftables.TableFamily) string {
+	if family == nftables.TableFamilyIPv6 {
+		return "ip6"
+	}
+	return "ip"
+}
+
+// ReconcileNFTables replaces the chains of the rule set owner in the nftables table NFTablesTable with the rule set.
+// All changes are applied in a single atomic batch. Chains of the owner without any rules are removed, and so is the
+// table once it has no chains left.
+func ReconcileNFTables(log logr.Logger, ruleSet *RuleSet, newNFTables NFTablesFactory) error {
+	conn, err := newNFTables()
+	if err != nil {
+		return err
+	}
+
+	for _, proto := range ruleSet.protocols {
+		family := nftFamily(proto)
+		table := &nftables.Table{Name: NFTablesTable, Family: family}
+		desired := slices.DeleteFunc(ruleSet.chains(), func(c ruleChain) bool { return c.proto != proto })
+
+		existing, err := conn.ListChainsOfTableFamily(family)
+		if err != nil {
+			return fmt.Errorf("failed to list nftables chains: %w", err)
+		}
+		desiredNames := make([]string, 0, len(desired))
+		for _, chain := range desired {
+			desiredNames = append(desiredNames, ruleSet.nftChainName(chain.table, chain.builtin))
+		}
+		remaining := 0
+		for _, chain := range existing {
+			if chain.Table == nil || chain.Table.Name != NFTablesTable {
+				continue
+			}
+			if !strings.HasPrefix(chain.Name, strings.ToLower(ruleSet.owner)+"-") || slices.Contains(desiredNames, chain.Name) {
+				remaining++
+				continue
+			}
+			log.Info("removing stale nftables chain", "family", nftFamilyName(family), "chain", chain.Name)
+			conn.FlushChain(chain)
+			conn.DelChain(chain)
+		}
+
+		if len(desired) == 0 {
+			if remaining == 0 {
+				if err := deleteNFTablesTable(log, conn, table); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		conn.AddTable(table)
+		for i, chain := range desired {
+			spec, ok := nftChainSpecs[chain.table][chain.builtin]
+			if !ok {
+				return fmt.Errorf("chain %s of table %s is not supported by nftables", chain.builtin, chain.table)
+			}
+			c := conn.AddChain(&nftables.Chain{
+				Name:     desiredNames[i],
+				Table:    table,
+				Type:     spec.chainType,
+				Hooknum:  spec.hook,
+				Priority: spec.priority,
+			})
+			conn.FlushChain(c)
+			for _, rule := range ruleSet.chainRules(chain) {
+				r, err := translateRule(rule)
+				if err != nil {
+					return err
+				}
+				conn.AddRule(&nftables.Rule{
+					Table:    table,
+					Chain:    c,
+					Exprs:    r.exprs,
+					UserData: userdata.AppendString(nil, userdata.TypeComment, ruleID(rule)),
+				})
+			}
+		}
+		log.Info("replacing nftables chains", "family", nftFamilyName(family), "chains", desiredNames)
+	}
+
+	if err := conn.Flush(); err != nil {
+		return fmt.Errorf("failed to apply nftables rules: %w", err)
+	}
+	return nil
+}
+
+// deleteNFTablesTable deletes the table if it exists.
+func deleteNFTablesTable(log logr.Logger, conn NFTables, table *nftables.Table) error {
+	tables, err := conn.ListTablesOfFamily(table.Family)
+	if err != nil {
+		return fmt.Errorf("failed to list nftables tables: %w", err)
+	}
+	if slices.ContainsFunc(tables, func(t *nftables.Table) bool { return t.Name == table.Name }) {
+		log.Info("removing empty nftables table", "family", nftFamilyName(table.Family), "table", table.Name)
+		conn.DelTable(table)
+	}
+	return nil
+}
+
+// nftRule is the nftables representation of an iptables rule, both as expressions and in nft syntax.
+type nftRule struct {
+	exprs []expr.Any
+	text  []string
+}
+
+func (r *nftRule) add(text string, exprs ...expr.Any) {
+	r.text = append(r.text, text)
+	r.exprs = append(r.exprs, exprs...)
+}
+
+// tcpFlags are the bits of the TCP flags in the TCP header.
+var tcpFlags = map[string]byte{"FIN": 0x01, "SYN": 0x02, "RST": 0x04, "PSH": 0x08, "ACK": 0x10, "URG": 0x20}
+
+// ctStates are the bits of the conntrack states.
+var ctStates = map[string]uint32{
+	"INVALID":     expr.CtStateBitINVALID,
+	"ESTABLISHED": expr.CtStateBitESTABLISHED,
+	"RELATED":     expr.CtStateBitRELATED,
+	"NEW":         expr.CtStateBitNEW,
+}
+
+// translateRule translates the iptables rule specification used by the rule generators to nftables.
+// Only the matches and targets used by the generators are supported.
+func translateRule(rule IPTablesRule) (nftRule, error) {
+	var (
+		r      nftRule
+		target nftRule
+	)
+	spec := rule.RuleSpec
+	next := func(i int) (string, error) {
+		if i+1 >= len(spec) {
+			return "", fmt.Errorf("missing value for %s in rule %q", spec[i], rule.String())
+		}
+		return spec[i+1], nil
+	}
+
+	for i := 0; i < len(spec); i++ {
+		option := spec[i]
+		if option == "--clamp-mss-to-pmtu" {
+			target.add("tcp option maxseg size set rt mtu",
+				&expr.Rt{Register: 1, Key: expr.RtTCPMSS},
+				&expr.Byteorder{SourceRegister: 1, DestRegister: 1, Op: expr.ByteorderHton, Len: 2, Size: 2},
+				&expr.Exthdr{SourceRegister: 1, Type: 2, Offset: 2, Len: 2, Op: expr.ExthdrOpTcpopt},
+			)
+			continue
+		}
+		value, err := next(i)
+		if err != nil {
+			return r, err
+		}
+		i++
+		switch option {
+		case "-m":
+			if !slices.Contains([]string{"comment", "state", "owner"}, value) {
+				return r, fmt.Errorf("unsupported match %s in rule %q", value, rule.String())
+			}
+		case "--comment":
+			// rules are identified by their rule id
+		case "-i", "--in-interface":
+			r.add(fmt.Sprintf("iifname %q", nftInterfaceName(value)), nftInterfaceMatch(expr.MetaKeyIIFNAME, value)...)
+		case "-o", "--out-interface":
+			r.add(fmt.Sprintf("oifname %q", nftInterfaceName(value)), nftInterfaceMatch(expr.MetaKeyOIFNAME, value)...)
+		case "-s", "-d":
+			exprs, err := nftAddressMatch(rule.Protocol, option == "-s", value)
+			if err != nil {
+				return r, err
+			}
+			field := map[bool]string{true: "saddr", false: "daddr"}[option == "-s"]
+			r.add(fmt.Sprintf("%s %s %s", nftFamilyName(nftFamily(rule.Protocol)), field, value), exprs...)
+		case "-p":
+			protocols := map[string]byte{"tcp": unix.IPPROTO_TCP, "udp": unix.IPPROTO_UDP, "icmpv6": unix.IPPROTO_ICMPV6}
+			p, ok := protocols[value]
+			if !ok {
+				return r, fmt.Errorf("unsupported protocol %s in rule %q", value, rule.String())
+			}
+			r.add("meta l4proto "+value,
+				&expr.Meta{Key: expr.MetaKeyL4PROTO, Register: 1},
+				&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: []byte{p}},
+			)
+		case "--tcp-flags":
+			comparison, err := next(i)
+			if err != nil {
+				return r, err
+			}
+			i++
+			mask, err := nftTCPFlags(value)
+			if err != nil {
+				return r, err
+			}
+			set, err := nftTCPFlags(comparison)
+			if err != nil {
+				return r, err
+			}
+			r.add(fmt.Sprintf("tcp flags & (%s) == %s", strings.ReplaceAll(strings.ToLower(value), ",", " | "), strings.ReplaceAll(strings.ToLower(comparison), ",", " | ")),
+				&expr.Payload{DestRegister: 1, Base: expr.PayloadBaseTransportHeader, Offset: 13, Len: 1},
+				&expr.Bitwise{SourceRegister: 1, DestRegister: 1, Len: 1, Mask: []byte{mask}, Xor: []byte{0}},
+				&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: []byte{set}},
+			)
+		case "--state":
+			var bits uint32
+			for _, state := range strings.Split(value, ",") {
+				bit, ok := ctStates[state]
+				if !ok {
+					return r, fmt.Errorf("unsupported state %s in rule %q", state, rule.String())
+				}
+				bits |= bit
+			}
+			r.add("ct state "+strings.ToLower(value),
+				&expr.Ct{Register: 1, Key: expr.CtKeySTATE},
+				&expr.Bitwise{SourceRegister: 1, DestRegister: 1, Len: 4, Mask: binaryutil.NativeEndian.PutUint32(bits), Xor: binaryutil.NativeEndian.PutUint32(0)},
+				&expr.Cmp{Op: expr.CmpOpNeq, Register: 1, Data: binaryutil.NativeEndian.PutUint32(0)},
+			)
+		case "--gid-owner":
+			gid, err := strconv.ParseUint(value, 10, 32)
+			if err != nil {
+				return r, fmt.Errorf("invalid gid %s in rule %q: %w", value, rule.String(), err)
+			}
+			r.add("meta skgid "+value,
+				&expr.Meta{Key: expr.MetaKeySKGID, Register: 1},
+				&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: binaryutil.NativeEndian.PutUint32(uint32(gid))},
+			)
+		case "-j":
+			switch value {
+			case "ACCEPT":
+				target.add("accept", &expr.Verdict{Kind: expr.VerdictAccept})
+			case "DROP":
+				target.add("drop", &expr.Verdict{Kind: expr.VerdictDrop})
+			case "MASQUERADE":
+				target.add("masquerade", &expr.Masq{})
+			case "NETMAP", "TCPMSS":
+				// handled by the target options
+			default:
+				return r, fmt.Errorf("unsupported target %s in rule %q", value, rule.String())
+			}
+		case "--to":
+			exprs, text, err := nftNetmap(rule, value)
+			if err != nil {
+				return r, err
+			}
+			target.add(text, exprs...)
+		default:
+			return r, fmt.Errorf("unsupported option %s in rule %q", option, rule.String())
+		}
+	}
+
+	if len(target.exprs) == 0 {
+		return r, fmt.Errorf("missing target in rule %q", rule.String())
+	}
+	r.add(strings.Join(target.text, " "), target.exprs...)
+	return r, nil
+}
+
+// nftInterfaceName converts an iptables interface name to nftables syntax, i.e. the wildcard `+` becomes `*`.
+func nftInterfaceName(name string) string {
+	if prefix, ok := strings.CutSuffix(name, "+"); ok {
+		return prefix + "*"
+	}
+	return name
+}
+
+func nftInterfaceMatch(key expr.MetaKey, name string) []expr.Any {
+	data := []byte(name + "\x00")
+	if prefix, ok := strings.CutSuffix(name, "+"); ok {
+		// compare the prefix only
+		data = []byte(prefix)
+	}
+	return []expr.Any{
+		&expr.Meta{Key: key, Register: 1},
+		&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: data},
+	}
+}
+
+func nftAddressMatch(proto iptables.Protocol, source bool, cidr string) ([]expr.Any, error) {
+	_, ipnet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid network %s: %w", cidr, err)
+	}
+	ip := ipnet.IP.To4()
+	offset := map[bool]uint32{true: 12, false: 16}[source]
+	if proto == iptables.ProtocolIPv6 {
+		ip = ipnet.IP.To16()
+		offset = map[bool]uint32{true: 8, false: 24}[source]
+	}
+	if ip == nil {
+		return nil, fmt.Errorf("network %s does not match protocol %s", cidr, iptablesCommand(proto))
+	}
+	// #nosec: G115 -- length of an IP address
+	length := uint32(len(ip))
+	return []expr.Any{
+		&expr.Payload{DestRegister: 1, Base: expr.PayloadBaseNetworkHeader, Offset: offset, Len: length},
+		&expr.Bitwise{SourceRegister: 1, DestRegister: 1, Len: length, Mask: ipnet.Mask, Xor: make([]byte, length)},
+		&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: ip},
+	}, nil
+}
+
+func nftTCPFlags(flags string) (byte, error) {
+	var bits byte
+	for _, flag := range strings.Split(flags, ",") {
+		bit, ok := tcpFlags[flag]
+		if !ok {
+			return 0, fmt.Errorf("unsupported tcp flag %s", flag)
+		}
+		bits |= bit
+	}
+	return bits, nil
+}
+
+// nftNetmap translates the NETMAP target. It maps destination addresses in the PREROUTING and OUTPUT chains and
+// source addresses otherwise.
+func nftNetmap(rule IPTablesRule, cidr string) ([]expr.Any, string, error) {
+	_, ipnet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid network %s in rule %q: %w", cidr, rule.String(), err)
+	}
+	first := ipnet.IP.To4()
+	family := uint32(unix.NFPROTO_IPV4)
+	if rule.Protocol == iptables.ProtocolIPv6 {
+		first = ipnet.IP.To16()
+		family = unix.NFPROTO_IPV6
+	}
+	last := make(net.IP, len(first))
+	for i := range first {
+		last[i] = first[i] | ^ipnet.Mask[i]
+	}
+
+	natType, text := expr.NATTypeSourceNAT, "snat"
+	if rule.Chain == "PREROUTING" || rule.Chain == "OUTPUT" {
+		natType, text = expr.NATTypeDestNAT, "dnat"
+	}
+	return []expr.Any{
+		&expr.Immediate{Register: 1, Data: first},
+		&expr.Immediate{Register: 2, Data: last},
+		&expr.NAT{Type: natType, Family: family, RegAddrMin: 1, RegAddrMax: 2, Prefix: true},
+	}, fmt.Sprintf("%s %s prefix to %s", text, nftFamilyName(nftFamily(rule.Protocol)), cidr), nil
+}
+
+// ReconcileFirewall reconciles the rule set on the host using the given firewall backend.
+func ReconcileFirewall(log logr.Logger, ruleSet *RuleSet, backend string) error {
+	switch backend {
+	case constants.FirewallBackendNFTables:
+		return ReconcileNFTables(log, ruleSet, HostNFTables)
+	case constants.FirewallBackendIPTables, "":
+		return ReconcileIPTables(log, ruleSet, HostIPTables)
+	default:
+		return fmt.Errorf("unknown firewall backend %q", backend)
+	}
+}
+
+// RemoveFirewall removes all chains of the owner with the given firewall backend. The chains are also removed with the
+// other backends, so that rules set up before the backend was switched are removed as well. As the other backends may
+// not be usable on the host, e.g. without iptables binaries, their errors are only logged.
+func RemoveFirewall(log logr.Logger, owner, backend string) error {
+	// an empty rule set removes all chains of the owner
+	ruleSet := NewRuleSet(owner)
+	if err := ReconcileFirewall(log, ruleSet, backend); err != nil {
+		return fmt.Errorf("failed to remove %s rules of %s: %w", backend, owner, err)
+	}
+	for _, other := range constants.FirewallBackends {
+		if other == backend {
+			continue
+		}
+		if err := ReconcileFirewall(log, ruleSet, other); err != nil {
+			log.Info("failed to remove rules of the other firewall backend", "owner", owner, "backend", other, "error", err)
+		}
+	}
+	return nil
+}
+
+// FirewallCommands returns the commands to set up the rule set with the given firewall backend on hosts without any
+// rules of the owner.
+func FirewallCommands(ruleSet *RuleSet, backend string) ([]string, error) {
+	if backend == constants.FirewallBackendNFTables {
+		return ruleSet.NFTablesCommands()
+	}
+	return ruleSet.Commands(), nil
+}
@@ -0,0 +1,264 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package network
+
+import (
+	"fmt"
+	"net"
+	"slices"
+
+	"github.com/coreos/go-iptables/iptables"
+	"github.com/go-logr/logr"
+	"github.com/google/nftables"
+	"github.com/google/nftables/expr"
+	"github.com/google/nftables/userdata"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// fakeNFTables keeps the chains and rules in memory. Changes are queued and only applied by Flush.
+type fakeNFTables struct {
+	tables  []*nftables.Table
+	chains  []*nftables.Chain
+	rules   map[*nftables.Chain][]*nftables.Rule
+	pending []func()
+	flushes int
+}
+
+func newFakeNFTables() *fakeNFTables {
+	return &fakeNFTables{rules: map[*nftables.Chain][]*nftables.Rule{}}
+}
+
+func (f *fakeNFTables) lookup(family nftables.TableFamily, name string) *nftables.Chain {
+	for _, c := range f.chains {
+		if c.Table.Family == family && c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+func (f *fakeNFTables) AddTable(t *nftables.Table) *nftables.Table {
+	f.pending = append(f.pending, func() {
+		if !slices.ContainsFunc(f.tables, func(e *nftables.Table) bool { return e.Family == t.Family && e.Name == t.Name }) {
+			f.tables = append(f.tables, t)
+		}
+	})
+	return t
+}
+
+func (f *fakeNFTables) DelTable(t *nftables.Table) {
+	f.pending = append(f.pending, func() {
+		f.tables = slices.DeleteFunc(f.tables, func(e *nftables.Table) bool { return e.Family == t.Family && e.Name == t.Name })
+	})
+}
+
+func (f *fakeNFTables) ListTablesOfFamily(family nftables.TableFamily) ([]*nftables.Table, error) {
+	var tables []*nftables.Table
+	for _, t := range f.tables {
+		if t.Family == family {
+			tables = append(tables, t)
+		}
+	}
+	return tables, nil
+}
+
+func (f *fakeNFTables) ListChainsOfTableFamily(family nftables.TableFamily) ([]*nftables.Chain, error) {
+	var chains []*nftables.Chain
+	for _, c := range f.chains {
+		if c.Table.Family == family {
+			chains = append(chains, c)
+		}
+	}
+	return chains, nil
+}
+
+func (f *fakeNFTables) AddChain(c *nftables.Chain) *nftables.Chain {
+	f.pending = append(f.pending, func() {
+		if f.lookup(c.Table.Family, c.Name) == nil {
+			f.chains = append(f.chains, c)
+		}
+	})
+	return c
+}
+
+func (f *fakeNFTables) FlushChain(c *nftables.Chain) {
+	f.pending = append(f.pending, func() {
+		delete(f.rules, f.lookup(c.Table.Family, c.Name))
+	})
+}
+
+func (f *fakeNFTables) DelChain(c *nftables.Chain) {
+	f.pending = append(f.pending, func() {
+		f.chains = slices.DeleteFunc(f.chains, func(e *nftables.Chain) bool {
+			return e.Table.Family == c.Table.Family && e.Name == c.Name
+		})
+	})
+}
+
+func (f *fakeNFTables) AddRule(r *nftables.Rule) *nftables.Rule {
+	f.pending = append(f.pending, func() {
+		c := f.lookup(r.Chain.Table.Family, r.Chain.Name)
+		f.rules[c] = append(f.rules[c], r)
+	})
+	return r
+}
+
+func (f *fakeNFTables) Flush() error {
+	f.flushes++
+	for _, op := range f.pending {
+		op()
+	}
+	f.pending = nil
+	return nil
+}
+
+var _ = Describe("NFTables", func() {
+	var (
+		log  logr.Logger
+		conn *fakeNFTables
+	)
+
+	factory := func() (NFTables, error) {
+		return conn, nil
+	}
+
+	ruleSet := func(networks ...string) *RuleSet {
+		rules := NewRuleSet("VPN-TEST")
+		for _, nw := range networks {
+			rules.Add(iptables.ProtocolIPv4, "nat", "POSTROUTING", "-s", nw, "-j", "MASQUERADE")
+		}
+		rules.Add(iptables.ProtocolIPv6, "filter", "INPUT", "-i", "tun0", "-j", "DROP")
+		return rules
+	}
+
+	comments := func(family nftables.TableFamily, name string) []string {
+		var result []string
+		for _, rule := range conn.rules[conn.lookup(family, name)] {
+			comment, ok := userdata.GetString(rule.UserData, userdata.TypeComment)
+			Expect(ok).To(BeTrue())
+			result = append(result, comment)
+		}
+		return result
+	}
+
+	BeforeEach(func() {
+		log = logr.Discard()
+		conn = newFakeNFTables()
+	})
+
+	It("should render the nft commands to set up the rule set", func() {
+		rules := NewRuleSet("VPN-TEST")
+		rules.Add(iptables.ProtocolIPv4, "filter", "FORWARD", "--in-interface", "bond0+", "-j", "ACCEPT")
+		rules.Add(iptables.ProtocolIPv4, "nat", "PREROUTING", "--in-interface", "tun0", "-d", "244.0.0.0/8", "-j", "NETMAP", "--to", "10.0.0.0/8")
+		rules.Add(iptables.ProtocolIPv4, "nat", "OUTPUT", "-m", "owner", "--gid-owner", "31415", "-d", "10.0.0.0/8", "-j", "NETMAP", "--to", "244.0.0.0/8")
+		rules.Add(iptables.ProtocolIPv6, "mangle", "POSTROUTING", "-p", "tcp", "--tcp-flags", "SYN,RST", "SYN", "-j", "TCPMSS", "--clamp-mss-to-pmtu")
+		rules.Add(iptables.ProtocolIPv6, "filter", "INPUT", "-m", "state", "--state", "RELATED,ESTABLISHED", "-i", "tun0", "-j", "ACCEPT")
+
+		commands, err := rules.NFTablesCommands()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(commands).To(Equal([]string{
+			"nft add table ip vpn2",
+			"nft add chain ip vpn2 vpn-test-filter-forward { type filter hook forward priority 0; }",
+			`nft add rule ip vpn2 vpn-test-filter-forward iifname "bond0*" accept comment "` + ruleID(rules.Rules()[0]) + `"`,
+			"nft add chain ip vpn2 vpn-test-nat-prerouting { type nat hook prerouting priority -100; }",
+			`nft add rule ip vpn2 vpn-test-nat-prerouting iifname "tun0" ip daddr 244.0.0.0/8 dnat ip prefix to 10.0.0.0/8 comment "` + ruleID(rules.Rules()[1]) + `"`,
+			"nft add chain ip vpn2 vpn-test-nat-output { type nat hook output priority -100; }",
+			`nft add rule ip vpn2 vpn-test-nat-output meta skgid 31415 ip daddr 10.0.0.0/8 dnat ip prefix to 244.0.0.0/8 comment "` + ruleID(rules.Rules()[2]) + `"`,
+			"nft add table ip6 vpn2",
+			"nft add chain ip6 vpn2 vpn-test-mangle-postrouting { type filter hook postrouting priority -150; }",
+			`nft add rule ip6 vpn2 vpn-test-mangle-postrouting meta l4proto tcp tcp flags & (syn | rst) == syn tcp option maxseg size set rt mtu comment "` + ruleID(rules.Rules()[3]) + `"`,
+			"nft add chain ip6 vpn2 vpn-test-filter-input { type filter hook input priority 0; }",
+			`nft add rule ip6 vpn2 vpn-test-filter-input ct state related,established iifname "tun0" accept comment "` + ruleID(rules.Rules()[4]) + `"`,
+		}))
+	})
+
+	It("should use the types and priorities of the iptables-nft base chains for all built-in chains", func() {
+		expected := map[string]map[string]string{
+			"filter": {"INPUT": "filter 0", "FORWARD": "filter 0", "OUTPUT": "filter 0"},
+			"nat":    {"PREROUTING": "nat -100", "INPUT": "nat 100", "OUTPUT": "nat -100", "POSTROUTING": "nat 100"},
+			"mangle": {"PREROUTING": "filter -150", "INPUT": "filter -150", "FORWARD": "filter -150", "OUTPUT": "route -150", "POSTROUTING": "filter -150"},
+		}
+		for table, chains := range builtinChains {
+			Expect(nftChainSpecs[table]).To(HaveLen(len(chains)), table)
+			for _, chain := range chains {
+				spec, ok := nftChainSpecs[table][chain]
+				Expect(ok).To(BeTrue(), table+" "+chain)
+				Expect(fmt.Sprintf("%s %d", spec.chainType, *spec.priority)).To(Equal(expected[table][chain]), table+" "+chain)
+			}
+		}
+	})
+
+	It("should translate NETMAP to a prefix NAT of the whole network", func() {
+		r, err := translateRule(IPTablesRule{
+			Protocol: iptables.ProtocolIPv4,
+			Table:    "nat",
+			Chain:    "POSTROUTING",
+			RuleSpec: []string{"--out-interface", "tun0", "-s", "10.0.0.0/8", "-j", "NETMAP", "--to", "244.0.0.0/8"},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.exprs[len(r.exprs)-3:]).To(Equal([]expr.Any{
+			&expr.Immediate{Register: 1, Data: net.IPv4(244, 0, 0, 0).To4()},
+			&expr.Immediate{Register: 2, Data: net.IPv4(244, 255, 255, 255).To4()},
+			&expr.NAT{Type: expr.NATTypeSourceNAT, Family: 2, RegAddrMin: 1, RegAddrMax: 2, Prefix: true},
+		}))
+	})
+
+	It("should reject unsupported rule specifications", func() {
+		_, err := translateRule(IPTablesRule{Protocol: iptables.ProtocolIPv4, Table: "filter", Chain: "INPUT", RuleSpec: []string{"--dport", "22", "-j", "DROP"}})
+		Expect(err).To(MatchError(ContainSubstring("unsupported option --dport")))
+		_, err = translateRule(IPTablesRule{Protocol: iptables.ProtocolIPv4, Table: "filter", Chain: "INPUT", RuleSpec: []string{"-i", "tun0"}})
+		Expect(err).To(MatchError(ContainSubstring("missing target")))
+	})
+
+	It("should create base chains in the vpn2 table in a single batch", func() {
+		rules := ruleSet("10.0.0.0/8", "192.168.0.0/16")
+		Expect(ReconcileNFTables(log, rules, factory)).To(Succeed())
+
+		Expect(conn.flushes).To(Equal(1))
+		chain := conn.lookup(nftables.TableFamilyIPv4, "vpn-test-nat-postrouting")
+		Expect(chain).NotTo(BeNil())
+		Expect(chain.Table.Name).To(Equal(NFTablesTable))
+		Expect(chain.Type).To(Equal(nftables.ChainTypeNAT))
+		Expect(chain.Hooknum).To(Equal(nftables.ChainHookPostrouting))
+		Expect(comments(nftables.TableFamilyIPv4, "vpn-test-nat-postrouting")).To(Equal([]string{
+			ruleID(rules.Rules()[0]),
+			ruleID(rules.Rules()[1]),
+		}))
+		Expect(comments(nftables.TableFamilyIPv6, "vpn-test-filter-input")).To(Equal([]string{ruleID(rules.Rules()[2])}))
+	})
+
+	It("should replace the rules of existing chains", func() {
+		Expect(ReconcileNFTables(log, ruleSet("10.0.0.0/8", "172.16.0.0/12"), factory)).To(Succeed())
+		desired := ruleSet("192.168.0.0/16")
+
+		Expect(ReconcileNFTables(log, desired, factory)).To(Succeed())
+		Expect(comments(nftables.TableFamilyIPv4, "vpn-test-nat-postrouting")).To(Equal([]string{ruleID(desired.Rules()[0])}))
+	})
+
+	It("should remove stale chains of the owner and keep foreign chains", func() {
+		Expect(ReconcileNFTables(log, ruleSet("10.0.0.0/8"), factory)).To(Succeed())
+		foreign := &nftables.Chain{Name: "vpn-other-nat-postrouting", Table: &nftables.Table{Name: NFTablesTable, Family: nftables.TableFamilyIPv4}}
+		conn.chains = append(conn.chains, foreign)
+
+		Expect(ReconcileNFTables(log, NewRuleSet("VPN-TEST"), factory)).To(Succeed())
+		Expect(conn.lookup(nftables.TableFamilyIPv4, "vpn-test-nat-postrouting")).To(BeNil())
+		Expect(conn.lookup(nftables.TableFamilyIPv6, "vpn-test-filter-input")).To(BeNil())
+		Expect(conn.chains).To(ConsistOf(foreign))
+		Expect(conn.tables).To(ConsistOf(HaveField("Family", nftables.TableFamilyIPv4)))
+	})
+
+	It("should remove the table once it has no chains left", func() {
+		Expect(ReconcileNFTables(log, ruleSet("10.0.0.0/8"), factory)).To(Succeed())
+		Expect(conn.tables).To(HaveLen(2))
+
+		Expect(ReconcileNFTables(log, NewRuleSet("VPN-TEST"), factory)).To(Succeed())
+		Expect(conn.tables).To(BeEmpty())
+		Expect(conn.chains).To(BeEmpty())
+
+		Expect(ReconcileNFTables(log, NewRuleSet("VPN-TEST"), factory)).To(Succeed())
+		Expect(conn.tables).To(BeEmpty())
+	})
+})
@@ -4,11 +4,13 @@
 package network
 
 import (
+	"errors"
 	"fmt"
 	"net"
 
 	"github.com/go-logr/logr"
 	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
 )
 
 func getDefaultRoute() (*netlink.Route, error) {
@@ -54,3 +56,30 @@ func ReplaceRoute(log logr.Logger, ipnet *net.IPNet, dev netlink.Link) error {
 	}
 	return nil
 }
+
+// DeleteRoute deletes the route for the network via the device. A missing route is not an error.
+func DeleteRoute(log logr.Logger, ipnet *net.IPNet, dev netlink.Link) error {
+	route := routeForNetwork(ipnet, dev)
+	log.Info("deleting route", "route", route, "ipnet", ipnet)
+	if err := netlink.RouteDel(&route); err != nil && !errors.Is(err, unix.ESRCH) {
+		return fmt.Errorf("error deleting route for %s: %w", ipnet, err)
+	}
+	return nil
+}
+
+// RoutedNetworks returns the destinations of the static routes via the device, i.e. the routes which have not been
+// added by the kernel for the addresses of the device.
+func RoutedNetworks(dev netlink.Link) ([]CIDR, error) {
+	routes, err := netlink.RouteList(dev, netlink.FAMILY_ALL)
+	if err != nil {
+		return nil, fmt.Errorf("error listing routes of %s: %w", dev.Attrs().Name, err)
+	}
+	var networks []CIDR
+	for _, route := range routes {
+		if route.Dst == nil || route.Protocol == unix.RTPROT_KERNEL {
+			continue
+		}
+		networks = append(networks, CIDR(*route.Dst))
+	}
+	return networks, nil
+}
@@ -0,0 +1,284 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package network
+
+import (
+	"fmt"
+	"hash/fnv"
+	"slices"
+	"strings"
+
+	"github.com/coreos/go-iptables/iptables"
+	"github.com/go-logr/logr"
+)
+
+// ruleTables are the tables searched for stale chains of an owner.
+var ruleTables = []string{"filter", "nat", "mangle"}
+
+// builtinChains are the built-in chains of the rule tables, which the dedicated chains of an owner are jumped to from.
+var builtinChains = map[string][]string{
+	"filter": {"INPUT", "FORWARD", "OUTPUT"},
+	"nat":    {"PREROUTING", "INPUT", "OUTPUT", "POSTROUTING"},
+	"mangle": {"PREROUTING", "INPUT", "FORWARD", "OUTPUT", "POSTROUTING"},
+}
+
+// RuleSet is the complete set of iptables rules owned by a component.
+// The rules are added for built-in chains, but are kept in dedicated chains named `<owner>-<built-in chain>`,
+// which are jumped to from the built-in chains. This allows to reconcile them without touching foreign rules.
+type RuleSet struct {
+	owner     string
+	protocols []iptables.Protocol
+	rules     []IPTablesRule
+}
+
+// NewRuleSet creates an empty rule set for the given owner, e.g. `VPN-CLIENT`.
+// Chains of the owner are reconciled for both IPv4 and IPv6, so that the chains of a protocol without rules, e.g. after
+// a change of the IP families, are removed as well.
+func NewRuleSet(owner string) *RuleSet {
+	return &RuleSet{owner: owner, protocols: []iptables.Protocol{iptables.ProtocolIPv4, iptables.ProtocolIPv6}}
+}
+
+// Add appends a rule to the given built-in chain. Duplicate rules are ignored.
+func (s *RuleSet) Add(proto iptables.Protocol, table, chain string, rulespec ...string) {
+	rule := IPTablesRule{Protocol: proto, Table: table, Chain: chain, RuleSpec: rulespec}
+	if !slices.ContainsFunc(s.rules, func(r IPTablesRule) bool { return r.String() == rule.String() }) {
+		s.rules = append(s.rules, rule)
+	}
+	if !slices.Contains(s.protocols, proto) {
+		s.protocols = append(s.protocols, proto)
+	}
+}
+
+// Rules returns the rules in the order they have been added with their built-in chains.
+func (s *RuleSet) Rules() []IPTablesRule {
+	return s.rules
+}
+
+// Chain returns the name of the dedicated chain for the given built-in chain.
+func (s *RuleSet) Chain(builtin string) string {
+	return s.owner + "-" + builtin
+}
+
+// Commands returns the iptables commands to set up the rule set on hosts without any rules of the owner.
+func (s *RuleSet) Commands() []string {
+	var commands []string
+	for _, chain := range s.chains() {
+		cmd := fmt.Sprintf("%s -t %s", iptablesCommand(chain.proto), chain.table)
+		commands = append(commands, fmt.Sprintf("%s -N %s", cmd, s.Chain(chain.builtin)))
+		for _, rule := range s.chainRules(chain) {
+			commands = append(commands, fmt.Sprintf("%s -A %s %s", cmd, s.Chain(chain.builtin), strings.Join(ruleSpecWithID(rule), " ")))
+		}
+		commands = append(commands, fmt.Sprintf("%s -A %s -j %s", cmd, chain.builtin, s.Chain(chain.builtin)))
+	}
+	return commands
+}
+
+type ruleChain struct {
+	proto   iptables.Protocol
+	table   string
+	builtin string
+}
+
+// chains returns the chains used by the rules in the order of their first usage.
+func (s *RuleSet) chains() []ruleChain {
+	var chains []ruleChain
+	for _, rule := range s.rules {
+		chain := ruleChain{proto: rule.Protocol, table: rule.Table, builtin: rule.Chain}
+		if !slices.Contains(chains, chain) {
+			chains = append(chains, chain)
+		}
+	}
+	return chains
+}
+
+func (s *RuleSet) chainRules(chain ruleChain) []IPTablesRule {
+	var rules []IPTablesRule
+	for _, rule := range s.rules {
+		if rule.Protocol == chain.proto && rule.Table == chain.table && rule.Chain == chain.builtin {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+// ruleID identifies a rule in the live tables independent of how iptables normalizes its specification.
+func ruleID(rule IPTablesRule) string {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(strings.Join(append([]string{rule.Table, rule.Chain}, rule.RuleSpec...), " ")))
+	return fmt.Sprintf("vpn2-%08x", h.Sum32())
+}
+
+// ruleSpecWithID returns the rule specification tagged with the id of the rule as comment.
+func ruleSpecWithID(rule IPTablesRule) []string {
+	return append([]string{"-m", "comment", "--comment", ruleID(rule)}, rule.RuleSpec...)
+}
+
+// liveRuleID extracts the id from a rule as listed by `iptables -S`, or returns an empty string if there is none.
+func liveRuleID(line string) string {
+	fields := strings.Fields(line)
+	for i, field := range fields {
+		if field == "--comment" && i+1 < len(fields) {
+			return strings.Trim(fields[i+1], `"`)
+		}
+	}
+	return ""
+}
+
+// ReconcileIPTables makes the chains of the rule set owner match the rule set.
+// Missing rules are added at their position, rules not part of the rule set are removed, and chains of the owner
+// without any rules are removed completely. Rules in chains not owned by the rule set are never modified.
+func ReconcileIPTables(log logr.Logger, ruleSet *RuleSet, newIPTables IPTablesFactory) error {
+	for _, proto := range ruleSet.protocols {
+		ipTable, err := newIPTables(log, proto)
+		if err != nil {
+			return err
+		}
+		if err := reconcileProtocol(log, ruleSet, proto, ipTable); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func reconcileProtocol(log logr.Logger, ruleSet *RuleSet, proto iptables.Protocol, ipTable IPTables) error {
+	desired := slices.DeleteFunc(ruleSet.chains(), func(c ruleChain) bool { return c.proto != proto })
+
+	for _, table := range ruleTables {
+		chains, err := ipTable.ListChains(table)
+		if err != nil {
+			return fmt.Errorf("failed to list chains of table %s: %w", table, err)
+		}
+		for _, chain := range chains {
+			builtin, ok := strings.CutPrefix(chain, ruleSet.owner+"-")
+			// only chains named after a built-in chain of the table are dedicated chains of the owner
+			if !ok || !slices.Contains(builtinChains[table], builtin) || slices.Contains(desired, ruleChain{proto: proto, table: table, builtin: builtin}) {
+				continue
+			}
+			log.Info("removing stale iptables chain", "protocol", iptablesCommand(proto), "table", table, "chain", chain)
+			if err := ipTable.DeleteIfExists(table, builtin, "-j", chain); err != nil {
+				return fmt.Errorf("failed to remove jump to chain %s in table %s: %w", chain, table, err)
+			}
+			if err := ipTable.ClearAndDeleteChain(table, chain); err != nil {
+				return fmt.Errorf("failed to delete chain %s in table %s: %w", chain, table, err)
+			}
+		}
+	}
+
+	for _, chain := range desired {
+		dedicated := ruleSet.Chain(chain.builtin)
+		exists, err := ipTable.ChainExists(chain.table, dedicated)
+		if err != nil {
+			return fmt.Errorf("failed to check chain %s in table %s: %w", dedicated, chain.table, err)
+		}
+		if !exists {
+			// the rules have been added to the built-in chains before dedicated chains were introduced
+			if err := removeLegacyRules(log, ipTable, chain.table, chain.builtin, ruleSet.chainRules(chain)); err != nil {
+				return err
+			}
+			if err := ipTable.NewChain(chain.table, dedicated); err != nil {
+				return fmt.Errorf("failed to create chain %s in table %s: %w", dedicated, chain.table, err)
+			}
+		}
+		if err := reconcileChain(log, ipTable, chain.table, dedicated, ruleSet.chainRules(chain)); err != nil {
+			return err
+		}
+		if err := ipTable.AppendUnique(chain.table, chain.builtin, "-j", dedicated); err != nil {
+			return fmt.Errorf("failed to add jump to chain %s in table %s: %w", dedicated, chain.table, err)
+		}
+	}
+	return nil
+}
+
+// removeLegacyRules removes the rules from the built-in chain, which have been appended there directly by former
+// versions. As these versions did not tag their rules, only the exact rule specifications of the rule set are removed,
+// including duplicates.
+func removeLegacyRules(log logr.Logger, ipTable IPTables, table, builtin string, rules []IPTablesRule) error {
+	for _, rule := range rules {
+		for {
+			exists, err := ipTable.Exists(table, builtin, rule.RuleSpec...)
+			if err != nil {
+				return fmt.Errorf("failed to check legacy rule %q: %w", rule.String(), err)
+			}
+			if !exists {
+				break
+			}
+			log.Info("removing legacy iptables rule", "rule", rule.String())
+			if err := ipTable.DeleteIfExists(table, builtin, rule.RuleSpec...); err != nil {
+				return fmt.Errorf("failed to remove legacy rule %q: %w", rule.String(), err)
+			}
+		}
+	}
+	return nil
+}
+
+// reconcileChain removes stale rules from the chain and inserts missing ones at their position.
+func reconcileChain(log logr.Logger, ipTable IPTables, table, chain string, rules []IPTablesRule) error {
+	lines, err := ipTable.List(table, chain)
+	if err != nil {
+		return fmt.Errorf("failed to list chain %s in table %s: %w", chain, table, err)
+	}
+
+	desiredIDs := make([]string, 0, len(rules))
+	for _, rule := range rules {
+		desiredIDs = append(desiredIDs, ruleID(rule))
+	}
+
+	var (
+		kept  []string
+		stale []int
+	)
+	pos := 0
+	for _, line := range lines {
+		if !strings.HasPrefix(line, "-A ") {
+			continue
+		}
+		pos++
+		id := liveRuleID(line)
+		if !slices.Contains(desiredIDs, id) || slices.Contains(kept, id) {
+			log.Info("removing stale iptables rule", "table", table, "rule", line)
+			stale = append(stale, pos)
+			continue
+		}
+		kept = append(kept, id)
+	}
+	// delete from the end to keep the positions of the remaining stale rules
+	for _, p := range slices.Backward(stale) {
+		if err := ipTable.DeleteById(table, chain, p); err != nil {
+			return fmt.Errorf("failed to delete rule %d of chain %s in table %s: %w", p, chain, table, err)
+		}
+	}
+
+	if !isSubsequence(kept, desiredIDs) {
+		log.Info("rebuilding iptables chain with unexpected rule order", "table", table, "chain", chain)
+		if err := ipTable.ClearChain(table, chain); err != nil {
+			return fmt.Errorf("failed to clear chain %s in table %s: %w", chain, table, err)
+		}
+		kept = nil
+	}
+
+	k := 0
+	for i, rule := range rules {
+		if k < len(kept) && kept[k] == desiredIDs[i] {
+			k++
+			continue
+		}
+		log.Info("adding iptables rule", "rule", rule.String())
+		if err := ipTable.Insert(table, chain, i+1, ruleSpecWithID(rule)...); err != nil {
+			return fmt.Errorf("failed to insert rule %q: %w", rule.String(), err)
+		}
+	}
+	return nil
+}
+
+// isSubsequence returns true if all elements of sub appear in seq in the same order.
+func isSubsequence(sub, seq []string) bool {
+	i := 0
+	for _, s := range seq {
+		if i < len(sub) && sub[i] == s {
+			i++
+		}
+	}
+	return i == len(sub)
+}
@@ -0,0 +1,302 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package network
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/coreos/go-iptables/iptables"
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// fakeIPTables keeps the rules of each chain in memory as listed by `iptables -S`.
+type fakeIPTables struct {
+	tables map[string]map[string][]string
+	calls  int
+}
+
+func newFakeIPTables() *fakeIPTables {
+	return &fakeIPTables{tables: map[string]map[string][]string{
+		"filter": {"INPUT": nil, "FORWARD": nil, "OUTPUT": nil},
+		"nat":    {"PREROUTING": nil, "INPUT": nil, "OUTPUT": nil, "POSTROUTING": nil},
+		"mangle": {"PREROUTING": nil, "INPUT": nil, "FORWARD": nil, "OUTPUT": nil, "POSTROUTING": nil},
+	}}
+}
+
+func (f *fakeIPTables) chain(table, chain string) ([]string, error) {
+	rules, ok := f.tables[table][chain]
+	if !ok {
+		return nil, fmt.Errorf("chain %s does not exist in table %s", chain, table)
+	}
+	return rules, nil
+}
+
+func (f *fakeIPTables) AppendUnique(table, chain string, rulespec ...string) error {
+	rules, err := f.chain(table, chain)
+	if err != nil {
+		return err
+	}
+	spec := strings.Join(rulespec, " ")
+	if !slices.Contains(rules, spec) {
+		f.calls++
+		f.tables[table][chain] = append(rules, spec)
+	}
+	return nil
+}
+
+func (f *fakeIPTables) Exists(table, chain string, rulespec ...string) (bool, error) {
+	rules, err := f.chain(table, chain)
+	if err != nil {
+		return false, err
+	}
+	return slices.Contains(rules, strings.Join(rulespec, " ")), nil
+}
+
+// DeleteIfExists deletes the first matching rule like `iptables -D`.
+func (f *fakeIPTables) DeleteIfExists(table, chain string, rulespec ...string) error {
+	rules, err := f.chain(table, chain)
+	if err != nil {
+		return err
+	}
+	if i := slices.Index(rules, strings.Join(rulespec, " ")); i >= 0 {
+		f.tables[table][chain] = slices.Delete(rules, i, i+1)
+	}
+	return nil
+}
+
+func (f *fakeIPTables) Insert(table, chain string, pos int, rulespec ...string) error {
+	rules, err := f.chain(table, chain)
+	if err != nil {
+		return err
+	}
+	f.calls++
+	f.tables[table][chain] = slices.Insert(rules, pos-1, strings.Join(rulespec, " "))
+	return nil
+}
+
+func (f *fakeIPTables) DeleteById(table, chain string, id int) error {
+	rules, err := f.chain(table, chain)
+	if err != nil {
+		return err
+	}
+	f.calls++
+	f.tables[table][chain] = slices.Delete(rules, id-1, id)
+	return nil
+}
+
+func (f *fakeIPTables) List(table, chain string) ([]string, error) {
+	rules, err := f.chain(table, chain)
+	if err != nil {
+		return nil, err
+	}
+	lines := []string{"-N " + chain}
+	for _, rule := range rules {
+		lines = append(lines, "-A "+chain+" "+rule)
+	}
+	return lines, nil
+}
+
+func (f *fakeIPTables) ListChains(table string) ([]string, error) {
+	var chains []string
+	for chain := range f.tables[table] {
+		chains = append(chains, chain)
+	}
+	slices.Sort(chains)
+	return chains, nil
+}
+
+func (f *fakeIPTables) ChainExists(table, chain string) (bool, error) {
+	_, ok := f.tables[table][chain]
+	return ok, nil
+}
+
+func (f *fakeIPTables) NewChain(table, chain string) error {
+	f.calls++
+	f.tables[table][chain] = []string{}
+	return nil
+}
+
+func (f *fakeIPTables) ClearChain(table, chain string) error {
+	f.calls++
+	f.tables[table][chain] = []string{}
+	return nil
+}
+
+func (f *fakeIPTables) ClearAndDeleteChain(table, chain string) error {
+	f.calls++
+	delete(f.tables[table], chain)
+	return nil
+}
+
+var _ = Describe("RuleSet", func() {
+	var (
+		log  logr.Logger
+		ipv4 *fakeIPTables
+		ipv6 *fakeIPTables
+	)
+
+	factory := func(_ logr.Logger, proto iptables.Protocol) (IPTables, error) {
+		if proto == iptables.ProtocolIPv6 {
+			return ipv6, nil
+		}
+		return ipv4, nil
+	}
+
+	ruleSet := func(networks ...string) *RuleSet {
+		rules := NewRuleSet("VPN-TEST")
+		for _, nw := range networks {
+			rules.Add(iptables.ProtocolIPv4, "nat", "POSTROUTING", "-s", nw, "-j", "MASQUERADE")
+		}
+		rules.Add(iptables.ProtocolIPv6, "filter", "INPUT", "-i", "tun0", "-j", "DROP")
+		return rules
+	}
+
+	ids := func(table, chain string) []string {
+		var result []string
+		for _, rule := range ipv4.tables[table][chain] {
+			result = append(result, strings.Fields(rule)[3])
+		}
+		return result
+	}
+
+	BeforeEach(func() {
+		log = logr.Discard()
+		ipv4 = newFakeIPTables()
+		ipv6 = newFakeIPTables()
+	})
+
+	It("should ignore duplicate rules", func() {
+		rules := ruleSet("10.0.0.0/8", "10.0.0.0/8")
+		Expect(rules.Rules()).To(HaveLen(2))
+	})
+
+	It("should render the commands to set up the rule set", func() {
+		Expect(ruleSet("10.0.0.0/8").Commands()).To(Equal([]string{
+			"iptables -t nat -N VPN-TEST-POSTROUTING",
+			"iptables -t nat -A VPN-TEST-POSTROUTING -m comment --comment vpn2-68e491bb -s 10.0.0.0/8 -j MASQUERADE",
+			"iptables -t nat -A POSTROUTING -j VPN-TEST-POSTROUTING",
+			"ip6tables -t filter -N VPN-TEST-INPUT",
+			"ip6tables -t filter -A VPN-TEST-INPUT -m comment --comment vpn2-1d505630 -i tun0 -j DROP",
+			"ip6tables -t filter -A INPUT -j VPN-TEST-INPUT",
+		}))
+	})
+
+	It("should create dedicated chains and jump to them", func() {
+		Expect(ReconcileIPTables(log, ruleSet("10.0.0.0/8", "192.168.0.0/16"), factory)).To(Succeed())
+
+		Expect(ipv4.tables["nat"]["POSTROUTING"]).To(Equal([]string{"-j VPN-TEST-POSTROUTING"}))
+		Expect(ipv4.tables["nat"]["VPN-TEST-POSTROUTING"]).To(Equal([]string{
+			"-m comment --comment vpn2-68e491bb -s 10.0.0.0/8 -j MASQUERADE",
+			"-m comment --comment vpn2-23bdc908 -s 192.168.0.0/16 -j MASQUERADE",
+		}))
+		Expect(ipv6.tables["filter"]["INPUT"]).To(Equal([]string{"-j VPN-TEST-INPUT"}))
+		Expect(ipv6.tables["filter"]["VPN-TEST-INPUT"]).To(HaveLen(1))
+	})
+
+	It("should not change anything if the rules are in sync", func() {
+		Expect(ReconcileIPTables(log, ruleSet("10.0.0.0/8"), factory)).To(Succeed())
+		ipv4.calls = 0
+		ipv6.calls = 0
+
+		Expect(ReconcileIPTables(log, ruleSet("10.0.0.0/8"), factory)).To(Succeed())
+		Expect(ipv4.calls).To(BeZero())
+		Expect(ipv6.calls).To(BeZero())
+	})
+
+	It("should remove stale rules and insert new ones at their position", func() {
+		Expect(ReconcileIPTables(log, ruleSet("10.0.0.0/8", "172.16.0.0/12"), factory)).To(Succeed())
+		desired := ruleSet("192.168.0.0/16", "172.16.0.0/12", "10.1.0.0/16")
+
+		Expect(ReconcileIPTables(log, desired, factory)).To(Succeed())
+		var expected []string
+		for _, rule := range desired.Rules() {
+			if rule.Protocol == iptables.ProtocolIPv4 {
+				expected = append(expected, ruleID(rule))
+			}
+		}
+		Expect(ids("nat", "VPN-TEST-POSTROUTING")).To(Equal(expected))
+	})
+
+	It("should remove foreign and duplicate rules from dedicated chains and keep foreign chains", func() {
+		Expect(ReconcileIPTables(log, ruleSet("10.0.0.0/8"), factory)).To(Succeed())
+		ipv4.tables["nat"]["VPN-TEST-POSTROUTING"] = append(ipv4.tables["nat"]["VPN-TEST-POSTROUTING"],
+			"-s 10.0.0.0/8 -j ACCEPT",
+			ipv4.tables["nat"]["VPN-TEST-POSTROUTING"][0],
+		)
+		ipv4.tables["nat"]["POSTROUTING"] = append(ipv4.tables["nat"]["POSTROUTING"], "-j KUBE-POSTROUTING")
+
+		Expect(ReconcileIPTables(log, ruleSet("10.0.0.0/8"), factory)).To(Succeed())
+		Expect(ipv4.tables["nat"]["VPN-TEST-POSTROUTING"]).To(Equal([]string{
+			"-m comment --comment vpn2-68e491bb -s 10.0.0.0/8 -j MASQUERADE",
+		}))
+		Expect(ipv4.tables["nat"]["POSTROUTING"]).To(ContainElement("-j KUBE-POSTROUTING"))
+	})
+
+	It("should rebuild a chain with unexpected order", func() {
+		Expect(ReconcileIPTables(log, ruleSet("10.0.0.0/8", "172.16.0.0/12"), factory)).To(Succeed())
+		slices.Reverse(ipv4.tables["nat"]["VPN-TEST-POSTROUTING"])
+
+		Expect(ReconcileIPTables(log, ruleSet("10.0.0.0/8", "172.16.0.0/12"), factory)).To(Succeed())
+		Expect(ipv4.tables["nat"]["VPN-TEST-POSTROUTING"][0]).To(ContainSubstring("10.0.0.0/8"))
+		Expect(ipv4.tables["nat"]["VPN-TEST-POSTROUTING"]).To(HaveLen(2))
+	})
+
+	It("should remove chains without rules", func() {
+		Expect(ReconcileIPTables(log, ruleSet("10.0.0.0/8"), factory)).To(Succeed())
+
+		Expect(ReconcileIPTables(log, NewRuleSet("VPN-TEST"), factory)).To(Succeed())
+		Expect(ipv4.tables["nat"]).NotTo(HaveKey("VPN-TEST-POSTROUTING"))
+		Expect(ipv4.tables["nat"]["POSTROUTING"]).To(BeEmpty())
+		Expect(ipv6.tables["filter"]).NotTo(HaveKey("VPN-TEST-INPUT"))
+		Expect(ipv6.tables["filter"]["INPUT"]).To(BeEmpty())
+	})
+
+	It("should remove the chains of a protocol without rules", func() {
+		Expect(ReconcileIPTables(log, ruleSet("10.0.0.0/8"), factory)).To(Succeed())
+
+		rules := NewRuleSet("VPN-TEST")
+		rules.Add(iptables.ProtocolIPv4, "nat", "POSTROUTING", "-s", "10.0.0.0/8", "-j", "MASQUERADE")
+		Expect(ReconcileIPTables(log, rules, factory)).To(Succeed())
+		Expect(ipv4.tables["nat"]).To(HaveKey("VPN-TEST-POSTROUTING"))
+		Expect(ipv6.tables["filter"]).NotTo(HaveKey("VPN-TEST-INPUT"))
+		Expect(ipv6.tables["filter"]["INPUT"]).To(BeEmpty())
+	})
+
+	It("should remove the rules added to the built-in chains by former versions once", func() {
+		ipv4.tables["nat"]["POSTROUTING"] = []string{
+			"-s 10.0.0.0/8 -j MASQUERADE",
+			"-j KUBE-POSTROUTING",
+			"-s 10.0.0.0/8 -j MASQUERADE",
+			"-s 172.16.0.0/12 -j MASQUERADE",
+		}
+		ipv6.tables["filter"]["INPUT"] = []string{"-i tun0 -j DROP"}
+
+		Expect(ReconcileIPTables(log, ruleSet("10.0.0.0/8"), factory)).To(Succeed())
+		Expect(ipv4.tables["nat"]["POSTROUTING"]).To(Equal([]string{
+			"-j KUBE-POSTROUTING",
+			"-s 172.16.0.0/12 -j MASQUERADE",
+			"-j VPN-TEST-POSTROUTING",
+		}))
+		Expect(ipv6.tables["filter"]["INPUT"]).To(Equal([]string{"-j VPN-TEST-INPUT"}))
+
+		// once the dedicated chain exists, the built-in chain is not searched for legacy rules anymore
+		ipv4.tables["nat"]["POSTROUTING"] = append(ipv4.tables["nat"]["POSTROUTING"], "-s 10.0.0.0/8 -j MASQUERADE")
+		Expect(ReconcileIPTables(log, ruleSet("10.0.0.0/8"), factory)).To(Succeed())
+		Expect(ipv4.tables["nat"]["POSTROUTING"]).To(ContainElement("-s 10.0.0.0/8 -j MASQUERADE"))
+	})
+
+	It("should keep chains of the owner which are not named after a built-in chain", func() {
+		ipv4.tables["filter"]["VPN-TEST-CUSTOM"] = []string{"-j ACCEPT"}
+		ipv4.tables["nat"]["VPN-TEST-FORWARD"] = []string{"-j ACCEPT"}
+
+		Expect(ReconcileIPTables(log, ruleSet("10.0.0.0/8"), factory)).To(Succeed())
+		Expect(ipv4.tables["filter"]["VPN-TEST-CUSTOM"]).To(Equal([]string{"-j ACCEPT"}))
+		Expect(ipv4.tables["nat"]["VPN-TEST-FORWARD"]).To(Equal([]string{"-j ACCEPT"}))
+	})
+})
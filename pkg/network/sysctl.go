@@ -0,0 +1,142 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package network
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/go-logr/logr"
+	"github.com/lorenzosaino/go-sysctl"
+)
+
+// Sysctl reads and writes kernel parameters.
+type Sysctl interface {
+	Get(name string) (string, error)
+	Set(name, value string) error
+}
+
+// hostSysctl reads and writes the kernel parameters of the host.
+// If stateFile is set, the previous value of each changed kernel parameter is recorded there for RestoreSysctls.
+type hostSysctl struct {
+	stateFile string
+}
+
+// HostSysctl returns a Sysctl operating on the kernel parameters of the host.
+// If stateFile is not empty, the value of each kernel parameter before its first change is recorded in this file,
+// so that it can be restored by RestoreSysctls.
+func HostSysctl(stateFile string) Sysctl {
+	return hostSysctl{stateFile: stateFile}
+}
+
+func (hostSysctl) Get(name string) (string, error) {
+	return sysctl.Get(name)
+}
+
+func (s hostSysctl) Set(name, value string) error {
+	if s.stateFile != "" {
+		previous, err := sysctl.Get(name)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		if previous != value {
+			if err := recordSysctl(s.stateFile, name, previous); err != nil {
+				return err
+			}
+		}
+	}
+	return sysctl.Set(name, value)
+}
+
+// recordSysctl records the previous value of a kernel parameter in the state file unless it has been recorded before.
+func recordSysctl(stateFile, name, previous string) error {
+	values, err := readSysctlState(stateFile)
+	if err != nil {
+		return err
+	}
+	if _, ok := values[name]; ok {
+		return nil
+	}
+	values[name] = previous
+	return writeSysctlState(stateFile, values)
+}
+
+// InitSysctlState creates an empty state file unless it exists, so that a state file which cannot be written is
+// detected before any kernel parameter is changed.
+func InitSysctlState(stateFile string) error {
+	_, err := os.Stat(stateFile)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to check sysctl state file %s: %w", stateFile, err)
+	}
+	return writeSysctlState(stateFile, map[string]string{})
+}
+
+func writeSysctlState(stateFile string, values map[string]string) error {
+	data, err := json.MarshalIndent(values, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal sysctl state: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(stateFile), 0o750); err != nil {
+		return fmt.Errorf("failed to create directory for sysctl state file %s: %w", stateFile, err)
+	}
+	if err := os.WriteFile(stateFile, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write sysctl state file %s: %w", stateFile, err)
+	}
+	return nil
+}
+
+func readSysctlState(stateFile string) (map[string]string, error) {
+	values := map[string]string{}
+	data, err := os.ReadFile(stateFile) // #nosec: G304 -- path is provided by the operator
+	if errors.Is(err, os.ErrNotExist) {
+		return values, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sysctl state file %s: %w", stateFile, err)
+	}
+	if err := json.Unmarshal(data, &values); err != nil {
+		return nil, fmt.Errorf("failed to parse sysctl state file %s: %w", stateFile, err)
+	}
+	return values, nil
+}
+
+// RestoreSysctls restores the kernel parameters recorded in the state file by HostSysctl to their previous values
+// and empties the state file afterwards. Nothing is done if the state file does not exist, e.g. because it was written
+// by the setup subcommand in another container without a shared volume.
+// All kernel parameters are attempted even if some of them fail. In this case the state file is left unchanged, so that
+// a rerun can restore the remaining ones.
+func RestoreSysctls(log logr.Logger, stateFile string, s Sysctl) error {
+	if _, err := os.Stat(stateFile); errors.Is(err, os.ErrNotExist) {
+		log.Info("sysctl state file does not exist, no kernel parameters to restore", "stateFile", stateFile)
+		return nil
+	}
+	values, err := readSysctlState(stateFile)
+	if err != nil {
+		return err
+	}
+	if len(values) == 0 {
+		log.Info("no recorded kernel parameters to restore", "stateFile", stateFile)
+		return nil
+	}
+	var errs []error
+	for _, name := range slices.Sorted(maps.Keys(values)) {
+		log.Info("restoring kernel parameter", "name", name, "value", values[name])
+		if err := s.Set(name, values[name]); err != nil {
+			errs = append(errs, fmt.Errorf("failed to restore %s: %w", name, err))
+		}
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	return writeSysctlState(stateFile, map[string]string{})
+}
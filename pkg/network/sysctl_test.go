@@ -0,0 +1,113 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package network
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("#RestoreSysctls", func() {
+	var (
+		log       logr.Logger
+		stateFile string
+		host      *fakeSysctl
+	)
+
+	BeforeEach(func() {
+		log = logr.Discard()
+		stateFile = filepath.Join(GinkgoT().TempDir(), "state", "sysctl.json")
+		host = &fakeSysctl{}
+	})
+
+	// recorded returns the kernel parameters recorded in the state file
+	recorded := func() map[string]string {
+		values, err := readSysctlState(stateFile)
+		Expect(err).NotTo(HaveOccurred())
+		return values
+	}
+
+	It("should restore the first recorded value of each kernel parameter and empty the state file", func() {
+		Expect(recordSysctl(stateFile, "net.ipv4.ip_forward", "0")).To(Succeed())
+		Expect(recordSysctl(stateFile, "net.ipv4.ip_forward", "1")).To(Succeed())
+		Expect(recordSysctl(stateFile, "net.ipv4.conf.all.rp_filter", "2")).To(Succeed())
+
+		Expect(RestoreSysctls(log, stateFile, host)).To(Succeed())
+		Expect(host.settings).To(Equal([]string{"net.ipv4.conf.all.rp_filter=2", "net.ipv4.ip_forward=0"}))
+		Expect(recorded()).To(BeEmpty())
+
+		// a rerun has nothing to restore
+		Expect(RestoreSysctls(log, stateFile, host)).To(Succeed())
+		Expect(host.settings).To(HaveLen(2))
+	})
+
+	It("should restore all kernel parameters and keep the state file if some of them fail", func() {
+		Expect(recordSysctl(stateFile, "net.ipv4.conf.all.rp_filter", "2")).To(Succeed())
+		Expect(recordSysctl(stateFile, "net.ipv4.ip_forward", "0")).To(Succeed())
+		Expect(recordSysctl(stateFile, "net.ipv4.tcp_fin_timeout", "60")).To(Succeed())
+		failing := &fakeSysctl{failures: map[string]error{
+			"net.ipv4.conf.all.rp_filter": errors.New("permission denied"),
+			"net.ipv4.tcp_fin_timeout":    errors.New("read-only file system"),
+		}}
+
+		err := RestoreSysctls(log, stateFile, failing)
+		Expect(err).To(MatchError(ContainSubstring("failed to restore net.ipv4.conf.all.rp_filter: permission denied")))
+		Expect(err).To(MatchError(ContainSubstring("failed to restore net.ipv4.tcp_fin_timeout: read-only file system")))
+		Expect(failing.settings).To(Equal([]string{"net.ipv4.ip_forward=0"}))
+		Expect(recorded()).To(HaveLen(3))
+
+		// a rerun restores the remaining kernel parameters
+		Expect(RestoreSysctls(log, stateFile, host)).To(Succeed())
+		Expect(host.settings).To(HaveLen(3))
+		Expect(recorded()).To(BeEmpty())
+	})
+
+	It("should do nothing if there is no state file", func() {
+		Expect(RestoreSysctls(log, stateFile, host)).To(Succeed())
+		Expect(host.settings).To(BeEmpty())
+		Expect(stateFile).NotTo(BeAnExistingFile())
+	})
+
+	It("should do nothing if the setup did not change any kernel parameter", func() {
+		Expect(InitSysctlState(stateFile)).To(Succeed())
+		Expect(RestoreSysctls(log, stateFile, host)).To(Succeed())
+		Expect(host.settings).To(BeEmpty())
+	})
+
+	It("should not reset a recorded state when initializing the state file", func() {
+		Expect(recordSysctl(stateFile, "net.ipv4.ip_forward", "0")).To(Succeed())
+		Expect(InitSysctlState(stateFile)).To(Succeed())
+		Expect(recorded()).To(Equal(map[string]string{"net.ipv4.ip_forward": "0"}))
+	})
+
+	It("should fail on a corrupt state file", func() {
+		Expect(os.MkdirAll(filepath.Dir(stateFile), 0o750)).To(Succeed())
+		Expect(os.WriteFile(stateFile, []byte("{"), 0o600)).To(Succeed())
+		Expect(RestoreSysctls(log, stateFile, host)).To(MatchError(ContainSubstring("failed to parse sysctl state file")))
+	})
+})
+
+// fakeSysctl records the kernel parameters set as name=value, but fails for the ones in failures.
+type fakeSysctl struct {
+	settings []string
+	failures map[string]error
+}
+
+func (f *fakeSysctl) Get(string) (string, error) {
+	return "", errors.New("not implemented")
+}
+
+func (f *fakeSysctl) Set(name, value string) error {
+	if err, ok := f.failures[name]; ok {
+		return err
+	}
+	f.settings = append(f.settings, name+"="+value)
+	return nil
+}
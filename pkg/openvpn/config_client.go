@@ -28,6 +28,8 @@ type ClientValues struct {
 	SeedPodNetwork       string
 	IsDualStack          bool
 	TunMTU               int
+	// Verb is the verbosity of OpenVPN, 3 if unset.
+	Verb int
 }
 
 func generateClientConfig(cfg ClientValues) (string, error) {
@@ -38,10 +40,19 @@ func generateClientConfig(cfg ClientValues) (string, error) {
 	return buf.String(), nil
 }
 
-func WriteClientConfigFile(v ClientValues) error {
+// ClientConfigFiles generates the files written by WriteClientConfigFile indexed by their path.
+func ClientConfigFiles(v ClientValues) (map[string]string, error) {
 	openvpnConfig, err := generateClientConfig(v)
 	if err != nil {
-		return fmt.Errorf("error %w: Could not generate openvpn config from %v", err, v)
+		return nil, fmt.Errorf("error %w: Could not generate openvpn config from %v", err, v)
+	}
+	return map[string]string{defaultOpenVPNClientConfigFile: openvpnConfig}, nil
+}
+
+func WriteClientConfigFile(v ClientValues) error {
+	files, err := ClientConfigFiles(v)
+	if err != nil {
+		return err
 	}
-	return os.WriteFile(defaultOpenVPNClientConfigFile, []byte(openvpnConfig), defaultConfigFilePermissions)
+	return os.WriteFile(defaultOpenVPNClientConfigFile, []byte(files[defaultOpenVPNClientConfigFile]), defaultConfigFilePermissions)
 }
@@ -7,9 +7,12 @@ package openvpn
 import (
 	"bytes"
 	_ "embed"
+	"errors"
 	"fmt"
+	"maps"
 	"os"
 	"path"
+	"slices"
 
 	"github.com/gardener/vpn2/pkg/network"
 )
@@ -35,6 +38,10 @@ type SeedServerValues struct {
 	LocalNodeIP        string
 	TunMTU             int
 	MaxRoutesPerClient int
+	FirewallBackend    string
+	ManagementPort     uint
+	// Verb is the verbosity of OpenVPN, 3 if unset.
+	Verb int
 }
 
 func generateSeedServerConfig(cfg SeedServerValues) (string, error) {
@@ -60,32 +67,71 @@ const (
 	SeedClientPrefix  = "vpn-seed-client"
 )
 
-func WriteServerConfigFiles(v SeedServerValues) error {
+// ClientCommonName returns the common name of the client a file generated by ServerConfigFiles belongs to,
+// or false if it is not a client-config-dir file.
+func ClientCommonName(file string) (string, bool) {
+	if path.Dir(file) != clientConfigDir {
+		return "", false
+	}
+	return path.Base(file), true
+}
+
+// ServerConfigFiles generates the files written by WriteServerConfigFiles indexed by their path.
+func ServerConfigFiles(v SeedServerValues) (map[string]string, error) {
 	openvpnConfig, err := generateSeedServerConfig(v)
 	if err != nil {
-		return fmt.Errorf("error %w: Could not generate openvpn config from %v", err, v)
+		return nil, fmt.Errorf("error %w: Could not generate openvpn config from %v", err, v)
 	}
-	if err := os.WriteFile(defaultOpenVPNServerConfigFile, []byte(openvpnConfig), defaultConfigFilePermissions); err != nil {
-		return err
+	vpnShootClientConfig, err := generateConfigForClientFromServer(v)
+	if err != nil {
+		return nil, fmt.Errorf("error %w: Could not generate shoot client config from %v", err, v)
 	}
 
-	vpnShootClientConfig, err := generateConfigForClientFromServer(v)
+	files := map[string]string{
+		defaultOpenVPNServerConfigFile:                openvpnConfig,
+		path.Join(clientConfigDir, ShootClientPrefix): vpnShootClientConfig,
+	}
+	if v.IsHA {
+		for i := 0; i < v.HAVPNClients; i++ {
+			files[fmt.Sprintf("%s-%d", path.Join(clientConfigDir, ShootClientPrefix), i)] = ""
+		}
+	}
+	return files, nil
+}
+
+// ReadServerConfigFiles reads the files generated by ServerConfigFiles for the values as they are found on disk,
+// indexed by their path. Files which do not exist are omitted.
+func ReadServerConfigFiles(v SeedServerValues) (map[string]string, error) {
+	files, err := ServerConfigFiles(v)
 	if err != nil {
-		return fmt.Errorf("error %w: Could not generate shoot client config from %v", err, v)
+		return nil, err
 	}
-	err = os.Mkdir(clientConfigDir, 0750)
-	if err != nil && !os.IsExist(err) {
+	applied := map[string]string{}
+	for name := range files {
+		content, err := os.ReadFile(name) // #nosec: G304 -- path is generated by ServerConfigFiles
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		applied[name] = string(content)
+	}
+	return applied, nil
+}
+
+func WriteServerConfigFiles(v SeedServerValues) error {
+	files, err := ServerConfigFiles(v)
+	if err != nil {
 		return err
 	}
-	if err := os.WriteFile(path.Join(clientConfigDir, ShootClientPrefix), []byte(vpnShootClientConfig), defaultConfigFilePermissions); err != nil {
+	err = os.Mkdir(clientConfigDir, 0750)
+	if err != nil && !os.IsExist(err) {
 		return err
 	}
-
-	if v.IsHA {
-		for i := 0; i < v.HAVPNClients; i++ {
-			if err := os.WriteFile(fmt.Sprintf("%s-%d", path.Join(clientConfigDir, ShootClientPrefix), i), []byte(""), defaultConfigFilePermissions); err != nil {
-				return err
-			}
+	for _, name := range slices.Sorted(maps.Keys(files)) {
+		if err := os.WriteFile(name, []byte(files[name]), defaultConfigFilePermissions); err != nil {
+			return err
 		}
 	}
 	return nil
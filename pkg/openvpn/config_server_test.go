@@ -177,6 +177,36 @@ up "/bin/vpn-server firewall --mode up --device tun0 --shoot-network=100.64.0.0/
 down "/bin/vpn-server firewall --mode down --device tun0"`))
 			Expect(content).To(HaveNoLineLongerThan(OpenVPNConfigMaxLineLength))
 		})
+
+		It("should pass the firewall backend to the firewall command", func() {
+			cfgDualStack.FirewallBackend = "nftables"
+			content, err := generateSeedServerConfig(cfgDualStack)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(content).To(ContainSubstring(`
+up "/bin/vpn-server firewall --mode up --device tun0 --shoot-network=100.64.0.0/13,100.96.0.0/11,10.0.1.0/24,2001:db8:1::/48,2001:db8:2::/48,2001:db8:3::/48 --seed-pod-network=100.64.0.0/12 --backend nftables"
+down "/bin/vpn-server firewall --mode down --device tun0 --backend nftables"`))
+			Expect(content).To(HaveNoLineLongerThan(OpenVPNConfigMaxLineLength))
+		})
+
+		It("should enable the management interface on localhost", func() {
+			cfgDualStack.ManagementPort = 7505
+			content, err := generateSeedServerConfig(cfgDualStack)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(content).To(ContainSubstring("\nmanagement 127.0.0.1 7505\n"))
+		})
+
+		It("should set the verbosity", func() {
+			content, err := generateSeedServerConfig(cfgDualStack)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(content).To(HavePrefix("verb 3\n"))
+
+			cfgDualStack.Verb = 4
+			content, err = generateSeedServerConfig(cfgDualStack)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(content).To(HavePrefix("verb 4\n"))
+		})
 	})
 
 	Describe("#GenerateVPNShootClient", func() {
@@ -228,4 +258,24 @@ iroute-ipv6 2001:db8:3::/48
 `))
 		})
 	})
+
+	Describe("#ServerConfigFiles", func() {
+		It("should generate the openvpn config and the client-config-dir files", func() {
+			files, err := ServerConfigFiles(cfgIPv4)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(files).To(HaveKey("/openvpn-server.config"))
+			Expect(files).To(HaveKeyWithValue("/client-config-dir/vpn-shoot-client", ContainSubstring("iroute 100.64.0.0 255.248.0.0")))
+			Expect(files).To(HaveLen(2))
+		})
+
+		It("should generate an empty file per client in HA mode", func() {
+			prepareIPv4HA()
+			cfgIPv4.HAVPNClients = 2
+			files, err := ServerConfigFiles(cfgIPv4)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(files).To(HaveKeyWithValue("/client-config-dir/vpn-shoot-client-0", ""))
+			Expect(files).To(HaveKeyWithValue("/client-config-dir/vpn-shoot-client-1", ""))
+			Expect(files).To(HaveLen(4))
+		})
+	})
 })
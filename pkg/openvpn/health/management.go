@@ -0,0 +1,94 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package health
+
+import (
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/gardener/vpn2/pkg/openvpn/management"
+)
+
+// errManagementUnavailable is returned if the management interface cannot be connected to, e.g. because the server
+// was started with a configuration without management directive.
+var errManagementUnavailable = errors.New("management interface unavailable")
+
+func dialManagement(cfg Config) (*management.Client, error) {
+	client, err := management.Dial(cfg.ManagementAddress, cfg.ManagementTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errManagementUnavailable, err)
+	}
+	return client, nil
+}
+
+// stateByManagement queries the state of the server.
+func stateByManagement(cfg Config) (management.State, error) {
+	client, err := dialManagement(cfg)
+	if err != nil {
+		return management.State{}, err
+	}
+	defer client.Close()
+
+	return client.State()
+}
+
+// statusByManagement queries the live status of the server.
+func statusByManagement(cfg Config) (*OpenVPNStatus, error) {
+	client, err := dialManagement(cfg)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	status, err := client.Status()
+	if err != nil {
+		return nil, err
+	}
+	return fromManagementStatus(status)
+}
+
+// fromManagementStatus converts the status returned by the management interface to the status of the status file.
+func fromManagementStatus(status *management.Status) (*OpenVPNStatus, error) {
+	result := &OpenVPNStatus{
+		Version:      status.Title,
+		UpdatedAt:    status.Time,
+		Clients:      []ClientInfo{},
+		RoutingTable: []RoutingEntry{},
+		GlobalStats:  status.Stats,
+	}
+	for _, client := range status.Clients {
+		realAddress, err := parseRealClientAddress(client.RealAddress)
+		if err != nil {
+			return nil, fmt.Errorf("CLIENT_LIST: can't parse real client address: %s (%w)", client.RealAddress, err)
+		}
+		result.Clients = append(result.Clients, ClientInfo{
+			CommonName:         client.CommonName,
+			RealAddress:        realAddress,
+			VirtualAddress:     client.VirtualAddress,
+			VirtualIPv6Address: net.ParseIP(client.VirtualIPv6Address),
+			BytesReceived:      client.BytesReceived,
+			BytesSent:          client.BytesSent,
+			ConnectedSince:     client.ConnectedSince,
+			Username:           client.Username,
+			ClientID:           fmt.Sprint(client.ClientID),
+			PeerID:             client.PeerID,
+			DataChannelCipher:  client.DataChannelCipher,
+		})
+	}
+	for _, route := range status.Routes {
+		realAddress, err := parseRealClientAddress(route.RealAddress)
+		if err != nil {
+			return nil, fmt.Errorf("ROUTING_TABLE: can't parse real client address: %s (%w)", route.RealAddress, err)
+		}
+		result.RoutingTable = append(result.RoutingTable, RoutingEntry{
+			VirtualAddress: route.VirtualAddress,
+			CommonName:     route.CommonName,
+			RealAddress:    realAddress,
+			LastRef:        route.LastRef,
+		})
+	}
+	return result, nil
+}
@@ -5,6 +5,9 @@
 package health
 
 import (
+	"errors"
+	"time"
+
 	"github.com/go-logr/logr"
 )
 
@@ -16,6 +19,11 @@ type Config struct {
 	OpenVPNStatusUpdateInterval int
 	// IsHA indicates whether the OpenVPN server is running in HA mode.
 	IsHA bool
+	// ManagementAddress is the address of the OpenVPN management interface, e.g. `127.0.0.1:7505`. If set, the checks
+	// query the live state through it and only fall back to the status file if it is not reachable.
+	ManagementAddress string
+	// ManagementTimeout is the time allowed for connecting to the management interface and for each query.
+	ManagementTimeout time.Duration
 }
 
 // NewDefaultConfig creates Config with default values.
@@ -24,31 +32,97 @@ func NewDefaultConfig() Config {
 		OpenVPNStatusPath:           "/srv/status/openvpn.status",
 		OpenVPNStatusUpdateInterval: 15,
 		IsHA:                        false,
+		ManagementTimeout:           2 * time.Second,
 	}
 }
 
+// Sources of the check results.
+const (
+	SourceManagement = "management"
+	SourceStatusFile = "status-file"
+)
+
+// Result is the result of a liveness or readiness check.
+type Result struct {
+	// Healthy is true if the check succeeded.
+	Healthy bool `json:"healthy"`
+	// Reason explains why the check failed.
+	Reason string `json:"reason,omitempty"`
+	// Source is the source of the OpenVPN state, i.e. the management interface or the status file.
+	Source string `json:"source"`
+	// CheckedAt is the time of the check.
+	CheckedAt time.Time `json:"checkedAt"`
+}
+
+func newResult(source, reason string) Result {
+	return Result{Healthy: reason == "", Reason: reason, Source: source, CheckedAt: time.Now()}
+}
+
 // IsAlive checks whether the OpenVPN server is alive.
 func IsAlive(cfg Config, log logr.Logger) bool {
+	return CheckAlive(cfg, log).Healthy
+}
+
+// IsReady checks whether the OpenVPN server is ready.
+func IsReady(cfg Config, log logr.Logger) bool {
+	return CheckReady(cfg, log).Healthy
+}
+
+// CheckAlive checks whether the OpenVPN server is alive. With the management interface, the server is alive if it
+// answers the state query. Otherwise, the status file must have been updated recently.
+func CheckAlive(cfg Config, log logr.Logger) Result {
+	if cfg.ManagementAddress != "" {
+		state, err := stateByManagement(cfg)
+		if err == nil {
+			if state.Name == "EXITING" {
+				return newResult(SourceManagement, "OpenVPN is exiting")
+			}
+			return newResult(SourceManagement, "")
+		}
+		if !errors.Is(err, errManagementUnavailable) {
+			log.Error(err, "OpenVPN management interface is not responding", "address", cfg.ManagementAddress)
+			return newResult(SourceManagement, "management interface is not responding: "+err.Error())
+		}
+		log.Info("OpenVPN management interface not available, falling back to status file", "address", cfg.ManagementAddress, "reason", err.Error())
+	}
+
 	status, err := ParseFile(cfg.OpenVPNStatusPath)
 	if err != nil {
 		log.Error(err, "failed to parse OpenVPN status file", "path", cfg.OpenVPNStatusPath)
-		return false
+		return newResult(SourceStatusFile, "failed to parse status file: "+err.Error())
 	}
-	if isUp(log, status, cfg.OpenVPNStatusUpdateInterval) {
-		return true
+	if !isUp(log, status, cfg.OpenVPNStatusUpdateInterval) {
+		return newResult(SourceStatusFile, staleReason(status, cfg.OpenVPNStatusUpdateInterval))
 	}
-	return false
+	return newResult(SourceStatusFile, "")
 }
 
-// IsReady checks whether the OpenVPN server is ready.
-func IsReady(cfg Config, log logr.Logger) bool {
+// CheckReady checks whether the OpenVPN server is ready. The connected clients are taken from the management
+// interface if available, otherwise from the status file.
+func CheckReady(cfg Config, log logr.Logger) Result {
+	if cfg.ManagementAddress != "" {
+		status, err := statusByManagement(cfg)
+		if err == nil {
+			return readyResult(log, SourceManagement, status, cfg.IsHA)
+		}
+		if !errors.Is(err, errManagementUnavailable) {
+			log.Error(err, "failed to query OpenVPN status from management interface", "address", cfg.ManagementAddress)
+			return newResult(SourceManagement, "failed to query status from management interface: "+err.Error())
+		}
+		log.Info("OpenVPN management interface not available, falling back to status file", "address", cfg.ManagementAddress, "reason", err.Error())
+	}
+
 	status, err := ParseFile(cfg.OpenVPNStatusPath)
 	if err != nil {
 		log.Error(err, "failed to parse OpenVPN status file", "path", cfg.OpenVPNStatusPath)
-		return false
+		return newResult(SourceStatusFile, "failed to parse status file: "+err.Error())
 	}
-	if isReady(log, status, cfg.IsHA) {
-		return true
+	return readyResult(log, SourceStatusFile, status, cfg.IsHA)
+}
+
+func readyResult(log logr.Logger, source string, status *OpenVPNStatus, isHA bool) Result {
+	if isReady(log, status, isHA) {
+		return newResult(source, "")
 	}
-	return false
+	return newResult(source, notReadyReason(status, isHA))
 }
@@ -7,6 +7,8 @@ import (
 	"github.com/go-logr/logr"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+
+	"github.com/gardener/vpn2/pkg/openvpn/management/fake"
 )
 
 var _ = Describe("OpenVPN Server Readiness/Liveness", func() {
@@ -66,4 +68,60 @@ var _ = Describe("OpenVPN Server Readiness/Liveness", func() {
 			Expect(ready).To(Equal(tc.expectReady), "IsReady failed for "+tc.name)
 		})
 	}
+	Context("with management interface", func() {
+		var (
+			server *fake.Server
+			cfg    Config
+		)
+
+		BeforeEach(func() {
+			var err error
+			server, err = fake.NewServer()
+			Expect(err).NotTo(HaveOccurred())
+			DeferCleanup(server.Close)
+
+			cfg = NewDefaultConfig()
+			cfg.ManagementAddress = server.Addr()
+			cfg.ManagementTimeout = 200 * time.Millisecond
+			cfg.OpenVPNStatusPath = filepath.Join("test", "does-not-exist.status")
+			cfg.IsHA = true
+		})
+
+		It("uses the live state and client list", func() {
+			server.SetStatus(
+				"TITLE\tOpenVPN 2.6.16",
+				"TIME\t2025-12-19 11:12:04\t1766142724",
+				"CLIENT_LIST\tvpn-seed-client\t100.64.3.32:41392\t\tfd8f:6d53:b97a:1::100:2\t1\t2\t2025-12-19 07:13:24\t1766128404\tUNDEF\t30\t0\tAES-256-GCM",
+				"CLIENT_LIST\tvpn-shoot-client-0\t100.64.2.43:48782\t\tfd8f:6d53:b97a:1::100:7\t1\t2\t2025-12-19 08:10:27\t1766131827\tUNDEF\t717\t5\tAES-256-GCM",
+				"ROUTING_TABLE\tb6:f1:5a:3f:9e:a1@0\tvpn-shoot-client-0\t100.64.2.43:48782\t2025-12-19 11:12:03\t1766142723",
+			)
+			Expect(IsAlive(cfg, logr.Discard())).To(BeTrue())
+			Expect(IsReady(cfg, logr.Discard())).To(BeTrue())
+			Expect(server.Commands()).To(Equal([]string{"state", "status 3"}))
+		})
+
+		It("is not ready if the shoot client is missing", func() {
+			server.SetStatus("CLIENT_LIST\tvpn-seed-client\t100.64.3.32:41392\t\tfd8f:6d53:b97a:1::100:2\t1\t2\t2025-12-19 07:13:24\t1766128404\tUNDEF\t30\t0\tAES-256-GCM")
+			Expect(IsReady(cfg, logr.Discard())).To(BeFalse())
+		})
+
+		It("detects a hung server even if the status file is recent", func() {
+			cfg.OpenVPNStatusPath = filepath.Join("test", "openvpn-ready.status")
+			cfg.OpenVPNStatusUpdateInterval = largeInterval
+			server.Reply("state")
+			server.Reply("status 3")
+
+			Expect(IsAlive(cfg, logr.Discard())).To(BeFalse())
+			Expect(IsReady(cfg, logr.Discard())).To(BeFalse())
+		})
+
+		It("falls back to the status file if the management interface is not available", func() {
+			Expect(server.Close()).To(Succeed())
+			cfg.OpenVPNStatusPath = filepath.Join("test", "openvpn-ready.status")
+			cfg.OpenVPNStatusUpdateInterval = largeInterval
+
+			Expect(IsAlive(cfg, logr.Discard())).To(BeTrue())
+			Expect(IsReady(cfg, logr.Discard())).To(BeTrue())
+		})
+	})
 })
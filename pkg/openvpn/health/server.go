@@ -0,0 +1,92 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package health
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+// Server serves the liveness and readiness of the OpenVPN server over HTTP. The check results are cached, so that
+// frequent probes do not query OpenVPN or parse the status file each time.
+type Server struct {
+	log      logr.Logger
+	cfg      Config
+	cacheTTL time.Duration
+
+	lock  sync.Mutex
+	alive *Result
+	ready *Result
+
+	// checkAlive and checkReady are replaceable for tests.
+	checkAlive func(Config, logr.Logger) Result
+	checkReady func(Config, logr.Logger) Result
+}
+
+// NewServer creates a health server caching the check results for cacheTTL.
+func NewServer(log logr.Logger, cfg Config, cacheTTL time.Duration) *Server {
+	return &Server{
+		log:        log,
+		cfg:        cfg,
+		cacheTTL:   cacheTTL,
+		checkAlive: CheckAlive,
+		checkReady: CheckReady,
+	}
+}
+
+// Handler returns the HTTP handler serving `/livez`, `/readyz` and `/healthz`, which requires both checks to succeed.
+// The responses are JSON bodies with the check results and have status 503 if a check failed.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/livez", func(w http.ResponseWriter, _ *http.Request) {
+		alive := s.Alive()
+		s.write(w, alive.Healthy, alive)
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, _ *http.Request) {
+		ready := s.Ready()
+		s.write(w, ready.Healthy, ready)
+	})
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
+		alive, ready := s.Alive(), s.Ready()
+		s.write(w, alive.Healthy && ready.Healthy, map[string]Result{"alive": alive, "ready": ready})
+	})
+	return mux
+}
+
+// Alive returns the cached liveness result, refreshing it if it has expired.
+func (s *Server) Alive() Result {
+	return s.cached(&s.alive, s.checkAlive)
+}
+
+// Ready returns the cached readiness result, refreshing it if it has expired.
+func (s *Server) Ready() Result {
+	return s.cached(&s.ready, s.checkReady)
+}
+
+func (s *Server) cached(result **Result, check func(Config, logr.Logger) Result) Result {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if *result == nil || time.Since((*result).CheckedAt) >= s.cacheTTL {
+		r := check(s.cfg, s.log)
+		*result = &r
+	}
+	return **result
+}
+
+func (s *Server) write(w http.ResponseWriter, healthy bool, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	if healthy {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		s.log.Error(err, "failed to write health response")
+	}
+}
@@ -0,0 +1,87 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package health
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"time"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Health server", func() {
+	var (
+		server      *Server
+		aliveChecks int
+		alive       Result
+	)
+
+	get := func(path string) (int, map[string]any) {
+		recorder := httptest.NewRecorder()
+		server.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+		Expect(recorder.Header().Get("Content-Type")).To(Equal("application/json"))
+		body := map[string]any{}
+		Expect(json.Unmarshal(recorder.Body.Bytes(), &body)).To(Succeed())
+		return recorder.Code, body
+	}
+
+	BeforeEach(func() {
+		cfg := NewDefaultConfig()
+		cfg.OpenVPNStatusPath = filepath.Join("test", "openvpn-nonha-ready.status")
+		server = NewServer(logr.Discard(), cfg, time.Hour)
+		aliveChecks = 0
+		alive = Result{Healthy: true, Source: SourceManagement}
+		server.checkAlive = func(Config, logr.Logger) Result {
+			aliveChecks++
+			alive.CheckedAt = time.Now()
+			return alive
+		}
+	})
+
+	It("serves the liveness and caches the result", func() {
+		code, body := get("/livez")
+		Expect(code).To(Equal(http.StatusOK))
+		Expect(body).To(HaveKeyWithValue("healthy", true))
+		Expect(body).To(HaveKeyWithValue("source", SourceManagement))
+
+		alive = Result{Reason: "OpenVPN is exiting", Source: SourceManagement}
+		code, _ = get("/livez")
+		Expect(code).To(Equal(http.StatusOK))
+		Expect(aliveChecks).To(Equal(1))
+	})
+
+	It("refreshes the result once the cache expired", func() {
+		server.cacheTTL = 0
+		code, _ := get("/livez")
+		Expect(code).To(Equal(http.StatusOK))
+
+		alive = Result{Reason: "OpenVPN is exiting", Source: SourceManagement}
+		code, body := get("/livez")
+		Expect(code).To(Equal(http.StatusServiceUnavailable))
+		Expect(body).To(HaveKeyWithValue("reason", "OpenVPN is exiting"))
+		Expect(aliveChecks).To(Equal(2))
+	})
+
+	It("serves the readiness with the reason of the failure", func() {
+		server.cfg.IsHA = true
+		code, body := get("/readyz")
+		Expect(code).To(Equal(http.StatusServiceUnavailable))
+		Expect(body).To(HaveKeyWithValue("healthy", false))
+		Expect(body).To(HaveKeyWithValue("source", SourceStatusFile))
+		Expect(body).To(HaveKeyWithValue("reason", "Not enough connected clients for HA mode"))
+	})
+
+	It("serves both checks on /healthz", func() {
+		code, body := get("/healthz")
+		Expect(code).To(Equal(http.StatusOK))
+		Expect(body).To(HaveKeyWithValue("alive", HaveKeyWithValue("healthy", true)))
+		Expect(body).To(HaveKeyWithValue("ready", HaveKeyWithValue("healthy", true)))
+	})
+})
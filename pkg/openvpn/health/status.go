@@ -172,29 +172,55 @@ func isUp(log logr.Logger, status *OpenVPNStatus, updateInterval int) bool {
 	if status == nil {
 		return false
 	}
+	reason := staleReason(status, updateInterval)
+	if reason != "" {
+		log.Info("OpenVPN status is stale", "lastUpdate", time.Since(status.UpdatedAt).String(), "expectedUpdate", expectedUpdate(updateInterval).String())
+	}
+	return reason == ""
+}
+
+// expectedUpdate is the maximum age of the status. We assume OpenVPN is dead if it hasn't been updated in
+// updateInterval + 2 seconds.
+func expectedUpdate(updateInterval int) time.Duration {
+	return time.Duration(updateInterval+2) * time.Second
+}
+
+// staleReason returns why the status is considered stale, or an empty string if it is recent.
+func staleReason(status *OpenVPNStatus, updateInterval int) string {
+	if status == nil {
+		return "no OpenVPN status"
+	}
 	lastUpdate := time.Since(status.UpdatedAt)
-	expectedUpdate := time.Duration(updateInterval+2) * time.Second
-	alive := lastUpdate <= expectedUpdate
-	if !alive {
-		log.Info("OpenVPN status is stale", "lastUpdate", lastUpdate.String(), "expectedUpdate", expectedUpdate.String())
+	if lastUpdate > expectedUpdate(updateInterval) {
+		return fmt.Sprintf("OpenVPN status is stale: last update %s ago, expected within %s", lastUpdate.Round(time.Second), expectedUpdate(updateInterval))
 	}
-	// We assume OpenVPN is dead if it hasn't been updated in updateInterval + 2 seconds
-	return alive
+	return ""
 }
 
 // isReady checks if the OpenVPN server is considered "ready" based on the number of connected clients.
 func isReady(log logr.Logger, status *OpenVPNStatus, isHA bool) bool {
+	reason := notReadyReason(status, isHA)
+	if reason != "" {
+		connectedClients := 0
+		if status != nil {
+			connectedClients = len(status.Clients)
+		}
+		log.Info(reason, "connectedClients", connectedClients, "isHA", isHA)
+	}
+	return reason == ""
+}
+
+// notReadyReason returns why the OpenVPN server is not ready, or an empty string if it is ready.
+func notReadyReason(status *OpenVPNStatus, isHA bool) string {
 	if status == nil {
-		log.Info("OpenVPN status is nil", "isHA", isHA)
-		return false
+		return "OpenVPN status is nil"
 	}
 
 	// In HA-mode we need at least 2 clients (one from seed, one from shoot)
 	if isHA {
 		// We need at least 2 connected clients to be considered ready
 		if len(status.Clients) < 2 {
-			log.Info("Not enough connected clients for HA mode", "connectedClients", len(status.Clients), "isHA", isHA)
-			return false
+			return "Not enough connected clients for HA mode"
 		}
 		// We need at least 1 client from the seed and one from the shoot side
 		foundSeedClient := false
@@ -210,27 +236,24 @@ func isReady(log logr.Logger, status *OpenVPNStatus, isHA bool) bool {
 			}
 		}
 
-		ready := foundSeedClient && foundShootClient
-		if !ready {
-			log.Info("Missing required clients for HA mode", "foundSeedClient", foundSeedClient, "foundShootClient", foundShootClient, "isHA", isHA)
+		if !foundSeedClient || !foundShootClient {
+			return fmt.Sprintf("Missing required clients for HA mode (foundSeedClient=%t, foundShootClient=%t)", foundSeedClient, foundShootClient)
 		}
-
-		return ready
+		return ""
 	}
 
 	// In non-HA mode there are two cases:
 	// - No shoot clients connected yet after deployment rollout. This is considered ready as the shoot will connect later.
 	// - At least one shoot client connected. This is considered ready.
 	if len(status.Clients) == 0 {
-		return true
+		return ""
 	}
 	for _, client := range status.Clients {
 		if strings.HasPrefix(client.CommonName, openvpn.ShootClientPrefix) {
-			return true
+			return ""
 		}
 	}
-	log.Info("no shoot client connected yet", "connectedClients", len(status.Clients), "isHA", isHA)
-	return false
+	return "no shoot client connected yet"
 }
 
 // parseRealClientAddress parses a real client address string in the format "IP:Port".
@@ -0,0 +1,290 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package management
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultTimeout is the default time allowed for connecting to the management interface and for each command.
+	DefaultTimeout = 5 * time.Second
+
+	notificationBufferSize = 64
+)
+
+// ErrClosed is returned for commands on a client whose connection has been closed.
+var ErrClosed = errors.New("management connection closed")
+
+// CommandError is returned if the management interface replied to a command with an `ERROR:` line.
+type CommandError struct {
+	Command string
+	Message string
+}
+
+func (e *CommandError) Error() string {
+	return fmt.Sprintf("management command %q failed: %s", e.Command, e.Message)
+}
+
+// Client is a client of the OpenVPN management interface. Commands are executed one at a time. Real-time
+// notifications received in between are parsed and delivered on the Notifications channel.
+type Client struct {
+	conn    net.Conn
+	timeout time.Duration
+
+	// lock serializes the commands, as replies carry no correlation to their command.
+	lock          sync.Mutex
+	lines         chan string
+	notifications chan Notification
+
+	closeOnce sync.Once
+	closed    chan struct{}
+	// done is closed once the connection has been read to its end, readErr is the error which ended it.
+	done    chan struct{}
+	readErr error
+}
+
+// Dial connects to the management interface at address, e.g. `127.0.0.1:7505`. A timeout of 0 selects the
+// DefaultTimeout.
+func Dial(address string, timeout time.Duration) (*Client, error) {
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	conn, err := net.DialTimeout("tcp", address, timeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to management interface %s: %w", address, err)
+	}
+	return NewClient(conn, timeout), nil
+}
+
+// NewClient creates a client using an established connection to the management interface.
+func NewClient(conn net.Conn, timeout time.Duration) *Client {
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	c := &Client{
+		conn:          conn,
+		timeout:       timeout,
+		lines:         make(chan string),
+		notifications: make(chan Notification, notificationBufferSize),
+		closed:        make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+	go c.read()
+	return c
+}
+
+// Notifications returns the channel of real-time notifications. Notifications are dropped if the channel is full.
+// It is closed when the connection is closed.
+func (c *Client) Notifications() <-chan Notification {
+	return c.notifications
+}
+
+// Close closes the connection to the management interface.
+func (c *Client) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		close(c.closed)
+		err = c.conn.Close()
+	})
+	return err
+}
+
+// State returns the current state of the OpenVPN process.
+func (c *Client) State() (State, error) {
+	lines, err := c.multiLineCommand("state")
+	if err != nil {
+		return State{}, err
+	}
+	if len(lines) == 0 {
+		return State{}, fmt.Errorf("empty reply to state command")
+	}
+	return parseState(lines[len(lines)-1])
+}
+
+// Status returns the status of the OpenVPN process in the tab separated format 3.
+func (c *Client) Status() (*Status, error) {
+	lines, err := c.multiLineCommand("status 3")
+	if err != nil {
+		return nil, err
+	}
+	return parseStatus(lines)
+}
+
+// Signal sends a signal, e.g. `SIGHUP` or `SIGUSR1`, to the OpenVPN process.
+func (c *Client) Signal(signal string) error {
+	_, err := c.command("signal " + signal)
+	return err
+}
+
+// Kill disconnects the clients with the given common name or real address (`ip:port`).
+func (c *Client) Kill(commonNameOrAddress string) error {
+	_, err := c.command("kill " + commonNameOrAddress)
+	return err
+}
+
+// ClientKill disconnects the client with the given client ID (server mode). The optional message is sent to the
+// client instead of the default `RESTART`.
+func (c *Client) ClientKill(clientID uint64, message string) error {
+	command := fmt.Sprintf("client-kill %d", clientID)
+	if message != "" {
+		command += " " + message
+	}
+	_, err := c.command(command)
+	return err
+}
+
+// ByteCount enables `>BYTECOUNT:` notifications every interval seconds. An interval of 0 disables them.
+func (c *Client) ByteCount(interval int) error {
+	_, err := c.command(fmt.Sprintf("bytecount %d", interval))
+	return err
+}
+
+// Hold returns whether the hold flag is set.
+func (c *Client) Hold() (bool, error) {
+	reply, err := c.command("hold")
+	if err != nil {
+		return false, err
+	}
+	switch reply {
+	case "hold=0":
+		return false, nil
+	case "hold=1":
+		return true, nil
+	}
+	return false, fmt.Errorf("unexpected reply to hold command: %s", reply)
+}
+
+// SetHold sets or clears the hold flag, which makes OpenVPN wait for HoldRelease on start and restart.
+func (c *Client) SetHold(hold bool) error {
+	command := "hold off"
+	if hold {
+		command = "hold on"
+	}
+	_, err := c.command(command)
+	return err
+}
+
+// HoldRelease releases OpenVPN from the hold state.
+func (c *Client) HoldRelease() error {
+	_, err := c.command("hold release")
+	return err
+}
+
+// command executes a command with a single line reply and returns the message of the `SUCCESS:` line.
+func (c *Client) command(command string) (string, error) {
+	var reply string
+	err := c.execute(command, func(line string) (bool, error) {
+		if message, ok := strings.CutPrefix(line, "SUCCESS:"); ok {
+			reply = strings.TrimSpace(message)
+			return true, nil
+		}
+		if message, ok := strings.CutPrefix(line, "ERROR:"); ok {
+			return true, &CommandError{Command: command, Message: strings.TrimSpace(message)}
+		}
+		return false, nil
+	})
+	return reply, err
+}
+
+// multiLineCommand executes a command whose reply is terminated by an `END` line and returns the lines before it.
+func (c *Client) multiLineCommand(command string) ([]string, error) {
+	var lines []string
+	err := c.execute(command, func(line string) (bool, error) {
+		if line == "END" {
+			return true, nil
+		}
+		if message, ok := strings.CutPrefix(line, "ERROR:"); ok && len(lines) == 0 {
+			return true, &CommandError{Command: command, Message: strings.TrimSpace(message)}
+		}
+		lines = append(lines, line)
+		return false, nil
+	})
+	return lines, err
+}
+
+// execute sends the command and passes the reply lines to handle until it reports the reply as complete.
+// If the reply does not arrive in time the connection is closed, as a late reply could not be told apart from the
+// reply to the next command.
+func (c *Client) execute(command string, handle func(line string) (bool, error)) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	select {
+	case <-c.closed:
+		return c.closedError()
+	default:
+	}
+
+	if err := c.conn.SetWriteDeadline(time.Now().Add(c.timeout)); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(c.conn, "%s\n", command); err != nil {
+		return fmt.Errorf("failed to send management command %q: %w", command, err)
+	}
+
+	timer := time.NewTimer(c.timeout)
+	defer timer.Stop()
+	for {
+		select {
+		case line := <-c.lines:
+			complete, err := handle(line)
+			if complete || err != nil {
+				return err
+			}
+		case <-c.done:
+			return c.closedError()
+		case <-timer.C:
+			_ = c.Close()
+			return fmt.Errorf("timeout waiting for reply to management command %q", command)
+		}
+	}
+}
+
+func (c *Client) closedError() error {
+	select {
+	case <-c.done:
+		if c.readErr != nil {
+			return fmt.Errorf("%w: %w", ErrClosed, c.readErr)
+		}
+	default:
+	}
+	return ErrClosed
+}
+
+// read reads the lines from the connection until it is closed. Notifications are parsed and published, all other
+// lines are handed to the command waiting for its reply.
+func (c *Client) read() {
+	defer close(c.notifications)
+	defer close(c.done)
+
+	parser := &notificationParser{}
+	scanner := bufio.NewScanner(c.conn)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if payload, ok := strings.CutPrefix(line, ">"); ok {
+			if notification := parser.parse(payload); notification != nil {
+				select {
+				case c.notifications <- notification:
+				default:
+				}
+			}
+			continue
+		}
+		select {
+		case c.lines <- line:
+		case <-c.closed:
+			return
+		}
+	}
+	c.readErr = scanner.Err()
+	_ = c.Close()
+}
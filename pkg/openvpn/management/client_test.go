@@ -0,0 +1,164 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package management_test
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/utils/ptr"
+
+	"github.com/gardener/vpn2/pkg/openvpn/management"
+	"github.com/gardener/vpn2/pkg/openvpn/management/fake"
+)
+
+var _ = Describe("Client", func() {
+	var (
+		server *fake.Server
+		client *management.Client
+	)
+
+	BeforeEach(func() {
+		var err error
+		server, err = fake.NewServer()
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(server.Close)
+
+		client, err = management.Dial(server.Addr(), time.Second)
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(client.Close)
+	})
+
+	It("should skip the banner and return the state", func() {
+		Eventually(client.Notifications()).Should(Receive(Equal(management.Other{Kind: "INFO", Message: fake.Banner[len(">INFO:"):]})))
+
+		server.SetState("1766142724,CONNECTED,SUCCESS,192.168.123.6,10.0.0.1,1194,,,fd8f::6")
+		state, err := client.State()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(state.Connected()).To(BeTrue())
+		Expect(state).To(Equal(management.State{
+			Time:        time.Unix(1766142724, 0),
+			Name:        "CONNECTED",
+			LocalIP:     "192.168.123.6",
+			RemoteIP:    "10.0.0.1",
+			RemotePort:  "1194",
+			LocalIPv6:   "fd8f::6",
+			Description: "SUCCESS",
+		}))
+	})
+
+	It("should parse the status of a server", func() {
+		server.SetStatus(
+			"TITLE\tOpenVPN 2.6.16 x86_64-alpine-linux-musl",
+			"TIME\t2025-12-19 11:12:04\t1766142724",
+			"HEADER\tCLIENT_LIST\tCommon Name\tReal Address\tVirtual Address\tVirtual IPv6 Address\tBytes Received\tBytes Sent\tConnected Since\tConnected Since (time_t)\tUsername\tClient ID\tPeer ID\tData Channel Cipher",
+			"CLIENT_LIST\tvpn-shoot-client-0\t100.64.2.43:48782\t\tfd8f:6d53:b97a:1::100:7\t2054255\t3678321\t2025-12-19 08:10:27\t1766131827\tUNDEF\t717\t5\tAES-256-GCM",
+			"HEADER\tROUTING_TABLE\tVirtual Address\tCommon Name\tReal Address\tLast Ref\tLast Ref (time_t)",
+			"ROUTING_TABLE\tb6:f1:5a:3f:9e:a1@0\tvpn-shoot-client-0\t100.64.2.43:48782\t2025-12-19 11:12:03\t1766142723",
+			"GLOBAL_STATS\tdco_enabled\t0",
+		)
+		status, err := client.Status()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(status.Title).To(Equal("OpenVPN 2.6.16 x86_64-alpine-linux-musl"))
+		Expect(status.Time).To(Equal(time.Unix(1766142724, 0)))
+		Expect(status.Clients).To(Equal([]management.ClientStatus{{
+			CommonName:         "vpn-shoot-client-0",
+			RealAddress:        "100.64.2.43:48782",
+			VirtualIPv6Address: "fd8f:6d53:b97a:1::100:7",
+			BytesReceived:      2054255,
+			BytesSent:          3678321,
+			ConnectedSince:     time.Unix(1766131827, 0),
+			Username:           "UNDEF",
+			ClientID:           717,
+			PeerID:             "5",
+			DataChannelCipher:  "AES-256-GCM",
+		}}))
+		Expect(status.Routes).To(Equal([]management.RouteStatus{{
+			VirtualAddress: "b6:f1:5a:3f:9e:a1@0",
+			CommonName:     "vpn-shoot-client-0",
+			RealAddress:    "100.64.2.43:48782",
+			LastRef:        time.Unix(1766142723, 0),
+		}}))
+		Expect(status.Stats).To(Equal(map[string]string{"dco_enabled": "0"}))
+	})
+
+	It("should parse the statistics of a client", func() {
+		server.SetStatus(
+			"OpenVPN STATISTICS",
+			"Updated\t2025-12-19 11:12:04",
+			"TUN/TAP read bytes\t1234",
+		)
+		status, err := client.Status()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(status.Clients).To(BeEmpty())
+		Expect(status.Stats).To(HaveKeyWithValue("TUN/TAP read bytes", "1234"))
+	})
+
+	It("should send signals and manage the hold flag", func() {
+		Expect(client.Signal("SIGHUP")).To(Succeed())
+		Expect(client.SetHold(true)).To(Succeed())
+		Expect(client.Hold()).To(BeTrue())
+		Expect(client.HoldRelease()).To(Succeed())
+		Expect(client.ByteCount(5)).To(Succeed())
+		Expect(server.Commands()).To(Equal([]string{"signal SIGHUP", "hold on", "hold", "hold release", "bytecount 5"}))
+	})
+
+	It("should return a command error for unknown clients", func() {
+		server.SetClients([]string{"vpn-shoot-client"}, []uint64{3})
+		Expect(client.Kill("vpn-shoot-client")).To(Succeed())
+		Expect(client.ClientKill(3, "HALT")).To(Succeed())
+
+		err := client.Kill("vpn-shoot-client-0")
+		var commandErr *management.CommandError
+		Expect(err).To(BeAssignableToTypeOf(commandErr))
+		Expect(err).To(MatchError(`management command "kill vpn-shoot-client-0" failed: common name 'vpn-shoot-client-0' not found`))
+		Expect(client.ClientKill(4, "")).To(HaveOccurred())
+		Expect(server.Commands()).To(ContainElement("client-kill 3 HALT"))
+	})
+
+	It("should parse notifications received while waiting for a reply", func() {
+		server.Reply("bytecount 1",
+			">BYTECOUNT_CLI:717,100,200",
+			">CLIENT:CONNECT,3,1",
+			">CLIENT:ENV,common_name=vpn-shoot-client",
+			">CLIENT:ENV,END",
+			">STATE:1766142724,RECONNECTING,SIGHUP,,,,,",
+			"SUCCESS: bytecount interval changed",
+		)
+		Expect(client.ByteCount(1)).To(Succeed())
+
+		var notifications []management.Notification
+		Eventually(func() []management.Notification {
+			select {
+			case n := <-client.Notifications():
+				notifications = append(notifications, n)
+			default:
+			}
+			return notifications
+		}).Should(HaveLen(4))
+		Expect(notifications[1]).To(Equal(management.ByteCount{ClientID: ptr.To[uint64](717), BytesReceived: 100, BytesSent: 200}))
+		Expect(notifications[2]).To(Equal(management.ClientEvent{Event: "CONNECT", ClientID: 3, KeyID: ptr.To[uint64](1), Env: map[string]string{"common_name": "vpn-shoot-client"}}))
+		Expect(notifications[2].(management.ClientEvent).CommonName()).To(Equal("vpn-shoot-client"))
+		Expect(notifications[3].Type()).To(Equal("STATE"))
+		Expect(notifications[3].(management.State).Name).To(Equal("RECONNECTING"))
+	})
+
+	It("should time out and close the connection if there is no reply", func() {
+		client, err := management.Dial(server.Addr(), 100*time.Millisecond)
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(client.Close)
+		server.Reply("signal SIGUSR1")
+
+		Expect(client.Signal("SIGUSR1")).To(MatchError(ContainSubstring("timeout waiting for reply")))
+		Expect(client.Signal("SIGHUP")).To(MatchError(management.ErrClosed))
+	})
+
+	It("should fail commands once the server closed the connection", func() {
+		Expect(server.Close()).To(Succeed())
+		Eventually(client.Notifications()).Should(BeClosed())
+		Expect(client.Signal("SIGHUP")).To(MatchError(management.ErrClosed))
+	})
+})
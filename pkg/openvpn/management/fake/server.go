@@ -0,0 +1,227 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package fake provides an in-process OpenVPN management interface for tests.
+package fake
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Banner is the notification sent to new connections.
+const Banner = ">INFO:OpenVPN Management Interface Version 5 -- type 'help' for more info"
+
+// Server is a fake OpenVPN management interface listening on a random localhost port. It answers the commands like
+// OpenVPN based on its configured state and records them.
+type Server struct {
+	addr string
+
+	lock        sync.Mutex
+	listener    net.Listener
+	busy        bool
+	conns       []net.Conn
+	commands    []string
+	state       string
+	status      []string
+	commonNames []string
+	clientIDs   []uint64
+	hold        bool
+	replies     map[string][]string
+}
+
+// NewServer starts a fake management interface. It must be closed after use.
+func NewServer() (*Server, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		addr:     listener.Addr().String(),
+		listener: listener,
+		state:    "1700000000,CONNECTED,SUCCESS,192.168.123.6,10.0.0.1,1194,,",
+		replies:  map[string][]string{},
+	}
+	go s.serve(listener)
+	return s, nil
+}
+
+// Addr returns the address to connect to.
+func (s *Server) Addr() string {
+	return s.addr
+}
+
+// Port returns the port the server listens on.
+func (s *Server) Port() int {
+	_, port, _ := net.SplitHostPort(s.addr)
+	p, _ := strconv.Atoi(port)
+	return p
+}
+
+// SetBusy emulates another client connected to the management interface. OpenVPN stops listening while a client is
+// connected, so new connections are refused until the server is no longer busy.
+func (s *Server) SetBusy(busy bool) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if busy == s.busy {
+		return nil
+	}
+	if busy {
+		if err := s.listener.Close(); err != nil {
+			return err
+		}
+		s.busy = true
+		return nil
+	}
+	listener, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return err
+	}
+	s.listener = listener
+	s.busy = false
+	go s.serve(listener)
+	return nil
+}
+
+// Close stops the server and closes all connections. It can be called multiple times.
+func (s *Server) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, conn := range s.conns {
+		_ = conn.Close()
+	}
+	s.conns = nil
+	if err := s.listener.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+		return err
+	}
+	return nil
+}
+
+// Commands returns the commands received so far.
+func (s *Server) Commands() []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return slices.Clone(s.commands)
+}
+
+// SetState sets the comma separated state line returned by the `state` command.
+func (s *Server) SetState(line string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.state = line
+}
+
+// SetStatus sets the lines returned by the `status` command.
+func (s *Server) SetStatus(lines ...string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.status = lines
+}
+
+// SetClients sets the common names and client IDs of the connected clients, which can be killed.
+func (s *Server) SetClients(commonNames []string, clientIDs []uint64) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.commonNames = commonNames
+	s.clientIDs = clientIDs
+}
+
+// Reply overrides the reply to a command. An empty reply makes the server not answer at all.
+func (s *Server) Reply(command string, lines ...string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.replies[command] = lines
+}
+
+// Notify sends the notification lines, e.g. `>STATE:...`, to all connections.
+func (s *Server) Notify(lines ...string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, conn := range s.conns {
+		for _, line := range lines {
+			_, _ = fmt.Fprintf(conn, "%s\r\n", line)
+		}
+	}
+}
+
+func (s *Server) serve(listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		s.lock.Lock()
+		s.conns = append(s.conns, conn)
+		_, _ = fmt.Fprintf(conn, "%s\r\n", Banner)
+		s.lock.Unlock()
+		go s.handle(conn)
+	}
+}
+
+func (s *Server) handle(conn net.Conn) {
+	defer conn.Close()
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		command := strings.TrimSpace(scanner.Text())
+		s.lock.Lock()
+		s.commands = append(s.commands, command)
+		for _, line := range s.reply(command) {
+			_, _ = fmt.Fprintf(conn, "%s\r\n", line)
+		}
+		s.lock.Unlock()
+	}
+}
+
+// reply returns the reply lines to a command. It must be called with the lock held.
+func (s *Server) reply(command string) []string {
+	if lines, ok := s.replies[command]; ok {
+		return lines
+	}
+
+	name, args, _ := strings.Cut(command, " ")
+	switch name {
+	case "state":
+		return []string{s.state, "END"}
+	case "status":
+		return append(slices.Clone(s.status), "END")
+	case "signal":
+		return []string{"SUCCESS: signal " + args + " thrown"}
+	case "kill":
+		if slices.Contains(s.commonNames, args) {
+			return []string{fmt.Sprintf("SUCCESS: common name '%s' found, 1 client(s) killed", args)}
+		}
+		return []string{fmt.Sprintf("ERROR: common name '%s' not found", args)}
+	case "client-kill":
+		idArg, _, _ := strings.Cut(args, " ")
+		if id, err := strconv.ParseUint(idArg, 10, 64); err == nil && slices.Contains(s.clientIDs, id) {
+			return []string{"SUCCESS: client-kill command succeeded"}
+		}
+		return []string{"ERROR: client-kill command failed"}
+	case "bytecount":
+		return []string{"SUCCESS: bytecount interval changed"}
+	case "hold":
+		switch args {
+		case "":
+			if s.hold {
+				return []string{"SUCCESS: hold=1"}
+			}
+			return []string{"SUCCESS: hold=0"}
+		case "on":
+			s.hold = true
+			return []string{"SUCCESS: hold flag set to ON"}
+		case "off":
+			s.hold = false
+			return []string{"SUCCESS: hold flag set to OFF"}
+		case "release":
+			return []string{"SUCCESS: hold release succeeded"}
+		}
+	}
+	return []string{"ERROR: unknown command, enter 'help' for more options"}
+}
@@ -0,0 +1,204 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package management
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Notification is a real-time notification sent by the management interface, i.e. a line starting with `>`.
+type Notification interface {
+	// Type returns the type of the notification, e.g. `STATE`.
+	Type() string
+}
+
+// State is the state of the OpenVPN process as reported by the `state` command and `>STATE:` notifications.
+type State struct {
+	Time        time.Time
+	Name        string
+	Description string
+	LocalIP     string
+	RemoteIP    string
+	RemotePort  string
+	LocalAddr   string
+	LocalPort   string
+	LocalIPv6   string
+}
+
+// Type implements Notification.
+func (State) Type() string { return "STATE" }
+
+// Connected returns true if the state is `CONNECTED`.
+func (s State) Connected() bool {
+	return s.Name == "CONNECTED"
+}
+
+// ByteCount is a `>BYTECOUNT:` notification of a client or a `>BYTECOUNT_CLI:` notification of a server for one of
+// its clients.
+type ByteCount struct {
+	// ClientID is only set for `>BYTECOUNT_CLI:` notifications.
+	ClientID      *uint64
+	BytesReceived uint64
+	BytesSent     uint64
+}
+
+// Type implements Notification.
+func (b ByteCount) Type() string {
+	if b.ClientID != nil {
+		return "BYTECOUNT_CLI"
+	}
+	return "BYTECOUNT"
+}
+
+// ClientEvent is a `>CLIENT:` notification of a server, e.g. `CONNECT` or `DISCONNECT`, together with the environment
+// sent in the following `>CLIENT:ENV` lines.
+type ClientEvent struct {
+	Event    string
+	ClientID uint64
+	KeyID    *uint64
+	// Address is only set for `ADDRESS` events.
+	Address string
+	Env     map[string]string
+}
+
+// Type implements Notification.
+func (ClientEvent) Type() string { return "CLIENT" }
+
+// CommonName returns the common name from the environment of the event.
+func (e ClientEvent) CommonName() string {
+	return e.Env["common_name"]
+}
+
+// Other is any notification not covered by a dedicated type, e.g. `>INFO:` or `>HOLD:`.
+type Other struct {
+	Kind    string
+	Message string
+}
+
+// Type implements Notification.
+func (o Other) Type() string { return o.Kind }
+
+// notificationParser parses notifications. It keeps the client event whose environment is still being received.
+type notificationParser struct {
+	pending *ClientEvent
+}
+
+// parse parses a notification without the leading `>`. It returns nil if the notification is incomplete.
+func (p *notificationParser) parse(payload string) Notification {
+	kind, message, _ := strings.Cut(payload, ":")
+	switch kind {
+	case "STATE":
+		if state, err := parseState(message); err == nil {
+			return state
+		}
+	case "BYTECOUNT", "BYTECOUNT_CLI":
+		if byteCount, err := parseByteCount(kind, message); err == nil {
+			return byteCount
+		}
+	case "CLIENT":
+		return p.parseClient(message)
+	}
+	return Other{Kind: kind, Message: message}
+}
+
+func (p *notificationParser) parseClient(message string) Notification {
+	fields := strings.Split(message, ",")
+	if fields[0] == "ENV" {
+		if p.pending == nil {
+			return nil
+		}
+		if len(fields) == 2 && fields[1] == "END" {
+			event := *p.pending
+			p.pending = nil
+			return event
+		}
+		if name, value, ok := strings.Cut(strings.Join(fields[1:], ","), "="); ok {
+			p.pending.Env[name] = value
+		}
+		return nil
+	}
+
+	if len(fields) < 2 {
+		return Other{Kind: "CLIENT", Message: message}
+	}
+	clientID, err := strconv.ParseUint(fields[1], 10, 64)
+	if err != nil {
+		return Other{Kind: "CLIENT", Message: message}
+	}
+	event := &ClientEvent{Event: fields[0], ClientID: clientID, Env: map[string]string{}}
+	if fields[0] == "ADDRESS" {
+		// the address notification is not followed by an environment
+		if len(fields) >= 3 {
+			event.Address = fields[2]
+		}
+		return *event
+	}
+	if len(fields) >= 3 {
+		if keyID, err := strconv.ParseUint(fields[2], 10, 64); err == nil {
+			event.KeyID = &keyID
+		}
+	}
+	p.pending = event
+	return nil
+}
+
+// parseState parses the comma separated fields of a state line.
+func parseState(line string) (State, error) {
+	fields := strings.Split(line, ",")
+	if len(fields) < 2 {
+		return State{}, fmt.Errorf("invalid state line: %s", line)
+	}
+	seconds, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return State{}, fmt.Errorf("invalid time in state line %s: %w", line, err)
+	}
+	field := func(i int) string {
+		if i < len(fields) {
+			return fields[i]
+		}
+		return ""
+	}
+	return State{
+		Time:        time.Unix(seconds, 0),
+		Name:        fields[1],
+		Description: field(2),
+		LocalIP:     field(3),
+		RemoteIP:    field(4),
+		RemotePort:  field(5),
+		LocalAddr:   field(6),
+		LocalPort:   field(7),
+		LocalIPv6:   field(8),
+	}, nil
+}
+
+func parseByteCount(kind, message string) (ByteCount, error) {
+	fields := strings.Split(message, ",")
+	var byteCount ByteCount
+	if kind == "BYTECOUNT_CLI" {
+		if len(fields) != 3 {
+			return byteCount, fmt.Errorf("invalid %s notification: %s", kind, message)
+		}
+		clientID, err := strconv.ParseUint(fields[0], 10, 64)
+		if err != nil {
+			return byteCount, err
+		}
+		byteCount.ClientID = &clientID
+		fields = fields[1:]
+	}
+	if len(fields) != 2 {
+		return byteCount, fmt.Errorf("invalid %s notification: %s", kind, message)
+	}
+	var err error
+	if byteCount.BytesReceived, err = strconv.ParseUint(fields[0], 10, 64); err != nil {
+		return byteCount, err
+	}
+	if byteCount.BytesSent, err = strconv.ParseUint(fields[1], 10, 64); err != nil {
+		return byteCount, err
+	}
+	return byteCount, nil
+}
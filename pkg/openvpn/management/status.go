@@ -0,0 +1,138 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package management
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Status is the reply to the `status 3` command.
+type Status struct {
+	Title string
+	Time  time.Time
+	// Clients and Routes are only reported by servers.
+	Clients []ClientStatus
+	Routes  []RouteStatus
+	// Stats are the global stats of a server or the statistics of a client, e.g. `TUN/TAP read bytes`.
+	Stats map[string]string
+}
+
+// ClientStatus is a `CLIENT_LIST` entry of the status.
+type ClientStatus struct {
+	CommonName         string
+	RealAddress        string
+	VirtualAddress     string
+	VirtualIPv6Address string
+	BytesReceived      uint64
+	BytesSent          uint64
+	ConnectedSince     time.Time
+	Username           string
+	ClientID           uint64
+	PeerID             string
+	DataChannelCipher  string
+}
+
+// RouteStatus is a `ROUTING_TABLE` entry of the status.
+type RouteStatus struct {
+	VirtualAddress string
+	CommonName     string
+	RealAddress    string
+	LastRef        time.Time
+}
+
+func parseStatus(lines []string) (*Status, error) {
+	status := &Status{Stats: map[string]string{}}
+	for _, line := range lines {
+		fields := strings.Split(line, "\t")
+		switch fields[0] {
+		case "HEADER", "OpenVPN STATISTICS":
+		case "TITLE":
+			status.Title = strings.Join(fields[1:], "\t")
+		case "TIME":
+			if len(fields) >= 3 {
+				t, err := parseUnixTime(fields[2])
+				if err != nil {
+					return nil, fmt.Errorf("invalid TIME line %q: %w", line, err)
+				}
+				status.Time = t
+			}
+		case "CLIENT_LIST":
+			client, err := parseClientStatus(fields)
+			if err != nil {
+				return nil, fmt.Errorf("invalid CLIENT_LIST line %q: %w", line, err)
+			}
+			status.Clients = append(status.Clients, client)
+		case "ROUTING_TABLE":
+			if len(fields) < 6 {
+				return nil, fmt.Errorf("invalid ROUTING_TABLE line %q", line)
+			}
+			lastRef, err := parseUnixTime(fields[5])
+			if err != nil {
+				return nil, fmt.Errorf("invalid ROUTING_TABLE line %q: %w", line, err)
+			}
+			status.Routes = append(status.Routes, RouteStatus{
+				VirtualAddress: fields[1],
+				CommonName:     fields[2],
+				RealAddress:    fields[3],
+				LastRef:        lastRef,
+			})
+		case "GLOBAL_STATS":
+			if len(fields) >= 3 {
+				status.Stats[fields[1]] = fields[2]
+			}
+		default:
+			if len(fields) == 2 {
+				status.Stats[fields[0]] = fields[1]
+			}
+		}
+	}
+	return status, nil
+}
+
+func parseClientStatus(fields []string) (ClientStatus, error) {
+	if len(fields) < 13 {
+		return ClientStatus{}, fmt.Errorf("expected at least 13 fields, got %d", len(fields))
+	}
+	bytesReceived, err := strconv.ParseUint(fields[5], 10, 64)
+	if err != nil {
+		return ClientStatus{}, err
+	}
+	bytesSent, err := strconv.ParseUint(fields[6], 10, 64)
+	if err != nil {
+		return ClientStatus{}, err
+	}
+	connectedSince, err := parseUnixTime(fields[8])
+	if err != nil {
+		return ClientStatus{}, err
+	}
+	clientID, err := strconv.ParseUint(fields[10], 10, 64)
+	if err != nil {
+		return ClientStatus{}, err
+	}
+	return ClientStatus{
+		CommonName:         fields[1],
+		RealAddress:        fields[2],
+		VirtualAddress:     fields[3],
+		VirtualIPv6Address: fields[4],
+		BytesReceived:      bytesReceived,
+		BytesSent:          bytesSent,
+		ConnectedSince:     connectedSince,
+		Username:           fields[9],
+		ClientID:           clientID,
+		PeerID:             fields[11],
+		DataChannelCipher:  fields[12],
+	}, nil
+}
+
+func parseUnixTime(value string) (time.Time, error) {
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(seconds, 0), nil
+}
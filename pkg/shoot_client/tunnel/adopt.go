@@ -0,0 +1,87 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package tunnel
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/vishvananda/netlink"
+
+	"github.com/gardener/vpn2/pkg/constants"
+	"github.com/gardener/vpn2/pkg/network"
+)
+
+// tunnelLinkPrefix is the prefix of the names of the tunnel devices to the kube-apiservers.
+const tunnelLinkPrefix = constants.BondDevice + "ip6tnl"
+
+// adoptTunnels rebuilds the kube-apiservers from the tunnel devices left behind by a previous run, so that the
+// tunnel-controller is ready right after a restart. Adopted kube-apiservers which are not re-announced within the
+// grace period are removed with their tunnel devices. Tunnel devices which cannot be adopted are deleted.
+func (c *Controller) adoptTunnels(log logr.Logger, localBond net.IP) error {
+	links, err := netlink.LinkList()
+	if err != nil {
+		return fmt.Errorf("error listing links: %w", err)
+	}
+	for _, link := range links {
+		tunnel, ok := link.(*netlink.Ip6tnl)
+		if !ok || !strings.HasPrefix(tunnel.Name, tunnelLinkPrefix) {
+			continue
+		}
+		routes, err := netlink.RouteList(link, netlink.FAMILY_ALL)
+		if err != nil {
+			return fmt.Errorf("error listing routes of %s: %w", tunnel.Name, err)
+		}
+		podIP, err := adoptablePodIP(tunnel, routes, localBond)
+		if err != nil {
+			log.Info("deleting orphaned tunnel device", "name", tunnel.Name, "reason", err)
+			if err := network.DeleteLinkByName(tunnel.Name); err != nil {
+				log.Error(err, "failed to delete orphaned tunnel device", "name", tunnel.Name)
+			}
+			continue
+		}
+		c.adopt(log, localBond, tunnel.Remote, podIP)
+	}
+	return nil
+}
+
+// adoptablePodIP returns the pod IP of the kube-apiserver the tunnel device leads to, i.e. the destination of its host
+// route. The device must be a tunnel from the local bond IP.
+func adoptablePodIP(tunnel *netlink.Ip6tnl, routes []netlink.Route, localBond net.IP) (string, error) {
+	if !tunnel.Local.Equal(localBond) {
+		return "", fmt.Errorf("local address %s is not the bond IP %s", tunnel.Local, localBond)
+	}
+	for _, route := range routes {
+		if route.Dst == nil {
+			continue
+		}
+		if ones, bits := route.Dst.Mask.Size(); ones == bits && bits > 0 {
+			return route.Dst.IP.String(), nil
+		}
+	}
+	return "", errors.New("no route to a kube-apiserver pod")
+}
+
+// adopt registers a kube-apiserver whose tunnel device is already set up.
+func (c *Controller) adopt(log logr.Logger, localBond, remote net.IP, podIP string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.kubeApiservers[remote.String()] = &kubeApiserverData{
+		log:              log,
+		recorder:         c.recorder,
+		metrics:          c.metrics,
+		localAddr:        localBond,
+		remoteAddr:       remote.To16(),
+		podIP:            podIP,
+		lastSeen:         time.Now(),
+		creationComplete: true,
+		adopted:          true,
+	}
+	log.Info("adopted tunnel device", "remoteAddr", remote, "podIP", podIP)
+}
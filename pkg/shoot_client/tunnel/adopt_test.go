@@ -0,0 +1,75 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package tunnel
+
+import (
+	"net"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/vishvananda/netlink"
+
+	"github.com/gardener/vpn2/pkg/config"
+	"github.com/gardener/vpn2/pkg/events"
+)
+
+var _ = Describe("Adoption of existing tunnel devices", func() {
+	var (
+		localBond = net.ParseIP("fd8f:6d53:b97a:1::b00:2")
+		remote    = net.ParseIP("fd8f:6d53:b97a:1::a:6987")
+		tunnel    *netlink.Ip6tnl
+	)
+
+	BeforeEach(func() {
+		tunnel = &netlink.Ip6tnl{
+			LinkAttrs: netlink.LinkAttrs{Name: "bond0ip6tnl6987"},
+			Local:     localBond,
+			Remote:    remote,
+		}
+	})
+
+	hostRoute := func(cidr string) netlink.Route {
+		_, dst, err := net.ParseCIDR(cidr)
+		Expect(err).NotTo(HaveOccurred())
+		return netlink.Route{Dst: dst}
+	}
+
+	Describe("adoptablePodIP", func() {
+		It("returns the destination of the host route", func() {
+			routes := []netlink.Route{hostRoute("fe80::/64"), hostRoute("10.10.0.1/32")}
+			Expect(adoptablePodIP(tunnel, routes, localBond)).To(Equal("10.10.0.1"))
+		})
+
+		It("supports IPv6 pod IPs", func() {
+			Expect(adoptablePodIP(tunnel, []netlink.Route{hostRoute("fd00:10::5/128")}, localBond)).To(Equal("fd00:10::5"))
+		})
+
+		It("rejects tunnel devices without host route", func() {
+			_, err := adoptablePodIP(tunnel, []netlink.Route{hostRoute("fe80::/64"), {}}, localBond)
+			Expect(err).To(MatchError("no route to a kube-apiserver pod"))
+		})
+
+		It("rejects tunnel devices from another local address", func() {
+			_, err := adoptablePodIP(tunnel, []netlink.Route{hostRoute("10.10.0.1/32")}, net.ParseIP("fd8f:6d53:b97a:1::b00:3"))
+			Expect(err).To(MatchError("local address fd8f:6d53:b97a:1::b00:2 is not the bond IP fd8f:6d53:b97a:1::b00:3"))
+		})
+	})
+
+	Describe("Controller.adopt", func() {
+		It("registers a ready kube-apiserver for the tunnel device", func() {
+			c := NewController(config.DefaultTunnelControllerConfig, events.Discard())
+			c.adopt(logr.Discard(), localBond, remote, "10.10.0.1")
+
+			Expect(c.kubeApiservers).To(HaveKey(remote.String()))
+			d := c.kubeApiservers[remote.String()]
+			Expect(d.adopted).To(BeTrue())
+			Expect(d.linkName()).To(Equal(tunnel.Name))
+			Expect(d.needsUpdate("10.10.0.1")).To(BeFalse())
+			ready, _ := c.IsReady()
+			Expect(ready).To(BeTrue())
+		})
+	})
+})
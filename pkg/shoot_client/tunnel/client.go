@@ -5,12 +5,28 @@
 package tunnel
 
 import (
+	"bytes"
+	"encoding/hex"
 	"fmt"
+	"math/rand/v2"
 	"net"
+	"time"
 )
 
-// Send sends a client IP to the tunnel controller.
-func Send(tunnelControllerIP net.IP, clientIP string) error {
+// echoPrefix marks the UDP packets which the tunnel controller sends back instead of interpreting them as registration.
+const echoPrefix = "ECHO "
+
+// Send registers the client IP at the tunnel controller. The registration is authenticated with the secret if it is set.
+func Send(tunnelControllerIP net.IP, clientIP string, secret []byte) error {
+	return send(tunnelControllerIP, MessageTypeRegister, clientIP, secret)
+}
+
+// Deregister deregisters the client IP at the tunnel controller, which deletes the tunnel to the client immediately.
+func Deregister(tunnelControllerIP net.IP, clientIP string, secret []byte) error {
+	return send(tunnelControllerIP, MessageTypeDeregister, clientIP, secret)
+}
+
+func send(tunnelControllerIP net.IP, msgType, clientIP string, secret []byte) error {
 	serverAddr := fmt.Sprintf("[%s]:%d", tunnelControllerIP.String(), tunnelControllerPort)
 	conn, err := net.Dial("udp6", serverAddr)
 	if err != nil {
@@ -18,8 +34,52 @@ func Send(tunnelControllerIP net.IP, clientIP string) error {
 	}
 	defer conn.Close()
 
-	if _, err = conn.Write([]byte(clientIP)); err != nil {
+	// the message is bound to the local bond address chosen for the connection
+	msg, err := newMessage(msgType, clientIP, conn.LocalAddr().(*net.UDPAddr).IP, time.Now(), secret)
+	if err != nil {
+		return fmt.Errorf("error encoding %s message: %w", msgType, err)
+	}
+
+	if _, err = conn.Write(msg); err != nil {
 		return fmt.Errorf("error sending data to %s: %w", serverAddr, err)
 	}
 	return nil
 }
+
+// Echo sends an echo request to the tunnel controller and returns the round-trip time of its reply.
+func Echo(tunnelControllerIP net.IP, timeout time.Duration) (time.Duration, error) {
+	return echo(fmt.Sprintf("[%s]:%d", tunnelControllerIP.String(), tunnelControllerPort), timeout)
+}
+
+func echo(serverAddr string, timeout time.Duration) (time.Duration, error) {
+	conn, err := net.Dial("udp", serverAddr)
+	if err != nil {
+		return 0, fmt.Errorf("error dialing UDP for %s: %w", serverAddr, err)
+	}
+	defer conn.Close()
+
+	request := fmt.Appendf(nil, "%s%016x", echoPrefix, rand.Uint64())
+	start := time.Now()
+	_ = conn.SetDeadline(start.Add(timeout))
+	if _, err = conn.Write(request); err != nil {
+		return 0, fmt.Errorf("error sending echo request to %s: %w", serverAddr, err)
+	}
+	reply := make([]byte, len(request)+1)
+	n, err := conn.Read(reply)
+	if err != nil {
+		return 0, fmt.Errorf("error reading echo reply from %s: %w", serverAddr, err)
+	}
+	if !bytes.Equal(reply[:n], request) {
+		return 0, fmt.Errorf("unexpected echo reply from %s: %q", serverAddr, reply[:n])
+	}
+	return time.Since(start), nil
+}
+
+// isEcho checks if the payload is an echo request as sent by Echo, i.e. the prefix followed by 16 hex digits.
+func isEcho(payload []byte) bool {
+	if len(payload) != len(echoPrefix)+16 || !bytes.HasPrefix(payload, []byte(echoPrefix)) {
+		return false
+	}
+	_, err := hex.DecodeString(string(payload[len(echoPrefix):]))
+	return err == nil
+}
@@ -0,0 +1,113 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build linux
+
+package tunnel
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+
+	"github.com/gardener/vpn2/pkg/constants"
+)
+
+// keepaliveFilter is a classic BPF program for packet sockets without link layer header, which only accepts IPv6
+// packets to the UDP port of the tunnel-controller, so that the traffic of the tunnels is not copied to user space.
+// Extension headers are not expected in the packets sent by the path-controller.
+var keepaliveFilter = []unix.SockFilter{
+	// load the next header field of the IPv6 header
+	{Code: unix.BPF_LD | unix.BPF_B | unix.BPF_ABS, K: 6},
+	{Code: unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K, Jt: 0, Jf: 3, K: unix.IPPROTO_UDP},
+	// load the destination port of the UDP header following the IPv6 header of 40 bytes
+	{Code: unix.BPF_LD | unix.BPF_H | unix.BPF_ABS, K: 42},
+	{Code: unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K, Jt: 0, Jf: 1, K: tunnelControllerPort},
+	{Code: unix.BPF_RET | unix.BPF_K, K: 0xffff},
+	{Code: unix.BPF_RET | unix.BPF_K, K: 0},
+}
+
+// listenForKeepalives counts the keepalives arriving through the tap device of each vpn-shoot-client with a packet
+// socket until the controller is stopped. The packets are still received by the UDP socket of the controller.
+func (c *Controller) listenForKeepalives(log logr.Logger, clients []*shootClient, secret []byte) error {
+	var fds []int
+	for _, client := range clients {
+		fd, err := openKeepaliveSocket(client.tapDevice)
+		if err != nil {
+			for _, fd := range fds {
+				_ = unix.Close(fd)
+			}
+			return err
+		}
+		fds = append(fds, fd)
+	}
+	for i, client := range clients {
+		go c.countKeepalives(log, fds[i], client, secret)
+	}
+	return nil
+}
+
+func openKeepaliveSocket(tapDevice string) (int, error) {
+	link, err := netlink.LinkByName(tapDevice)
+	if err != nil {
+		return -1, fmt.Errorf("error getting link %s: %w", tapDevice, err)
+	}
+	// the socket does not receive packets until it is bound with a protocol, so that only filtered packets are counted
+	fd, err := unix.Socket(unix.AF_PACKET, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return -1, fmt.Errorf("error opening packet socket for %s: %w", tapDevice, err)
+	}
+	if err := setupKeepaliveSocket(fd, link.Attrs().Index); err != nil {
+		_ = unix.Close(fd)
+		return -1, fmt.Errorf("error setting up packet socket for %s: %w", tapDevice, err)
+	}
+	return fd, nil
+}
+
+func setupKeepaliveSocket(fd, ifindex int) error {
+	if err := unix.SetsockoptSockFprog(fd, unix.SOL_SOCKET, unix.SO_ATTACH_FILTER, &unix.SockFprog{
+		Len:    uint16(len(keepaliveFilter)), // #nosec: G115 -- the filter has a fixed length
+		Filter: &keepaliveFilter[0],
+	}); err != nil {
+		return err
+	}
+	// wake up regularly to stop counting once the controller is stopped
+	timeout := unix.NsecToTimeval(constants.TunnelControllerUpdateTimeout.Nanoseconds())
+	if err := unix.SetsockoptTimeval(fd, unix.SOL_SOCKET, unix.SO_RCVTIMEO, &timeout); err != nil {
+		return err
+	}
+	return unix.Bind(fd, &unix.SockaddrLinklayer{Protocol: htons(unix.ETH_P_IPV6), Ifindex: ifindex})
+}
+
+func (c *Controller) countKeepalives(log logr.Logger, fd int, client *shootClient, secret []byte) {
+	defer unix.Close(fd)
+	// the replays are tracked per vpn-shoot-client, as each message arrives through only one of them
+	replays := newReplayCache()
+	buffer := make([]byte, 1024)
+	for c.isRunning() {
+		n, from, err := unix.Recvfrom(fd, buffer, unix.MSG_TRUNC)
+		if err != nil {
+			if errors.Is(err, unix.EAGAIN) || errors.Is(err, unix.EINTR) {
+				continue
+			}
+			log.Error(err, "reading keepalives failed, counting keepalives for all vpn-shoot-clients", "clientIndex", client.index, "device", client.tapDevice)
+			c.setKeepaliveAttribution(false)
+			return
+		}
+		if addr, ok := from.(*unix.SockaddrLinklayer); ok && addr.Pkttype == unix.PACKET_OUTGOING {
+			continue
+		}
+		if n <= len(buffer) && isKeepalive(buffer[:n], time.Now(), secret, replays) {
+			client.keepalives.Add(1)
+		}
+	}
+}
+
+func htons(v uint16) uint16 {
+	return v<<8 | v>>8
+}
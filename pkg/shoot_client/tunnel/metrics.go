@@ -0,0 +1,205 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package tunnel
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const (
+	metricsPath      = "/metrics"
+	metricsNamespace = "vpn_tunnel_controller"
+)
+
+// tunnelMetrics are the metrics of the tunnel-controller and its watchdog.
+// The methods do nothing on a nil receiver, so that the parts of the controller can be used without metrics.
+type tunnelMetrics struct {
+	registry *prometheus.Registry
+
+	tunnelCreations        prometheus.Counter
+	tunnelCreationFailures prometheus.Counter
+	tunnelFailedCount      *prometheus.GaugeVec
+	tunnelBackoffs         prometheus.Counter
+	rejectedMessages       prometheus.Counter
+	readTimeouts           prometheus.Counter
+	watchdogFailures       *prometheus.GaugeVec
+	watchdogFailureRatio   *prometheus.GaugeVec
+	watchdogCooldown       *prometheus.GaugeVec
+	watchdogCooldownTime   *prometheus.GaugeVec
+	watchdogTriggers       *prometheus.CounterVec
+	shootClientSignals     *prometheus.CounterVec
+}
+
+// newTunnelMetrics creates the metrics of the controller, the number of kube-apiservers is read from the controller.
+func newTunnelMetrics(c *Controller) *tunnelMetrics {
+	m := &tunnelMetrics{
+		registry: prometheus.NewRegistry(),
+		tunnelCreations: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "tunnel_creations_total",
+			Help:      "Number of attempts to set up the tunnel device and route to a kube-apiserver pod.",
+		}),
+		tunnelCreationFailures: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "tunnel_creation_failures_total",
+			Help:      "Number of failed attempts to set up the tunnel device and route to a kube-apiserver pod.",
+		}),
+		tunnelFailedCount: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "tunnel_creation_consecutive_failures",
+			Help:      "Number of consecutive failed attempts to set up the tunnel to a kube-apiserver.",
+		}, []string{"remote"}),
+		tunnelBackoffs: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "tunnel_creation_backoffs_total",
+			Help:      "Number of registrations not retrying a failed tunnel setup because of the backoff.",
+		}),
+		rejectedMessages: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "rejected_messages_total",
+			Help:      "Number of invalid or unauthenticated registration messages.",
+		}),
+		readTimeouts: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "udp_read_timeouts_total",
+			Help:      "Number of times no UDP packet arrived within the read timeout.",
+		}),
+		watchdogFailures: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "watchdog_window_failures",
+			Help:      "Number of failures in the sliding window of the watchdog of a vpn-shoot-client.",
+		}, []string{"client"}),
+		watchdogFailureRatio: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "watchdog_failure_ratio",
+			Help:      "Ratio of failures in the window of the time-based watchdog of a vpn-shoot-client.",
+		}, []string{"client"}),
+		watchdogCooldownTime: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "watchdog_cooldown_remaining_seconds",
+			Help:      "Remaining cooldown of the time-based watchdog of a vpn-shoot-client after it has been triggered, 0 if not in cooldown.",
+		}, []string{"client"}),
+		watchdogCooldown: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "watchdog_cooldown_remaining",
+			Help:      "Number of events the watchdog of a vpn-shoot-client still ignores after it has been triggered, 0 if not in cooldown.",
+		}, []string{"client"}),
+		watchdogTriggers: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "watchdog_triggers_total",
+			Help:      "Number of times the watchdog of a vpn-shoot-client has been triggered.",
+		}, []string{"client"}),
+		shootClientSignals: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "shoot_client_signals_total",
+			Help:      "Number of signals sent by the watchdog to restart a vpn-shoot-client.",
+		}, []string{"client", "signal"}),
+	}
+	m.registry.MustRegister(
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "kube_apiservers",
+			Help:      "Number of registered kube-apiservers.",
+		}, func() float64 {
+			c.lock.Lock()
+			defer c.lock.Unlock()
+			return float64(len(c.kubeApiservers))
+		}),
+		m.tunnelCreations,
+		m.tunnelCreationFailures,
+		m.tunnelFailedCount,
+		m.tunnelBackoffs,
+		m.rejectedMessages,
+		m.readTimeouts,
+		m.watchdogFailures,
+		m.watchdogFailureRatio,
+		m.watchdogCooldown,
+		m.watchdogCooldownTime,
+		m.watchdogTriggers,
+		m.shootClientSignals,
+	)
+	return m
+}
+
+func (m *tunnelMetrics) handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// observeTunnelCreation records an attempt to set up the tunnel to a kube-apiserver and its consecutive failures.
+func (m *tunnelMetrics) observeTunnelCreation(remote string, failedCount int, err error) {
+	if m == nil {
+		return
+	}
+	m.tunnelCreations.Inc()
+	if err != nil {
+		m.tunnelCreationFailures.Inc()
+	}
+	m.tunnelFailedCount.WithLabelValues(remote).Set(float64(failedCount))
+}
+
+// forgetTunnel removes the metrics of the tunnel to a kube-apiserver which has been deleted.
+func (m *tunnelMetrics) forgetTunnel(remote string) {
+	if m == nil {
+		return
+	}
+	m.tunnelFailedCount.DeleteLabelValues(remote)
+}
+
+func (m *tunnelMetrics) observeBackoff() {
+	if m == nil {
+		return
+	}
+	m.tunnelBackoffs.Inc()
+}
+
+func (m *tunnelMetrics) observeRejectedMessage() {
+	if m == nil {
+		return
+	}
+	m.rejectedMessages.Inc()
+}
+
+func (m *tunnelMetrics) observeReadTimeout() {
+	if m == nil {
+		return
+	}
+	m.readTimeouts.Inc()
+}
+
+// observeWatchdog records the state of the watchdog of a vpn-shoot-client after an event.
+func (m *tunnelMetrics) observeWatchdog(client string, failures, cooldown int, triggered bool) {
+	if m == nil {
+		return
+	}
+	m.watchdogFailures.WithLabelValues(client).Set(float64(failures))
+	m.watchdogCooldown.WithLabelValues(client).Set(float64(cooldown))
+	if triggered {
+		m.watchdogTriggers.WithLabelValues(client).Inc()
+	}
+}
+
+// observeTimeWatchdog records the state of the time-based watchdog of a vpn-shoot-client after an event.
+func (m *tunnelMetrics) observeTimeWatchdog(client string, failures int, ratio float64, cooldown time.Duration, triggered bool) {
+	if m == nil {
+		return
+	}
+	m.watchdogFailures.WithLabelValues(client).Set(float64(failures))
+	m.watchdogFailureRatio.WithLabelValues(client).Set(ratio)
+	m.watchdogCooldownTime.WithLabelValues(client).Set(cooldown.Seconds())
+	if triggered {
+		m.watchdogTriggers.WithLabelValues(client).Inc()
+	}
+}
+
+func (m *tunnelMetrics) observeSignal(client, signal string) {
+	if m == nil {
+		return
+	}
+	m.shootClientSignals.WithLabelValues(client, signal).Inc()
+}
@@ -0,0 +1,166 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package tunnel
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http/httptest"
+	"time"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	testclock "k8s.io/utils/clock/testing"
+	"k8s.io/utils/ptr"
+
+	"github.com/gardener/vpn2/pkg/config"
+	"github.com/gardener/vpn2/pkg/events"
+)
+
+var _ = Describe("#tunnelMetrics", func() {
+	var c *Controller
+
+	BeforeEach(func() {
+		c = NewController(config.DefaultTunnelControllerConfig, events.Discard())
+	})
+
+	scrape := func() string {
+		recorder := httptest.NewRecorder()
+		c.NewReadinessServer().Handler.ServeHTTP(recorder, httptest.NewRequest("GET", metricsPath, nil))
+		body, err := io.ReadAll(recorder.Result().Body)
+		Expect(err).NotTo(HaveOccurred())
+		return string(body)
+	}
+
+	newData := func(remote string) *kubeApiserverData {
+		return &kubeApiserverData{
+			log:        logr.Discard(),
+			recorder:   events.Discard(),
+			metrics:    c.metrics,
+			remoteAddr: net.ParseIP(remote),
+			podIP:      "100.96.0.5",
+		}
+	}
+
+	It("should expose the number of registered kube-apiservers", func() {
+		c.kubeApiservers["fd8f:6d53:b97a:1::a:1"] = newData("fd8f:6d53:b97a:1::a:1")
+		c.kubeApiservers["fd8f:6d53:b97a:1::a:2"] = newData("fd8f:6d53:b97a:1::a:2")
+
+		Expect(scrape()).To(ContainSubstring(`vpn_tunnel_controller_kube_apiservers 2`))
+	})
+
+	It("should record failed tunnel creations and backoffs", func() {
+		data := newData("fd8f:6d53:b97a:1::a:1")
+		data._setFailed(errors.New("fail"))
+		data._setFailed(errors.New("fail"))
+		Expect(data.needsUpdate("100.96.0.5")).To(BeFalse())
+
+		Expect(scrape()).To(And(
+			ContainSubstring(`vpn_tunnel_controller_tunnel_creations_total 2`),
+			ContainSubstring(`vpn_tunnel_controller_tunnel_creation_failures_total 2`),
+			ContainSubstring(`vpn_tunnel_controller_tunnel_creation_consecutive_failures{remote="fd8f:6d53:b97a:1::a:1"} 2`),
+			ContainSubstring(`vpn_tunnel_controller_tunnel_creation_backoffs_total 1`),
+		))
+
+		c.metrics.forgetTunnel("fd8f:6d53:b97a:1::a:1")
+		Expect(scrape()).NotTo(ContainSubstring(`vpn_tunnel_controller_tunnel_creation_consecutive_failures{`))
+	})
+
+	It("should not count a backoff once it has expired", func() {
+		data := newData("fd8f:6d53:b97a:1::a:1")
+		data.lastCreationFailed = ptr.To(time.Now().Add(-2 * creationFailureBackoff))
+		Expect(data.needsUpdate("100.96.0.5")).To(BeTrue())
+
+		Expect(scrape()).To(ContainSubstring(`vpn_tunnel_controller_tunnel_creation_backoffs_total 0`))
+	})
+
+	It("should record the state of the watchdog", func() {
+		triggered := 0
+		wd, err := NewWatchdog(logr.Discard(), 3, 2, 2, ActionFunc(func() error {
+			triggered++
+			return nil
+		}))
+		Expect(err).NotTo(HaveOccurred())
+		wd.metrics = c.metrics
+		wd.client = "1"
+
+		Expect(wd.Fail()).To(Succeed())
+		Expect(scrape()).To(And(
+			ContainSubstring(`vpn_tunnel_controller_watchdog_window_failures{client="1"} 1`),
+			ContainSubstring(`vpn_tunnel_controller_watchdog_cooldown_remaining{client="1"} 0`),
+			Not(ContainSubstring(`vpn_tunnel_controller_watchdog_triggers_total`)),
+		))
+
+		Expect(wd.Fail()).To(Succeed())
+		Expect(triggered).To(Equal(1))
+		Expect(scrape()).To(And(
+			ContainSubstring(`vpn_tunnel_controller_watchdog_window_failures{client="1"} 0`),
+			ContainSubstring(`vpn_tunnel_controller_watchdog_cooldown_remaining{client="1"} 2`),
+			ContainSubstring(`vpn_tunnel_controller_watchdog_triggers_total{client="1"} 1`),
+		))
+
+		Expect(wd.Fail()).To(Succeed())
+		Expect(scrape()).To(ContainSubstring(`vpn_tunnel_controller_watchdog_cooldown_remaining{client="1"} 1`))
+	})
+
+	It("should record the state of the time-based watchdog", func() {
+		fakeClock := testclock.NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+		wd, err := NewTimeWatchdog(logr.Discard(), fakeClock, 10*time.Second, 0.5, 20*time.Second, ActionFunc(func() error { return nil }))
+		Expect(err).NotTo(HaveOccurred())
+		wd.metrics = c.metrics
+		wd.client = "1"
+
+		fakeClock.Step(5 * time.Second)
+		Expect(wd.Succeed()).To(Succeed())
+		Expect(wd.Fail()).To(Succeed())
+		Expect(scrape()).To(And(
+			ContainSubstring(`vpn_tunnel_controller_watchdog_window_failures{client="1"} 1`),
+			ContainSubstring(`vpn_tunnel_controller_watchdog_failure_ratio{client="1"} 0.5`),
+			ContainSubstring(`vpn_tunnel_controller_watchdog_cooldown_remaining_seconds{client="1"} 0`),
+		))
+
+		fakeClock.Step(5 * time.Second)
+		Expect(wd.Fail()).To(Succeed())
+		Expect(scrape()).To(And(
+			ContainSubstring(`vpn_tunnel_controller_watchdog_failure_ratio{client="1"} 0`),
+			ContainSubstring(`vpn_tunnel_controller_watchdog_cooldown_remaining_seconds{client="1"} 20`),
+			ContainSubstring(`vpn_tunnel_controller_watchdog_triggers_total{client="1"} 1`),
+		))
+	})
+
+	It("should count the signals sent to the vpn-shoot-clients", func() {
+		e := &escalation{log: logr.Discard(), metrics: c.metrics, client: "0", signals: []string{"SIGUSR1"}, signal: func(_, _ string) error { return nil }}
+		Expect(e.Run()).To(Succeed())
+		Expect(e.Run()).To(Succeed())
+
+		Expect(scrape()).To(ContainSubstring(`vpn_tunnel_controller_shoot_client_signals_total{client="0",signal="SIGUSR1"} 2`))
+	})
+
+	It("should count read timeouts and rejected messages", func() {
+		c.metrics.observeReadTimeout()
+		c.metrics.observeRejectedMessage()
+
+		Expect(scrape()).To(And(
+			ContainSubstring(`vpn_tunnel_controller_udp_read_timeouts_total 1`),
+			ContainSubstring(`vpn_tunnel_controller_rejected_messages_total 1`),
+		))
+	})
+
+	It("should do nothing without metrics", func() {
+		var metrics *tunnelMetrics
+		Expect(func() {
+			metrics.observeTunnelCreation("fd8f:6d53:b97a:1::a:1", 1, errors.New("fail"))
+			metrics.forgetTunnel("fd8f:6d53:b97a:1::a:1")
+			metrics.observeBackoff()
+			metrics.observeReadTimeout()
+			metrics.observeRejectedMessage()
+			metrics.observeWatchdog("0", 1, 0, true)
+			metrics.observeTimeWatchdog("0", 1, 0.5, time.Second, true)
+			metrics.observeSignal("0", "SIGHUP")
+		}).NotTo(Panic())
+	})
+})
@@ -0,0 +1,203 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package tunnel
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	// ProtocolVersion is the version of the registration protocol between the path-controller and the tunnel-controller.
+	ProtocolVersion = 1
+	// MessageTypeRegister is the type of the message registering the pod IP of a kube-apiserver.
+	MessageTypeRegister = "register"
+	// MessageTypeDeregister is the type of the message sent by a kube-apiserver pod shutting down, so that its tunnel is
+	// deleted immediately.
+	MessageTypeDeregister = "deregister"
+
+	// maxClockSkew is the maximum age of a registration. Within this age, replays are detected by the nonce.
+	maxClockSkew = 2 * time.Minute
+)
+
+// message is a (de)registration sent by the path-controller to the tunnel-controller as JSON.
+type message struct {
+	Version   int    `json:"version"`
+	Type      string `json:"type"`
+	Timestamp int64  `json:"timestamp"`
+	PodIP     string `json:"podIP"`
+	// Addr is the bond address of the sender, so that a captured message cannot be sent from another address.
+	Addr string `json:"addr,omitempty"`
+	// Nonce is a random value unique per message, so that a captured message cannot be sent again.
+	Nonce string `json:"nonce,omitempty"`
+	// MAC is the hex encoded HMAC-SHA256 of the other fields, it is empty if no secret is configured.
+	MAC string `json:"mac,omitempty"`
+}
+
+// LoadSecret reads the shared secret authenticating the registrations from the file. Without a file no secret is used.
+func LoadSecret(path string) ([]byte, error) {
+	if path == "" {
+		return nil, nil
+	}
+	secret, err := os.ReadFile(path) // #nosec: G304 -- path is provided by the operator
+	if err != nil {
+		return nil, fmt.Errorf("error reading registration secret: %w", err)
+	}
+	secret = bytes.TrimSpace(secret)
+	if len(secret) == 0 {
+		return nil, fmt.Errorf("registration secret %s is empty", path)
+	}
+	return secret, nil
+}
+
+// newMessage returns the message of the given type for the pod IP sent from the address addr, authenticated with the
+// secret if it is set.
+func newMessage(msgType, podIP string, addr net.IP, now time.Time, secret []byte) ([]byte, error) {
+	nonce := make([]byte, 8)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("error generating nonce: %w", err)
+	}
+	msg := message{
+		Version:   ProtocolVersion,
+		Type:      msgType,
+		Timestamp: now.Unix(),
+		PodIP:     podIP,
+		Addr:      addr.String(),
+		Nonce:     hex.EncodeToString(nonce),
+	}
+	if len(secret) > 0 {
+		msg.MAC = hex.EncodeToString(msg.mac(secret))
+	}
+	return json.Marshal(msg)
+}
+
+// parseMessage validates a message received from the address sender and returns it.
+// If a secret is set, the message must be authenticated with it and sent from the address it was created for.
+// Otherwise, unauthenticated registrations and the legacy registration consisting of the bare pod IP are accepted, but
+// deregistrations are always rejected, as they would delete a live tunnel.
+func parseMessage(payload []byte, sender net.IP, now time.Time, secret []byte) (message, error) {
+	if !bytes.HasPrefix(payload, []byte("{")) {
+		if len(secret) > 0 {
+			return message{}, errors.New("unauthenticated legacy registration")
+		}
+		msg := message{Version: ProtocolVersion, Type: MessageTypeRegister, PodIP: string(payload)}
+		return msg, validatePodIP(msg.PodIP)
+	}
+
+	var msg message
+	if err := json.Unmarshal(payload, &msg); err != nil {
+		return message{}, fmt.Errorf("error decoding message: %w", err)
+	}
+	if msg.Version != ProtocolVersion {
+		return message{}, fmt.Errorf("unsupported protocol version %d, expected %d", msg.Version, ProtocolVersion)
+	}
+	if msg.Type != MessageTypeRegister && msg.Type != MessageTypeDeregister {
+		return message{}, fmt.Errorf("unexpected message type %q", msg.Type)
+	}
+	if len(secret) == 0 && msg.Type == MessageTypeDeregister {
+		return message{}, errors.New("unauthenticated deregistration")
+	}
+	if len(secret) > 0 {
+		if msg.MAC == "" {
+			return message{}, errors.New("missing message authentication code")
+		}
+		mac, err := hex.DecodeString(msg.MAC)
+		if err != nil || !hmac.Equal(mac, msg.mac(secret)) {
+			return message{}, errors.New("invalid message authentication code")
+		}
+		if addr := net.ParseIP(msg.Addr); !addr.Equal(sender) {
+			return message{}, fmt.Errorf("message for address %q sent from %s", msg.Addr, sender)
+		}
+		if msg.Nonce == "" {
+			return message{}, errors.New("missing nonce")
+		}
+	}
+	if skew := now.Sub(time.Unix(msg.Timestamp, 0)).Abs(); skew > maxClockSkew {
+		return message{}, fmt.Errorf("timestamp %s differs by %s, more than the allowed clock skew of %s",
+			time.Unix(msg.Timestamp, 0).UTC().Format(time.RFC3339), skew.Truncate(time.Second), maxClockSkew)
+	}
+	return msg, validatePodIP(msg.PodIP)
+}
+
+// mac computes the HMAC-SHA256 of the fields of the message except the MAC itself.
+func (m message) mac(secret []byte) []byte {
+	h := hmac.New(sha256.New, secret)
+	for _, field := range []string{strconv.Itoa(m.Version), m.Type, strconv.FormatInt(m.Timestamp, 10), m.PodIP, m.Addr, m.Nonce} {
+		h.Write([]byte(field))
+		h.Write([]byte{0})
+	}
+	return h.Sum(nil)
+}
+
+func validatePodIP(podIP string) error {
+	if net.ParseIP(podIP) == nil {
+		return fmt.Errorf("invalid pod IP %q", podIP)
+	}
+	return nil
+}
+
+// acceptMessage validates a message received from the address sender like parseMessage and, if it is authenticated,
+// rejects it if it has been accepted before.
+func acceptMessage(payload []byte, sender net.IP, now time.Time, secret []byte, replays *replayCache) (message, error) {
+	msg, err := parseMessage(payload, sender, now, secret)
+	if err != nil {
+		return message{}, err
+	}
+	if len(secret) > 0 {
+		if err := replays.check(msg, now); err != nil {
+			return message{}, err
+		}
+	}
+	return msg, nil
+}
+
+// replayCache remembers the nonces of the authenticated messages per pod IP until their timestamp is outside the
+// allowed clock skew, so that a message which has already been accepted is rejected when it is sent again.
+type replayCache struct {
+	seen map[string]map[string]time.Time
+}
+
+func newReplayCache() *replayCache {
+	return &replayCache{seen: map[string]map[string]time.Time{}}
+}
+
+// check records the nonce of the message and returns an error if it has been seen before.
+func (r *replayCache) check(msg message, now time.Time) error {
+	r.prune(now)
+	nonces := r.seen[msg.PodIP]
+	if _, ok := nonces[msg.Nonce]; ok {
+		return fmt.Errorf("replayed %s message with nonce %s", msg.Type, msg.Nonce)
+	}
+	if nonces == nil {
+		nonces = map[string]time.Time{}
+		r.seen[msg.PodIP] = nonces
+	}
+	nonces[msg.Nonce] = time.Unix(msg.Timestamp, 0).Add(maxClockSkew)
+	return nil
+}
+
+// prune forgets the nonces of messages which are rejected anyway because of their timestamp.
+func (r *replayCache) prune(now time.Time) {
+	for podIP, nonces := range r.seen {
+		for nonce, expiry := range nonces {
+			if now.After(expiry) {
+				delete(nonces, nonce)
+			}
+		}
+		if len(nonces) == 0 {
+			delete(r.seen, podIP)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package tunnel
+
+import (
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Registration protocol", func() {
+	var (
+		now    = time.Unix(1760000000, 0)
+		secret = []byte("s3cr3t")
+		// sender is the bond address of the kube-apiserver pod sending the messages
+		sender = net.ParseIP("fd8f:6d53:b97a:1::a:1")
+	)
+
+	register := func(podIP string, secret []byte) []byte {
+		registration, err := newMessage(MessageTypeRegister, podIP, sender, now, secret)
+		Expect(err).NotTo(HaveOccurred())
+		return registration
+	}
+
+	// parse returns the type and pod IP of the parsed message.
+	parse := func(payload []byte, now time.Time, secret []byte) (string, error) {
+		msg, err := parseMessage(payload, sender, now, secret)
+		return msg.Type + " " + msg.PodIP, err
+	}
+
+	// tamper modifies the decoded registration and encodes it again.
+	tamper := func(registration []byte, modify func(msg *message)) []byte {
+		var msg message
+		Expect(json.Unmarshal(registration, &msg)).To(Succeed())
+		modify(&msg)
+		tampered, err := json.Marshal(msg)
+		Expect(err).NotTo(HaveOccurred())
+		return tampered
+	}
+
+	It("accepts authenticated registrations", func() {
+		registration := register("100.96.0.5", secret)
+		Expect(string(registration)).To(MatchRegexp(`^{"version":1,"type":"register","timestamp":1760000000,"podIP":"100.96.0.5","addr":"fd8f:6d53:b97a:1::a:1","nonce":"[0-9a-f]{16}","mac":"[0-9a-f]{64}"}$`))
+		Expect(parse(registration, now.Add(time.Minute), secret)).To(Equal("register 100.96.0.5"))
+	})
+
+	It("accepts authenticated deregistrations", func() {
+		deregistration, err := newMessage(MessageTypeDeregister, "100.96.0.5", sender, now, secret)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(parse(deregistration, now, secret)).To(Equal("deregister 100.96.0.5"))
+	})
+
+	It("accepts unauthenticated and legacy registrations without secret", func() {
+		Expect(parse(register("fd00::5", nil), now, nil)).To(Equal("register fd00::5"))
+		Expect(parse(register("100.96.0.5", secret), now, nil)).To(Equal("register 100.96.0.5"))
+		Expect(parse([]byte("100.96.0.5"), now, nil)).To(Equal("register 100.96.0.5"))
+	})
+
+	DescribeTable("rejects invalid registrations",
+		func(payload func() []byte, serverSecret []byte, expectedErr string) {
+			_, err := parseMessage(payload(), sender, now, serverSecret)
+			Expect(err).To(MatchError(ContainSubstring(expectedErr)))
+		},
+		Entry("garbage without secret", func() []byte { return []byte("garbage") }, nil, `invalid pod IP "garbage"`),
+		Entry("legacy registration with secret", func() []byte { return []byte("100.96.0.5") }, secret, "unauthenticated legacy registration"),
+		Entry("malformed JSON", func() []byte { return []byte(`{"version":`) }, secret, "error decoding message"),
+		Entry("unsupported version", func() []byte {
+			return tamper(register("100.96.0.5", nil), func(msg *message) { msg.Version = 2 })
+		}, nil, "unsupported protocol version 2, expected 1"),
+		Entry("unexpected type", func() []byte {
+			return tamper(register("100.96.0.5", nil), func(msg *message) { msg.Type = "unregister" })
+		}, nil, `unexpected message type "unregister"`),
+		Entry("unauthenticated deregistration", func() []byte {
+			deregistration, err := newMessage(MessageTypeDeregister, "100.96.0.5", sender, now, nil)
+			Expect(err).NotTo(HaveOccurred())
+			return deregistration
+		}, nil, "unauthenticated deregistration"),
+		Entry("missing MAC", func() []byte { return register("100.96.0.5", nil) }, secret, "missing message authentication code"),
+		Entry("wrong secret", func() []byte { return register("100.96.0.5", []byte("other")) }, secret, "invalid message authentication code"),
+		Entry("malformed MAC", func() []byte {
+			return tamper(register("100.96.0.5", secret), func(msg *message) { msg.MAC = "xyz" })
+		}, secret, "invalid message authentication code"),
+		Entry("spoofed pod IP", func() []byte {
+			return tamper(register("100.96.0.5", secret), func(msg *message) { msg.PodIP = "100.96.0.6" })
+		}, secret, "invalid message authentication code"),
+		Entry("spoofed address", func() []byte {
+			return tamper(register("100.96.0.5", secret), func(msg *message) { msg.Addr = "fd8f:6d53:b97a:1::a:2" })
+		}, secret, "invalid message authentication code"),
+		Entry("spoofed nonce", func() []byte {
+			return tamper(register("100.96.0.5", secret), func(msg *message) { msg.Nonce = "0000000000000000" })
+		}, secret, "invalid message authentication code"),
+		Entry("outdated registration", func() []byte {
+			registration, err := newMessage(MessageTypeRegister, "100.96.0.5", sender, now.Add(-5*time.Minute), secret)
+			Expect(err).NotTo(HaveOccurred())
+			return registration
+		}, secret, "timestamp 2025-10-09T08:48:20Z differs by 5m0s, more than the allowed clock skew of 2m0s"),
+		Entry("invalid pod IP", func() []byte { return register("100.96.0.500", secret) }, secret, `invalid pod IP "100.96.0.500"`),
+	)
+
+	It("rejects a registration replayed from another address", func() {
+		registration := register("100.96.0.5", secret)
+		_, err := parseMessage(registration, net.ParseIP("fd8f:6d53:b97a:1::a:2"), now, secret)
+		Expect(err).To(MatchError(`message for address "fd8f:6d53:b97a:1::a:1" sent from fd8f:6d53:b97a:1::a:2`))
+	})
+
+	Describe("replayCache", func() {
+		var replays *replayCache
+
+		BeforeEach(func() {
+			replays = newReplayCache()
+		})
+
+		// accept parses the payload and checks it for replays at the given time
+		accept := func(payload []byte, at time.Time) error {
+			msg, err := parseMessage(payload, sender, at, secret)
+			Expect(err).NotTo(HaveOccurred())
+			return replays.check(msg, at)
+		}
+
+		It("rejects a message which has been accepted before", func() {
+			registration := register("100.96.0.5", secret)
+			Expect(accept(registration, now)).To(Succeed())
+			Expect(accept(registration, now.Add(time.Minute))).To(MatchError(ContainSubstring("replayed register message with nonce")))
+		})
+
+		It("accepts other messages for the same pod IP", func() {
+			Expect(accept(register("100.96.0.5", secret), now)).To(Succeed())
+			Expect(accept(register("100.96.0.5", secret), now)).To(Succeed())
+			deregistration, err := newMessage(MessageTypeDeregister, "100.96.0.5", sender, now, secret)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(accept(deregistration, now)).To(Succeed())
+		})
+
+		It("forgets the nonces once the timestamps are outside the clock skew", func() {
+			Expect(accept(register("100.96.0.5", secret), now)).To(Succeed())
+			Expect(replays.seen).To(HaveKey("100.96.0.5"))
+
+			Expect(replays.check(message{PodIP: "100.96.0.6", Nonce: "1", Timestamp: now.Unix()}, now.Add(maxClockSkew+time.Second))).To(Succeed())
+			Expect(replays.seen).NotTo(HaveKey("100.96.0.5"))
+		})
+	})
+
+	Describe("LoadSecret", func() {
+		var dir string
+
+		BeforeEach(func() {
+			dir = GinkgoT().TempDir()
+		})
+
+		It("reads the trimmed secret", func() {
+			path := filepath.Join(dir, "secret")
+			Expect(os.WriteFile(path, []byte("s3cr3t\n"), 0600)).To(Succeed())
+			Expect(LoadSecret(path)).To(Equal(secret))
+		})
+
+		It("returns no secret without file", func() {
+			Expect(LoadSecret("")).To(BeNil())
+		})
+
+		It("fails for an empty secret", func() {
+			path := filepath.Join(dir, "secret")
+			Expect(os.WriteFile(path, []byte("\n"), 0600)).To(Succeed())
+			_, err := LoadSecret(path)
+			Expect(err).To(MatchError(ContainSubstring("is empty")))
+		})
+
+		It("fails for a missing file", func() {
+			_, err := LoadSecret(filepath.Join(dir, "missing"))
+			Expect(err).To(MatchError(ContainSubstring("error reading registration secret")))
+		})
+	})
+})
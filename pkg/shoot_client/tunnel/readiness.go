@@ -1,15 +1,53 @@
 package tunnel
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
+	"slices"
+	"strings"
 	"time"
 )
 
 const (
 	ReadinessPort = 8080
+
+	// DebugStatePath is the path of the endpoint serving the state of the tunnel-controller.
+	DebugStatePath = "/debug/state"
 )
 
+// controllerState is the JSON view of the state of the tunnel-controller served by DebugStateHandler.
+type controllerState struct {
+	Ready                bool                 `json:"ready"`
+	Reason               string               `json:"reason"`
+	KubeApiservers       []kubeApiserverState `json:"kubeApiservers"`
+	KeepaliveAttribution bool                 `json:"keepaliveAttribution"`
+	ShootClients         []shootClientState   `json:"shootClients"`
+	NextClean            time.Time            `json:"nextClean"`
+}
+
+// kubeApiserverState is the state of the tunnel to a kube-apiserver in the controllerState.
+type kubeApiserverState struct {
+	PodIP               string     `json:"podIP"`
+	RemoteAddr          string     `json:"remoteAddr"`
+	LinkName            string     `json:"linkName"`
+	LastSeen            time.Time  `json:"lastSeen"`
+	Adopted             bool       `json:"adopted,omitempty"`
+	CreationComplete    bool       `json:"creationComplete"`
+	CreationFailedCount int        `json:"creationFailedCount"`
+	LastCreationFailed  *time.Time `json:"lastCreationFailed,omitempty"`
+	LastError           string     `json:"lastError,omitempty"`
+}
+
+// shootClientState is the state of a vpn-shoot-client and its watchdog in the controllerState.
+type shootClientState struct {
+	Index      int            `json:"index"`
+	TapDevice  string         `json:"tapDevice"`
+	Keepalives uint64         `json:"keepalives"`
+	Watchdog   *watchdogState `json:"watchdog"`
+	NextSignal string         `json:"nextSignal"`
+}
+
 func (c *Controller) NewReadinessServer() *http.Server {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
@@ -21,6 +59,13 @@ func (c *Controller) NewReadinessServer() *http.Server {
 		}
 		_, _ = w.Write([]byte(msg))
 	})
+	if c.metrics != nil {
+		mux.Handle(metricsPath, c.metrics.handler())
+	}
+	// the state is not authenticated, so point to the loopback address serving it instead of an unexplained 404
+	mux.HandleFunc(DebugStatePath, func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, DebugStatePath+" is only served on the loopback address of --log-level-address", http.StatusNotFound)
+	})
 	server := &http.Server{
 		Addr:              fmt.Sprintf(":%d", ReadinessPort),
 		Handler:           mux,
@@ -29,12 +74,25 @@ func (c *Controller) NewReadinessServer() *http.Server {
 	return server
 }
 
+// DebugStateHandler returns the handler serving the state of the tunnel-controller as JSON. It is not authenticated
+// and must therefore only be served on a loopback address.
+func (c *Controller) DebugStateHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(c.state())
+	})
+}
+
 // IsReady checks if there are routes to all configured kube apiservers.
 // It returns a boolean indicating readiness and a message.
 func (c *Controller) IsReady() (bool, string) {
 	c.lock.Lock()
 	defer c.lock.Unlock()
+	return c.readyLocked()
+}
 
+// readyLocked implements IsReady, c.lock must be held.
+func (c *Controller) readyLocked() (bool, string) {
 	// If no kube apiservers are configured, we are not ready.
 	if len(c.kubeApiservers) == 0 {
 		return false, "no kube apiservers configured"
@@ -56,3 +114,52 @@ func (c *Controller) IsReady() (bool, string) {
 	}
 	return true, "ok"
 }
+
+// state returns the current state of the tunnel-controller. Unlike IsReady, it lists all kube-apiservers, not only the
+// first one which is not ready.
+func (c *Controller) state() controllerState {
+	c.lock.Lock()
+	state := controllerState{
+		KubeApiservers:       []kubeApiserverState{},
+		KeepaliveAttribution: c.keepaliveAttribution,
+		ShootClients:         []shootClientState{},
+		NextClean:            c.nextClean,
+	}
+	state.Ready, state.Reason = c.readyLocked()
+	for _, data := range c.kubeApiservers {
+		state.KubeApiservers = append(state.KubeApiservers, data.state())
+	}
+	clients := c.shootClients
+	c.lock.Unlock()
+
+	slices.SortFunc(state.KubeApiservers, func(a, b kubeApiserverState) int { return strings.Compare(a.RemoteAddr, b.RemoteAddr) })
+	for _, client := range clients {
+		state.ShootClients = append(state.ShootClients, shootClientState{
+			Index:      client.index,
+			TapDevice:  client.tapDevice,
+			Keepalives: client.keepalives.Load(),
+			Watchdog:   client.watchdog.state(),
+			NextSignal: client.escalation.nextSignal(),
+		})
+	}
+	return state
+}
+
+func (d *kubeApiserverData) state() kubeApiserverState {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	state := kubeApiserverState{
+		PodIP:               d.podIP,
+		RemoteAddr:          d.remoteAddr.String(),
+		LinkName:            d.linkName(),
+		LastSeen:            d.lastSeen,
+		Adopted:             d.adopted,
+		CreationComplete:    d.creationComplete,
+		CreationFailedCount: d.creationFailedCount,
+		LastCreationFailed:  d.lastCreationFailed,
+	}
+	if d.lastError != nil {
+		state.LastError = d.lastError.Error()
+	}
+	return state
+}
@@ -1,10 +1,14 @@
 package tunnel
 
 import (
+	"encoding/json"
 	"errors"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"time"
 
+	"github.com/go-logr/logr"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 )
@@ -78,5 +82,76 @@ var _ = Describe("Controller Readiness", func() {
 			Expect(w.Code).To(Equal(http.StatusServiceUnavailable))
 			Expect(w.Body.String()).To(Equal("no kube apiservers configured"))
 		})
+
+		It("does not serve the state, but points to the log level address", func() {
+			req := httptest.NewRequest("GET", DebugStatePath, nil)
+			w := httptest.NewRecorder()
+			c.NewReadinessServer().Handler.ServeHTTP(w, req)
+			Expect(w.Code).To(Equal(http.StatusNotFound))
+			Expect(w.Body.String()).To(ContainSubstring("only served on the loopback address of --log-level-address"))
+		})
+	})
+
+	Describe("DebugStateHandler", func() {
+		It("lists all kube apiservers and the watchdogs of the vpn-shoot-clients", func() {
+			lastSeen := time.Now().Add(-time.Minute).UTC()
+			failed := lastSeen.Add(time.Second)
+			c.nextClean = lastSeen.Add(time.Hour)
+			c.kubeApiservers = map[string]*kubeApiserverData{
+				"fd8f:6d53:b97a:1::a:36c3": {
+					remoteAddr: net.ParseIP("fd8f:6d53:b97a:1::a:36c3"), podIP: "10.10.0.2", lastSeen: lastSeen,
+					lastCreationFailed: &failed, creationFailedCount: 2, lastError: errors.New("fail"),
+				},
+				"fd8f:6d53:b97a:1::a:6987": {
+					remoteAddr: net.ParseIP("fd8f:6d53:b97a:1::a:6987"), podIP: "10.10.0.1", lastSeen: lastSeen,
+					creationComplete: true, adopted: true,
+				},
+			}
+			wd, err := NewWatchdog(logr.Discard(), 3, 3, 1, ActionFunc(func() error { return nil }))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(wd.Fail()).To(Succeed())
+			Expect(wd.Succeed()).To(Succeed())
+			Expect(wd.Fail()).To(Succeed())
+			Expect(wd.Succeed()).To(Succeed())
+			client := &shootClient{index: 1, tapDevice: "tap1", watchdog: wd, escalation: &escalation{signals: []string{"SIGUSR1", "SIGHUP"}, step: 1}}
+			client.keepalives.Store(42)
+			c.shootClients = []*shootClient{client}
+			c.keepaliveAttribution = true
+
+			req := httptest.NewRequest("GET", DebugStatePath, nil)
+			w := httptest.NewRecorder()
+			c.DebugStateHandler().ServeHTTP(w, req)
+			Expect(w.Code).To(Equal(http.StatusOK))
+			Expect(w.Header().Get("Content-Type")).To(Equal("application/json"))
+			var state controllerState
+			Expect(json.Unmarshal(w.Body.Bytes(), &state)).To(Succeed())
+
+			Expect(state).To(Equal(controllerState{
+				Ready:  false,
+				Reason: "no route to kube apiserver with pod IP 10.10.0.2 (fail)",
+				KubeApiservers: []kubeApiserverState{
+					{
+						PodIP: "10.10.0.2", RemoteAddr: "fd8f:6d53:b97a:1::a:36c3", LinkName: "bond0ip6tnl36c3", LastSeen: lastSeen,
+						CreationFailedCount: 2, LastCreationFailed: &failed, LastError: "fail",
+					},
+					{
+						PodIP: "10.10.0.1", RemoteAddr: "fd8f:6d53:b97a:1::a:6987", LinkName: "bond0ip6tnl6987", LastSeen: lastSeen,
+						Adopted: true, CreationComplete: true,
+					},
+				},
+				KeepaliveAttribution: true,
+				ShootClients: []shootClientState{{
+					Index: 1, TapDevice: "tap1", Keepalives: 42, NextSignal: "SIGHUP",
+					Watchdog: &watchdogState{Window: []bool{false, true, false}, Failures: 1, Threshold: 3},
+				}},
+				NextClean: c.nextClean,
+			}))
+		})
+
+		It("reports no vpn-shoot-clients before the controller runs", func() {
+			state := c.state()
+			Expect(state.KubeApiservers).To(BeEmpty())
+			Expect(state.ShootClients).To(BeEmpty())
+		})
 	})
 })
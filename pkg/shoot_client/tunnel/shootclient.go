@@ -0,0 +1,232 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package tunnel
+
+import (
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/vishvananda/netlink"
+	"k8s.io/utils/clock"
+
+	"github.com/gardener/vpn2/pkg/constants"
+)
+
+const (
+	ipv6HeaderLength = 40
+	udpHeaderLength  = 8
+)
+
+// shootClient is a vpn-shoot-client of the pod with the tap device enslaved to the bond device and the watchdog
+// recovering it if the keepalives from the kube-apiservers no longer arrive through it.
+type shootClient struct {
+	index     int
+	tapDevice string
+	// keepalives counts the UDP packets to the tunnel-controller which arrived through the tap device.
+	keepalives atomic.Uint64
+	// checkedKeepalives is the number of keepalives at the last check of the watchdog.
+	checkedKeepalives uint64
+	watchdog          *Watchdog
+	// escalation restarts the vpn-shoot-client. It is also set if the watchdog has another action, so that it can be
+	// reset when the vpn-shoot-client recovers.
+	escalation *escalation
+}
+
+// newShootClients creates the vpn-shoot-clients with their watchdogs. The vpn-shoot-client with index i uses the
+// device tap<i> and the management interface on port basePort+i.
+func (c *Controller) newShootClients(log logr.Logger, clock clock.PassiveClock, basePort int) ([]*shootClient, error) {
+	var clients []*shootClient
+	for index := range c.config.HAVPNClients {
+		client := &shootClient{
+			index:     index,
+			tapDevice: fmt.Sprintf("tap%d", index),
+			escalation: &escalation{
+				log:      log.WithValues("clientIndex", index),
+				metrics:  c.metrics,
+				client:   strconv.Itoa(index),
+				endpoint: fmt.Sprintf("127.0.0.1:%d", basePort+index),
+				signals:  c.config.WatchdogEscalation,
+				signal:   signalManagement,
+			},
+		}
+		var action Action = client.escalation
+		if c.config.WatchdogAction == constants.WatchdogActionExit {
+			action = &exitAction{controller: c, client: index}
+		}
+		wdLog := log.WithValues("clientIndex", index)
+		var (
+			wd  *Watchdog
+			err error
+		)
+		if c.config.WatchdogWindow > 0 {
+			wd, err = NewTimeWatchdog(wdLog, clock, c.config.WatchdogWindow, c.config.WatchdogFailureRatio, c.config.WatchdogCooldownPeriod, action)
+		} else {
+			wd, err = NewWatchdog(wdLog, c.config.WatchdogWindowSize, c.config.WatchdogThreshold, c.config.WatchdogCooldown, action)
+		}
+		if err != nil {
+			return nil, err
+		}
+		wd.metrics = c.metrics
+		wd.client = strconv.Itoa(index)
+		client.watchdog = wd
+		clients = append(clients, client)
+	}
+	return clients, nil
+}
+
+// superviseShootClients checks the vpn-shoot-clients once per update timeout until the controller is stopped.
+func (c *Controller) superviseShootClients(log logr.Logger) {
+	ticker := time.NewTicker(constants.TunnelControllerUpdateTimeout)
+	defer ticker.Stop()
+	for range ticker.C {
+		if !c.isRunning() {
+			return
+		}
+		c.checkShootClients(log, activeTapDevice())
+	}
+}
+
+// checkShootClients records a success in the watchdog of a vpn-shoot-client if a keepalive arrived through it since
+// the last check, otherwise a failure. If activeTapDevice is set, the bond device is in active-backup mode and only
+// the vpn-shoot-client of the active tap device is expected to receive keepalives.
+func (c *Controller) checkShootClients(log logr.Logger, activeTapDevice string) {
+	c.lock.Lock()
+	clients := c.shootClients
+	c.lock.Unlock()
+
+	for _, client := range clients {
+		keepalives := client.keepalives.Load()
+		received := keepalives > client.checkedKeepalives
+		client.checkedKeepalives = keepalives
+		if activeTapDevice != "" && client.tapDevice != activeTapDevice {
+			continue
+		}
+
+		if !received {
+			if err := client.watchdog.Fail(); err != nil {
+				log.Error(err, "watchdog failure (fail)", "clientIndex", client.index)
+			}
+			continue
+		}
+		if err := client.watchdog.Succeed(); err != nil {
+			log.Error(err, "watchdog failure (succeed)", "clientIndex", client.index)
+		}
+		if client.watchdog.healthy() {
+			// the restart has been successful for a whole window, so start with the first signal again if the client
+			// fails later, while a client flapping between single successes and failures keeps escalating
+			client.escalation.reset()
+		}
+	}
+}
+
+// isKeepalive checks if the IPv6 packet to the UDP port of the tunnel-controller carries a keepalive, i.e. a message
+// which the tunnel-controller accepts. Echo requests and rejected messages do not prove that the kube-apiservers can
+// reach the vpn-shoot-client, as they are not authenticated.
+func isKeepalive(packet []byte, now time.Time, secret []byte, replays *replayCache) bool {
+	if len(packet) < ipv6HeaderLength+udpHeaderLength {
+		return false
+	}
+	sender := net.IP(slices.Clone(packet[8:24]))
+	_, err := acceptMessage(packet[ipv6HeaderLength+udpHeaderLength:], sender, now, secret, replays)
+	return err == nil
+}
+
+// countKeepalive counts a keepalive for all vpn-shoot-clients if they cannot be told apart.
+func (c *Controller) countKeepalive() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.keepaliveAttribution {
+		return
+	}
+	for _, client := range c.shootClients {
+		client.keepalives.Add(1)
+	}
+}
+
+func (c *Controller) setKeepaliveAttribution(attribution bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.keepaliveAttribution = attribution
+}
+
+// activeTapDevice returns the active tap device if the bond device is in active-backup mode, otherwise an empty string.
+func activeTapDevice() string {
+	link, err := netlink.LinkByName(constants.BondDevice)
+	if err != nil {
+		return ""
+	}
+	bond, ok := link.(*netlink.Bond)
+	if !ok || bond.Mode != netlink.BOND_MODE_ACTIVE_BACKUP || bond.ActiveSlave <= 0 {
+		return ""
+	}
+	active, err := netlink.LinkByIndex(bond.ActiveSlave)
+	if err != nil {
+		return ""
+	}
+	return active.Attrs().Name
+}
+
+// escalation restarts a vpn-shoot-client with the signals of the escalation ladder, each time its watchdog is
+// triggered with the next signal until the last one is reached.
+type escalation struct {
+	lock     sync.Mutex
+	log      logr.Logger
+	metrics  *tunnelMetrics
+	client   string
+	endpoint string
+	signals  []string
+	// step is the index of the next signal.
+	step int
+	// signal sends a signal to the management interface at the endpoint.
+	signal func(endpoint, signal string) error
+}
+
+// Run sends the next signal of the escalation ladder.
+func (e *escalation) Run() error {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	signal := e.signals[e.step]
+	e.log.Info("watchdog triggered: signalling vpn-shoot-client", "endpoint", e.endpoint, "signal", signal, "step", e.step+1)
+	e.metrics.observeSignal(e.client, signal)
+	e.step = min(e.step+1, len(e.signals)-1)
+	if err := e.signal(e.endpoint, signal); err != nil {
+		return fmt.Errorf("failed to send %s to vpn-shoot-client %s: %w", signal, e.client, err)
+	}
+	return nil
+}
+
+func (e *escalation) reset() {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if e.step > 0 {
+		e.log.Info("vpn-shoot-client recovered, resetting escalation")
+		e.step = 0
+	}
+}
+
+func (e *escalation) nextSignal() string {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	return e.signals[e.step]
+}
+
+// exitAction stops the tunnel-controller with an error, so that the process exits and its container is restarted.
+type exitAction struct {
+	controller *Controller
+	client     int
+}
+
+// Run stops the controller.
+func (a *exitAction) Run() error {
+	a.controller.stopWithError(fmt.Errorf("watchdog of vpn-shoot-client %d triggered", a.client))
+	return nil
+}
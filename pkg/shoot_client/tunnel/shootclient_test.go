@@ -0,0 +1,246 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package tunnel
+
+import (
+	"net"
+	"time"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/utils/clock"
+	testclock "k8s.io/utils/clock/testing"
+
+	"github.com/gardener/vpn2/pkg/config"
+	"github.com/gardener/vpn2/pkg/constants"
+	"github.com/gardener/vpn2/pkg/events"
+	"github.com/gardener/vpn2/pkg/openvpn/management/fake"
+)
+
+var _ = Describe("Shoot clients", func() {
+	var (
+		c *Controller
+		// signals records the signals sent to the management interfaces per endpoint
+		signals map[string][]string
+	)
+
+	BeforeEach(func() {
+		c = NewController(&config.TunnelController{
+			HAVPNClients:        2,
+			WatchdogWindowSize:  2,
+			WatchdogThreshold:   2,
+			WatchdogCooldown:    1,
+			WatchdogEscalation:  []string{"SIGUSR1", "SIGHUP", "SIGTERM"},
+			RegistrationExpiry:  config.DefaultTunnelControllerConfig.RegistrationExpiry,
+			AdoptionGracePeriod: config.DefaultTunnelControllerConfig.AdoptionGracePeriod,
+		}, events.Discard())
+		clients, err := c.newShootClients(logr.Discard(), clock.RealClock{}, 7505)
+		Expect(err).NotTo(HaveOccurred())
+		signals = map[string][]string{}
+		for _, client := range clients {
+			client.escalation.signal = func(endpoint, signal string) error {
+				signals[endpoint] = append(signals[endpoint], signal)
+				return nil
+			}
+		}
+		c.shootClients = clients
+		c.keepaliveAttribution = true
+	})
+
+	// check receives keepalives through the vpn-shoot-clients with the given indexes and checks all of them
+	check := func(activeTapDevice string, indexes ...int) {
+		for _, index := range indexes {
+			c.shootClients[index].keepalives.Add(1)
+		}
+		c.checkShootClients(logr.Discard(), activeTapDevice)
+	}
+
+	It("creates a vpn-shoot-client per tap device and management port", func() {
+		Expect(c.shootClients).To(HaveLen(2))
+		Expect(c.shootClients[1].index).To(Equal(1))
+		Expect(c.shootClients[1].tapDevice).To(Equal("tap1"))
+		Expect(c.shootClients[1].escalation.endpoint).To(Equal("127.0.0.1:7506"))
+	})
+
+	It("fails for an invalid watchdog configuration", func() {
+		c.config.WatchdogThreshold = 3
+		_, err := c.newShootClients(logr.Discard(), clock.RealClock{}, 7505)
+		Expect(err).To(MatchError("invalid threshold 3, must be <= windowsize 2"))
+	})
+
+	It("restarts only the vpn-shoot-client without keepalives", func() {
+		check("", 0)
+		check("", 0)
+		Expect(signals).To(Equal(map[string][]string{"127.0.0.1:7506": {"SIGUSR1"}}))
+	})
+
+	It("escalates the signals while the vpn-shoot-client keeps failing", func() {
+		for range 8 {
+			check("", 0)
+		}
+		// each trigger is followed by one ignored check of the cooldown
+		Expect(signals["127.0.0.1:7506"]).To(Equal([]string{"SIGUSR1", "SIGHUP", "SIGTERM"}))
+		Expect(c.shootClients[1].escalation.nextSignal()).To(Equal("SIGTERM"))
+	})
+
+	It("resets the escalation once the vpn-shoot-client receives keepalives for a whole window again", func() {
+		check("")
+		check("")
+		Expect(c.shootClients[0].escalation.nextSignal()).To(Equal("SIGHUP"))
+
+		check("", 0)
+		check("", 0)
+		Expect(c.shootClients[0].escalation.nextSignal()).To(Equal("SIGHUP"))
+		check("", 0)
+		Expect(c.shootClients[0].escalation.nextSignal()).To(Equal("SIGUSR1"))
+		check("")
+		check("")
+		Expect(signals["127.0.0.1:7505"]).To(Equal([]string{"SIGUSR1", "SIGUSR1"}))
+	})
+
+	It("keeps escalating when the vpn-shoot-client flaps between single successes and failures", func() {
+		for range 3 {
+			check("")
+			check("")
+			check("", 0)
+			check("", 0)
+		}
+		Expect(signals["127.0.0.1:7505"]).To(Equal([]string{"SIGUSR1", "SIGHUP", "SIGTERM"}))
+	})
+
+	It("only supervises the active tap device in active-backup mode", func() {
+		check("tap0", 0)
+		check("tap0", 0)
+		Expect(signals).To(BeEmpty())
+
+		check("tap1", 0)
+		check("tap1", 0)
+		Expect(signals).To(Equal(map[string][]string{"127.0.0.1:7506": {"SIGUSR1"}}))
+	})
+
+	It("counts each accepted message for all vpn-shoot-clients without keepalive attribution", func() {
+		c.countKeepalive()
+		Expect(c.shootClients[0].keepalives.Load()).To(BeZero())
+
+		c.keepaliveAttribution = false
+		c.countKeepalive()
+		Expect(c.shootClients[0].keepalives.Load()).To(Equal(uint64(1)))
+		Expect(c.shootClients[1].keepalives.Load()).To(Equal(uint64(1)))
+	})
+
+	It("stops the controller if the watchdog action is exit", func() {
+		c.config.WatchdogAction = constants.WatchdogActionExit
+		clients, err := c.newShootClients(logr.Discard(), clock.RealClock{}, 7505)
+		Expect(err).NotTo(HaveOccurred())
+		c.shootClients = clients
+		c.setRunning(true)
+
+		check("", 0)
+		check("", 0)
+		Expect(c.isRunning()).To(BeFalse())
+		Expect(c.getStopErr()).To(MatchError("watchdog of vpn-shoot-client 1 triggered"))
+		Expect(signals).To(BeEmpty())
+	})
+
+	It("creates time-based watchdogs if a watchdog window is configured", func() {
+		fakeClock := testclock.NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+		c.config.WatchdogWindow = 30 * time.Second
+		c.config.WatchdogFailureRatio = 0.5
+		c.config.WatchdogCooldownPeriod = time.Minute
+		clients, err := c.newShootClients(logr.Discard(), fakeClock, 7505)
+		Expect(err).NotTo(HaveOccurred())
+		for _, client := range clients {
+			client.escalation.signal = func(endpoint, signal string) error {
+				signals[endpoint] = append(signals[endpoint], signal)
+				return nil
+			}
+		}
+		c.shootClients = clients
+
+		for range 3 {
+			fakeClock.Step(10 * time.Second)
+			check("", 0)
+		}
+		Expect(signals).To(Equal(map[string][]string{"127.0.0.1:7506": {"SIGUSR1"}}))
+		Expect(c.shootClients[1].watchdog.inCooldown()).To(BeTrue())
+	})
+
+	It("fails for an invalid time-based watchdog configuration", func() {
+		c.config.WatchdogWindow = 30 * time.Second
+		c.config.WatchdogFailureRatio = 0
+		c.config.WatchdogCooldownPeriod = time.Minute
+		_, err := c.newShootClients(logr.Discard(), clock.RealClock{}, 7505)
+		Expect(err).To(MatchError("invalid failure ratio 0, must be > 0 and <= 1"))
+	})
+
+	Describe("isKeepalive", func() {
+		var (
+			secret  = []byte("s3cr3t")
+			sender  = net.ParseIP("fd8f:6d53:b97a:1::a:1")
+			replays *replayCache
+		)
+
+		BeforeEach(func() {
+			replays = newReplayCache()
+		})
+
+		// packet returns the IPv6 packet from the sender with the UDP payload, the other header fields are not read
+		packet := func(payload []byte) []byte {
+			header := make([]byte, ipv6HeaderLength+udpHeaderLength)
+			copy(header[8:24], sender)
+			return append(header, payload...)
+		}
+
+		register := func(secret []byte) []byte {
+			registration, err := newMessage(MessageTypeRegister, "100.96.0.5", sender, time.Now(), secret)
+			Expect(err).NotTo(HaveOccurred())
+			return registration
+		}
+
+		It("accepts an authenticated registration once", func() {
+			registration := packet(register(secret))
+			Expect(isKeepalive(registration, time.Now(), secret, replays)).To(BeTrue())
+			Expect(isKeepalive(registration, time.Now(), secret, replays)).To(BeFalse())
+		})
+
+		It("does not accept echo requests", func() {
+			Expect(isKeepalive(packet([]byte("ECHO 0123456789abcdef")), time.Now(), secret, replays)).To(BeFalse())
+			Expect(isKeepalive(packet([]byte("ECHO 0123456789abcdef")), time.Now(), nil, replays)).To(BeFalse())
+		})
+
+		It("does not accept unauthenticated registrations if a secret is set", func() {
+			Expect(isKeepalive(packet(register(nil)), time.Now(), secret, replays)).To(BeFalse())
+			Expect(isKeepalive(packet(register(nil)), time.Now(), nil, replays)).To(BeTrue())
+		})
+
+		It("does not accept truncated packets", func() {
+			Expect(isKeepalive(make([]byte, ipv6HeaderLength), time.Now(), nil, replays)).To(BeFalse())
+		})
+	})
+
+	Describe("escalation", func() {
+		It("sends the signal to the management interface", func() {
+			server, err := fake.NewServer()
+			Expect(err).NotTo(HaveOccurred())
+			DeferCleanup(server.Close)
+
+			e := &escalation{log: logr.Discard(), client: "0", endpoint: server.Addr(), signals: []string{"SIGHUP"}, signal: signalManagement}
+			Expect(e.Run()).To(Succeed())
+			Expect(server.Commands()).To(Equal([]string{"signal SIGHUP"}))
+		})
+
+		It("returns an error if the management interface is not reachable", func() {
+			server, err := fake.NewServer()
+			Expect(err).NotTo(HaveOccurred())
+			address := server.Addr()
+			Expect(server.Close()).To(Succeed())
+
+			e := &escalation{log: logr.Discard(), client: "0", endpoint: address, signals: []string{"SIGUSR1", "SIGHUP"}, signal: signalManagement}
+			Expect(e.Run()).To(MatchError(ContainSubstring("failed to send SIGUSR1 to vpn-shoot-client 0")))
+			Expect(e.nextSignal()).To(Equal("SIGHUP"))
+		})
+	})
+})
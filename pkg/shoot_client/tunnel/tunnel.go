@@ -5,6 +5,7 @@
 package tunnel
 
 import (
+	"errors"
 	"fmt"
 	"net"
 	"sync"
@@ -12,34 +13,49 @@ import (
 
 	"github.com/go-logr/logr"
 	"github.com/vishvananda/netlink"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/utils/clock"
 	"k8s.io/utils/ptr"
 
 	"github.com/gardener/vpn2/pkg/config"
 	"github.com/gardener/vpn2/pkg/constants"
+	"github.com/gardener/vpn2/pkg/events"
 	"github.com/gardener/vpn2/pkg/network"
+	"github.com/gardener/vpn2/pkg/openvpn/management"
 )
 
 const (
 	tunnelControllerPort   = 5400
 	cleanUpPeriod          = 15 * time.Minute
 	creationFailureBackoff = 30 * time.Second
-	expirationDuration     = 10 * time.Minute
 	retriesToListen        = 30
 	retryListenWait        = 500 * time.Millisecond
 )
 
-// NewController creates a new tunnel controller server.
-func NewController(cfg *config.TunnelController) *Controller {
-	return &Controller{
+// NewController creates a new tunnel controller server recording failures as events with the given recorder.
+func NewController(cfg *config.TunnelController, recorder events.Recorder) *Controller {
+	c := &Controller{
 		config:         cfg,
+		recorder:       recorder,
 		kubeApiservers: map[string]*kubeApiserverData{},
-		nextClean:      time.Now().Add(cleanUpPeriod),
+		replays:        newReplayCache(),
+		nextClean:      time.Now().Add(cleanUpInterval(cfg)),
 	}
+	c.metrics = newTunnelMetrics(c)
+	return c
+}
+
+// cleanUpInterval returns the interval between the removals of expired kube-apiservers. It is shorter than the expiry
+// and the grace period of adopted kube-apiservers, so that they are removed soon after they expired.
+func cleanUpInterval(cfg *config.TunnelController) time.Duration {
+	return min(cleanUpPeriod, cfg.RegistrationExpiry/2, cfg.AdoptionGracePeriod/2)
 }
 
 type kubeApiserverData struct {
 	lock                sync.Mutex
 	log                 logr.Logger
+	recorder            events.Recorder
+	metrics             *tunnelMetrics
 	podIP               string
 	localAddr           net.IP
 	remoteAddr          net.IP
@@ -48,12 +64,23 @@ type kubeApiserverData struct {
 	lastCreationFailed  *time.Time
 	creationFailedCount int
 	lastError           error
+	// deleted is set when the tunnel has been deleted, so that pending updates do not create it again.
+	deleted bool
+	// adopted is set for a kube-apiserver rebuilt from an existing tunnel device until it is re-announced.
+	adopted bool
 }
 
 func (d *kubeApiserverData) setLastSeen() {
 	d.lock.Lock()
 	defer d.lock.Unlock()
 	d.lastSeen = time.Now()
+	d.adopted = false
+}
+
+func (d *kubeApiserverData) getPodIP() string {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return d.podIP
 }
 
 func (d *kubeApiserverData) needsUpdate(podIP string) bool {
@@ -68,7 +95,10 @@ func (d *kubeApiserverData) needsUpdate(podIP string) bool {
 		return false
 	} else if d.lastCreationFailed != nil {
 		// if creation of tunnel device or update of route failed, retry again only after a backoff
-		return time.Since(*d.lastCreationFailed) > creationFailureBackoff
+		if time.Since(*d.lastCreationFailed) <= creationFailureBackoff {
+			d.metrics.observeBackoff()
+			return false
+		}
 	}
 	return true
 }
@@ -77,6 +107,9 @@ func (d *kubeApiserverData) update(podIP string) {
 	d.lock.Lock()
 	defer d.lock.Unlock()
 
+	if d.deleted {
+		return
+	}
 	d.podIP = podIP
 	name := d.linkName()
 	if err := network.DeleteLinkByName(name); err != nil {
@@ -114,12 +147,15 @@ func (d *kubeApiserverData) update(podIP string) {
 	d.lastError = nil
 	d.lastCreationFailed = nil
 	d.creationFailedCount = 0
+	d.metrics.observeTunnelCreation(d.remoteAddr.String(), 0, nil)
 }
 
 func (d *kubeApiserverData) delete() {
 	d.lock.Lock()
 	defer d.lock.Unlock()
 
+	d.deleted = true
+	d.metrics.forgetTunnel(d.remoteAddr.String())
 	name := d.linkName()
 	if err := network.DeleteLinkByName(name); err != nil {
 		d.log.Error(err, "failed to delete old tunnel device", "name", name)
@@ -131,29 +167,46 @@ func (d *kubeApiserverData) delete() {
 func (d *kubeApiserverData) linkName() string {
 	// link name must be unique, so we use the last two bytes of the remote address as it is chosen from a /112 range.
 	// The link name must be 15 characters or less in Linux.
-	return fmt.Sprintf("%sip6tnl%02x%02x", constants.BondDevice, d.remoteAddr[len(d.remoteAddr)-2], d.remoteAddr[len(d.remoteAddr)-1])
+	return fmt.Sprintf("%s%02x%02x", tunnelLinkPrefix, d.remoteAddr[len(d.remoteAddr)-2], d.remoteAddr[len(d.remoteAddr)-1])
 }
 
 func (d *kubeApiserverData) _setFailed(err error) {
 	d.lastCreationFailed = ptr.To(time.Now())
 	d.creationFailedCount++
 	d.lastError = err
+	d.metrics.observeTunnelCreation(d.remoteAddr.String(), d.creationFailedCount, err)
 	d.log.Error(err, "failed to update tunnel controller")
+	d.recorder.Eventf(corev1.EventTypeWarning, events.ReasonTunnelCreationFailed, "Failed to set up tunnel to kube-apiserver pod %s (attempt %d): %s", d.podIP, d.creationFailedCount, err)
 }
 
-func (d *kubeApiserverData) isOutdated() bool {
+// isOutdated checks if the kube-apiserver has not been seen within the expiry, or within the grace period if it has been
+// adopted and not re-announced since.
+func (d *kubeApiserverData) isOutdated(expiry, gracePeriod time.Duration) bool {
 	d.lock.Lock()
 	defer d.lock.Unlock()
-	return time.Since(d.lastSeen) > expirationDuration
+	if d.adopted {
+		return time.Since(d.lastSeen) > gracePeriod
+	}
+	return time.Since(d.lastSeen) > expiry
 }
 
 // Controller is a server receiving UDP requests to create ipv6tnl devices.
 type Controller struct {
 	config         *config.TunnelController
+	recorder       events.Recorder
+	metrics        *tunnelMetrics
 	lock           sync.Mutex
 	kubeApiservers map[string]*kubeApiserverData
-	nextClean      time.Time
-	running        bool
+	// replays are the authenticated messages accepted recently, it is only used by the loop of Run.
+	replays      *replayCache
+	shootClients []*shootClient
+	// keepaliveAttribution is set if the keepalives are counted per tap device. Otherwise, each message accepted by
+	// the controller counts as keepalive of all vpn-shoot-clients.
+	keepaliveAttribution bool
+	nextClean            time.Time
+	running              bool
+	// stopErr is returned by Run after the controller has been stopped by a watchdog.
+	stopErr error
 }
 
 // Run runs the tunnel controller
@@ -169,34 +222,34 @@ func (c *Controller) Run(log logr.Logger) error {
 		return fmt.Errorf("expected ipv6 address for %s, got %s", constants.BondDevice, ips[0])
 	}
 
+	secret, err := LoadSecret(c.config.RegistrationSecretFile)
+	if err != nil {
+		return err
+	}
+	if secret == nil {
+		if c.config.RequireRegistrationSecret {
+			return errors.New("REQUIRE_REGISTRATION_SECRET is set, but no registration secret is configured with REGISTRATION_SECRET_FILE")
+		}
+		log.Info("WARNING: no registration secret configured, accepting unauthenticated registrations from any sender on the bond network")
+	}
+
 	localBond := ips[0]
+	if err := c.adoptTunnels(log, localBond); err != nil {
+		// the tunnels are created again when the kube-apiservers announce themselves
+		log.Error(err, "failed to adopt existing tunnel devices")
+	}
 	localAddress := net.UDPAddr{
 		IP:   localBond,
 		Port: tunnelControllerPort,
 	}
 
-	wd, err := NewWatchdog(log, c.config.WatchdogWindowSize, c.config.WatchdogThreshold, c.config.WatchdogCooldown, func() error {
-		for clientIndex := range c.config.HAVPNClients {
-			endpoint := fmt.Sprintf("127.0.0.1:%d", constants.ManagementPort+clientIndex)
-			log.Info("watchdog triggered: restarting vpn-shoot-client", "clientIndex", clientIndex, "endpoint", endpoint)
-			conn, err := net.Dial("tcp", endpoint)
-			if err != nil {
-				return err
-			}
-
-			_, err = conn.Write([]byte("signal SIGHUP\n"))
-			if err != nil {
-				_ = conn.Close()
-				return err
-			}
-			_ = conn.Close()
-		}
-		return nil
-	})
-
+	clients, err := c.newShootClients(log, clock.RealClock{}, constants.ManagementPort)
 	if err != nil {
 		return err
 	}
+	c.lock.Lock()
+	c.shootClients = clients
+	c.lock.Unlock()
 
 	handleListenError := func() error {
 		var ipFlags string
@@ -226,34 +279,61 @@ func (c *Controller) Run(log logr.Logger) error {
 
 	log.Info("server listening for UDP6 packages on IP of bond device", "address", localAddress.String())
 	c.setRunning(true)
+	if err := c.listenForKeepalives(log, clients, secret); err != nil {
+		log.Error(err, "failed to count keepalives per tap device, counting all packets as keepalives of each vpn-shoot-client")
+	} else {
+		c.setKeepaliveAttribution(true)
+	}
+	go c.superviseShootClients(log)
+
 	buffer := make([]byte, 1024)
 	for {
 		if !c.isRunning() {
 			log.Info("stopping tunnel controller")
-			return nil
+			return c.getStopErr()
 		}
+		// also clean up if no messages arrive, so that the tunnels to silent kube-apiservers are deleted
+		c.cleanIfDue()
 		_ = conn.SetReadDeadline(time.Now().Add(constants.TunnelControllerUpdateTimeout))
 		n, clientAddr, err := conn.ReadFromUDP(buffer)
 		if err != nil {
 			log.Error(err, "reading from UDP failed")
-			if err := wd.Fail(); err != nil {
-				log.Error(err, "watchdog failure (fail)")
+			if netErr, ok := errors.AsType[net.Error](err); ok && netErr.Timeout() {
+				c.metrics.observeReadTimeout()
 			}
 			continue
 		}
-		if err := wd.Succeed(); err != nil {
-			log.Error(err, "watchdog failure (succeed)")
+		if isEcho(buffer[:n]) {
+			// echo requests probe the path from the kube-apiserver pods. They are not authenticated, so they are
+			// not counted as keepalives, and only replies of the same size are sent for well-formed requests.
+			if _, err := conn.WriteToUDP(buffer[:n], clientAddr); err != nil {
+				log.Info("error replying to echo request", "remoteAddr", clientAddr, "error", err)
+			}
+			continue
 		}
 
-		podIP := string(buffer[:n])
+		msg, err := acceptMessage(buffer[:n], clientAddr.IP, time.Now(), secret, c.replays)
+		if err != nil {
+			log.Info("rejecting message", "remoteAddr", clientAddr, "error", err)
+			c.metrics.observeRejectedMessage()
+			continue
+		}
+		c.countKeepalive()
+		podIP := msg.PodIP
 
 		key := clientAddr.IP.String()
+		if msg.Type == MessageTypeDeregister {
+			c.deregister(log, key, podIP)
+			continue
+		}
 
 		c.lock.Lock()
 		data := c.kubeApiservers[key]
 		if data == nil {
 			data = &kubeApiserverData{
 				log:        log,
+				recorder:   c.recorder,
+				metrics:    c.metrics,
 				localAddr:  localBond,
 				remoteAddr: clientAddr.IP,
 				podIP:      podIP,
@@ -267,10 +347,30 @@ func (c *Controller) Run(log logr.Logger) error {
 		if data.needsUpdate(podIP) {
 			go data.update(podIP)
 		}
-		if c.nextClean.After(time.Now()) {
-			c.nextClean = time.Now().Add(cleanUpPeriod)
-			go c.clean()
-		}
+	}
+}
+
+// deregister deletes the tunnel to a kube-apiserver pod which is shutting down.
+func (c *Controller) deregister(log logr.Logger, key, podIP string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	data := c.kubeApiservers[key]
+	if data == nil || data.getPodIP() != podIP {
+		log.Info("ignoring deregistration of unknown kube-apiserver", "remoteAddr", key, "podIP", podIP)
+		return
+	}
+	delete(c.kubeApiservers, key)
+	data.delete()
+	log.Info("kube-apiserver deregistered", "remoteAddr", key, "podIP", podIP)
+}
+
+// cleanIfDue starts the removal of expired kube-apiservers if the clean-up interval has passed.
+func (c *Controller) cleanIfDue() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if time.Now().After(c.nextClean) {
+		c.nextClean = time.Now().Add(cleanUpInterval(c.config))
+		go c.clean()
 	}
 }
 
@@ -278,7 +378,7 @@ func (c *Controller) clean() {
 	c.lock.Lock()
 	defer c.lock.Unlock()
 	for key, data := range c.kubeApiservers {
-		if data.isOutdated() {
+		if data.isOutdated(c.config.RegistrationExpiry, c.config.AdoptionGracePeriod) {
 			delete(c.kubeApiservers, key)
 			data.delete()
 		}
@@ -291,12 +391,35 @@ func (c *Controller) setRunning(running bool) {
 	c.running = running
 }
 
+// stopWithError stops the controller, so that Run returns the error.
+func (c *Controller) stopWithError(err error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.running = false
+	c.stopErr = err
+}
+
+func (c *Controller) getStopErr() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.stopErr
+}
+
 func (c *Controller) isRunning() bool {
 	c.lock.Lock()
 	defer c.lock.Unlock()
 	return c.running
 }
 
+func signalManagement(endpoint, signal string) error {
+	client, err := management.Dial(endpoint, 0)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	return client.Signal(signal)
+}
+
 // Stop stops the tunnel controller
 func (c *Controller) Stop() {
 	c.setRunning(false)
@@ -3,6 +3,7 @@ package tunnel
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"net"
 	"os/exec"
@@ -13,10 +14,13 @@ import (
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"go.uber.org/zap/zapcore"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 
 	"github.com/gardener/vpn2/pkg/config"
 	"github.com/gardener/vpn2/pkg/constants"
+	"github.com/gardener/vpn2/pkg/events"
 	"github.com/gardener/vpn2/pkg/network"
 	"github.com/gardener/vpn2/pkg/vpn_client"
 )
@@ -24,7 +28,7 @@ import (
 var _ = Describe("Tunnel controller helpers", func() {
 	Describe("NewController", func() {
 		It("initializes the controller map and nextClean", func() {
-			c := NewController(config.DefaultTunnelControllerConfig)
+			c := NewController(config.DefaultTunnelControllerConfig, events.Discard())
 			Expect(c).NotTo(BeNil())
 			Expect(c.kubeApiservers).NotTo(BeNil())
 			Expect(c.nextClean.After(time.Now())).To(BeTrue())
@@ -81,17 +85,93 @@ var _ = Describe("Tunnel controller helpers", func() {
 		})
 	})
 
+	Describe("kubeApiserverData._setFailed", func() {
+		It("records a warning event with the error", func() {
+			recorder := record.NewFakeRecorder(1)
+			d := &kubeApiserverData{
+				log:      logr.Discard(),
+				recorder: events.ForObject(recorder, &corev1.Pod{}),
+				podIP:    "10.0.0.1",
+			}
+			d._setFailed(errors.New("failed to create tunnel device bond0ip6tnl0002: operation not permitted"))
+			Expect(d.creationFailedCount).To(Equal(1))
+			Expect(d.lastCreationFailed).NotTo(BeNil())
+			Expect(recorder.Events).To(Receive(Equal("Warning TunnelCreationFailed Failed to set up tunnel to kube-apiserver pod 10.0.0.1 (attempt 1): failed to create tunnel device bond0ip6tnl0002: operation not permitted")))
+		})
+	})
+
 	Describe("kubeApiserverData.isOutdated", func() {
-		It("returns true when lastSeen is older than expirationDuration", func() {
+		expiry := constants.TunnelControllerRegistrationExpiry
+		gracePeriod := constants.TunnelControllerAdoptionGracePeriod
+
+		It("returns true when lastSeen is older than the expiry", func() {
 			d := &kubeApiserverData{}
-			d.lastSeen = time.Now().Add(-expirationDuration - time.Second)
-			Expect(d.isOutdated()).To(BeTrue())
+			d.lastSeen = time.Now().Add(-expiry - time.Second)
+			Expect(d.isOutdated(expiry, gracePeriod)).To(BeTrue())
 		})
 
 		It("returns false when lastSeen is recent", func() {
 			d := &kubeApiserverData{}
 			d.lastSeen = time.Now()
-			Expect(d.isOutdated()).To(BeFalse())
+			Expect(d.isOutdated(expiry, gracePeriod)).To(BeFalse())
+		})
+
+		It("expires adopted kube-apiservers after the grace period unless they are re-announced", func() {
+			d := &kubeApiserverData{adopted: true}
+			d.lastSeen = time.Now().Add(-gracePeriod - time.Second)
+			Expect(d.isOutdated(expiry, gracePeriod)).To(BeTrue())
+
+			d.setLastSeen()
+			d.lastSeen = time.Now().Add(-gracePeriod - time.Second)
+			Expect(d.isOutdated(expiry, gracePeriod)).To(BeFalse())
+		})
+	})
+
+	Describe("Controller.deregister", func() {
+		var (
+			c *Controller
+			d *kubeApiserverData
+		)
+
+		BeforeEach(func() {
+			c = NewController(config.DefaultTunnelControllerConfig, events.Discard())
+			d = &kubeApiserverData{
+				log:              logr.Discard(),
+				remoteAddr:       net.ParseIP("fd8f:6d53:b97a:1::a:6987"),
+				podIP:            "10.10.0.1",
+				creationComplete: true,
+			}
+			c.kubeApiservers[d.remoteAddr.String()] = d
+		})
+
+		It("deletes the tunnel to the kube-apiserver immediately", func() {
+			c.deregister(logr.Discard(), d.remoteAddr.String(), "10.10.0.1")
+			Expect(c.kubeApiservers).To(BeEmpty())
+			Expect(d.deleted).To(BeTrue())
+
+			// a pending update must not create the tunnel again
+			d.update("10.10.0.1")
+			Expect(d.podIP).To(Equal("10.10.0.1"))
+			Expect(d.lastError).To(BeNil())
+		})
+
+		It("ignores deregistrations of another pod IP", func() {
+			c.deregister(logr.Discard(), d.remoteAddr.String(), "10.10.0.2")
+			Expect(c.kubeApiservers).To(HaveKey(d.remoteAddr.String()))
+			Expect(d.deleted).To(BeFalse())
+		})
+
+		It("ignores deregistrations of unknown kube-apiservers", func() {
+			c.deregister(logr.Discard(), "fd8f:6d53:b97a:1::a:36c3", "10.10.0.1")
+			Expect(c.kubeApiservers).To(HaveLen(1))
+		})
+	})
+
+	Describe("cleanUpInterval", func() {
+		It("cleans up more often than registrations expire", func() {
+			Expect(cleanUpInterval(&config.TunnelController{RegistrationExpiry: 10 * time.Minute, AdoptionGracePeriod: time.Hour})).To(Equal(5 * time.Minute))
+			Expect(cleanUpInterval(&config.TunnelController{RegistrationExpiry: time.Hour, AdoptionGracePeriod: time.Minute})).To(Equal(30 * time.Second))
+			Expect(cleanUpInterval(&config.TunnelController{RegistrationExpiry: time.Hour, AdoptionGracePeriod: time.Hour})).To(Equal(cleanUpPeriod))
 		})
 	})
 })
@@ -122,7 +202,7 @@ var _ = Describe("Controller Run", Serial, func() {
 		Expect(err).NotTo(HaveOccurred())
 
 		// Launch controller
-		c = NewController(config.DefaultTunnelControllerConfig)
+		c = NewController(config.DefaultTunnelControllerConfig, events.Discard())
 		// run controller in background
 		go func() {
 			// Run may block; we ignore returned error for the test run
@@ -154,7 +234,9 @@ var _ = Describe("Controller Run", Serial, func() {
 		Expect(err).ToNot(HaveOccurred())
 		defer conn.Close()
 
-		_, err = conn.Write([]byte("10.0.0.5"))
+		registration, err := newMessage(MessageTypeRegister, "10.0.0.5", conn.LocalAddr().(*net.UDPAddr).IP, time.Now(), nil)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = conn.Write(registration)
 		Expect(err).ToNot(HaveOccurred())
 
 		// eventually the controller should have an entry for this kube-apiserver
@@ -177,3 +259,43 @@ var _ = Describe("Controller Run", Serial, func() {
 	})
 
 })
+
+var _ = Describe("Echo", func() {
+	var conn *net.UDPConn
+
+	BeforeEach(func() {
+		var err error
+		conn, err = net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(conn.Close)
+	})
+
+	It("measures the round-trip time of an echo request", func() {
+		go func() {
+			buffer := make([]byte, 1024)
+			n, addr, err := conn.ReadFromUDP(buffer)
+			if err == nil && isEcho(buffer[:n]) {
+				time.Sleep(10 * time.Millisecond)
+				_, _ = conn.WriteToUDP(buffer[:n], addr)
+			}
+		}()
+		rtt, err := echo(conn.LocalAddr().String(), time.Second)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rtt).To(BeNumerically(">=", 10*time.Millisecond))
+	})
+
+	It("fails if the echo request is not answered", func() {
+		_, err := echo(conn.LocalAddr().String(), 50*time.Millisecond)
+		Expect(err).To(MatchError(ContainSubstring("error reading echo reply")))
+	})
+
+	It("does not treat client IPs as echo requests", func() {
+		Expect(isEcho([]byte("100.96.0.5"))).To(BeFalse())
+	})
+
+	It("only treats well-formed requests as echo requests", func() {
+		Expect(isEcho([]byte("ECHO 0123456789abcdef"))).To(BeTrue())
+		Expect(isEcho([]byte("ECHO 0123456789abcdef0123456789abcdef"))).To(BeFalse())
+		Expect(isEcho([]byte("ECHO 0123456789abcdeg"))).To(BeFalse())
+	})
+})
@@ -6,24 +6,52 @@ package tunnel
 
 import (
 	"fmt"
+	"slices"
+	"sync"
+	"time"
 
 	"github.com/go-logr/logr"
+	"k8s.io/utils/clock"
 )
 
+// Action is the recovery called by a Watchdog when it is triggered.
+type Action interface {
+	Run() error
+}
+
+// ActionFunc is an Action calling the function.
+type ActionFunc func() error
+
+// Run calls the function.
+func (f ActionFunc) Run() error {
+	return f()
+}
+
 // Watchdog records failure and success events over a sliding window.
 // Based on a configured threshold it can call an action if the failure threshold is breached.
 // After the action has been called, the window is reset and no events are recorded until a cooldown has expired.
+// The window and the cooldown are either counted in events (see NewWatchdog) or measured in time (see NewTimeWatchdog).
 type Watchdog struct {
+	lock          sync.Mutex
 	log           logr.Logger
 	window        []bool
 	windowPos     int
 	threshold     int
 	cooldown      int
 	cooldownCount int
-	action        func() error
+	// successes counts the successes recorded in a row since the last failure or the end of the cooldown.
+	successes int
+	// timed is set for a time-based watchdog, which does not use the fields of the event-based window above.
+	timed  *timeWindow
+	action Action
+	// metrics are optional and record the state of the watchdog with the index of the vpn-shoot-client as label.
+	metrics *tunnelMetrics
+	client  string
 }
 
-func NewWatchdog(log logr.Logger, windowsize, threshold, cooldown int, action func() error) (*Watchdog, error) {
+// NewWatchdog creates a watchdog which calls the action if at least threshold of the last windowsize events are
+// failures, and then ignores the next cooldown events.
+func NewWatchdog(log logr.Logger, windowsize, threshold, cooldown int, action Action) (*Watchdog, error) {
 	log.Info("watchdog initialized", "windowSize", windowsize, "threshold", threshold, "cooldown", cooldown)
 	if windowsize <= 0 {
 		return nil, fmt.Errorf("invalid windowsize %d, must be > 0", windowsize)
@@ -54,6 +82,34 @@ func NewWatchdog(log logr.Logger, windowsize, threshold, cooldown int, action fu
 	return wd, nil
 }
 
+// NewTimeWatchdog creates a watchdog which calls the action if the ratio of failures among the events of the last
+// window reaches failureRatio, and then ignores the events for the cooldown. The ratio is only evaluated once the
+// watchdog has recorded events for a whole window, either since its creation or since the end of the last cooldown.
+func NewTimeWatchdog(log logr.Logger, clock clock.PassiveClock, window time.Duration, failureRatio float64, cooldown time.Duration, action Action) (*Watchdog, error) {
+	log.Info("watchdog initialized", "window", window, "failureRatio", failureRatio, "cooldown", cooldown)
+	if window <= 0 {
+		return nil, fmt.Errorf("invalid window %s, must be > 0", window)
+	}
+	if failureRatio <= 0 || failureRatio > 1 {
+		return nil, fmt.Errorf("invalid failure ratio %g, must be > 0 and <= 1", failureRatio)
+	}
+	if cooldown <= 0 {
+		return nil, fmt.Errorf("invalid cooldown %s, must be > 0", cooldown)
+	}
+
+	return &Watchdog{
+		log: log,
+		timed: &timeWindow{
+			clock:        clock,
+			window:       window,
+			failureRatio: failureRatio,
+			cooldown:     cooldown,
+			start:        clock.Now(),
+		},
+		action: action,
+	}, nil
+}
+
 func (wd *Watchdog) Fail() error {
 	return wd.record(true)
 }
@@ -63,42 +119,223 @@ func (wd *Watchdog) Succeed() error {
 }
 
 func (wd *Watchdog) record(failure bool) error {
+	if wd.recordEvent(failure) {
+		return wd.action.Run()
+	}
+	return nil
+}
+
+// recordEvent records the event and returns whether the action must be called. The action is called without holding
+// the lock, so that the state of the watchdog can be read while the shoot clients are restarted.
+func (wd *Watchdog) recordEvent(failure bool) bool {
+	wd.lock.Lock()
+	defer wd.lock.Unlock()
+
+	if wd.timed != nil {
+		triggered := wd.timed.record(failure)
+		if failure || triggered {
+			wd.log.Info("watchdog", "failureRatio", wd.timed.ratio(), "threshold", wd.timed.failureRatio, "cooldownRemaining", wd.timed.cooldownRemaining())
+		}
+		wd.metrics.observeTimeWatchdog(wd.client, wd.timed.failures(), wd.timed.ratio(), wd.timed.cooldownRemaining(), triggered)
+		return triggered
+	}
+
 	// Reduce cooldown if still active
 	if wd.cooldownCount > 0 {
 		wd.cooldownCount--
 		if failure {
 			wd.log.Info("watchdog", "cooldown", wd.cooldownCount)
 		}
-		return nil
+		wd.metrics.observeWatchdog(wd.client, 0, wd.cooldownCount, false)
+		return false
+	}
+
+	if failure {
+		wd.successes = 0
+	} else {
+		wd.successes++
 	}
 
 	// Record failure in window
 	wd.window[wd.windowPos] = failure
 	wd.windowPos = (wd.windowPos + 1) % len(wd.window)
 
-	// Count the number of failures in the window.
-	failures := 0
-	for _, failure := range wd.window {
-		if failure {
-			failures++
-		}
-	}
+	failures := wd.failures()
 
 	if failure {
 		wd.log.Info("watchdog", "failures", failures, "threshold", wd.threshold)
 	}
 
-	// If the number of failures exceeds the threshold, call the action, reset the window and start the cooldown.
+	// If the number of failures exceeds the threshold, reset the window, start the cooldown and call the action.
 	if failures >= wd.threshold {
 		wd.cooldownCount = wd.cooldown
+		wd.successes = 0
 		wd.reset()
-		return wd.action()
+		wd.metrics.observeWatchdog(wd.client, 0, wd.cooldownCount, true)
+		return true
 	}
 
-	return nil
+	wd.metrics.observeWatchdog(wd.client, failures, 0, false)
+	return false
+}
+
+// inCooldown checks if the watchdog ignores events after it has been triggered.
+func (wd *Watchdog) inCooldown() bool {
+	wd.lock.Lock()
+	defer wd.lock.Unlock()
+	if wd.timed != nil {
+		return wd.timed.cooldownRemaining() > 0
+	}
+	return wd.cooldownCount > 0
+}
+
+// healthy checks if the watchdog recorded no failures for a whole window, neither before nor after the end of its
+// last cooldown.
+func (wd *Watchdog) healthy() bool {
+	wd.lock.Lock()
+	defer wd.lock.Unlock()
+	if wd.timed != nil {
+		return wd.timed.healthy()
+	}
+	return wd.successes >= len(wd.window)
 }
 
 func (wd *Watchdog) reset() {
 	wd.window = make([]bool, len(wd.window))
 	wd.windowPos = 0
 }
+
+// failures counts the number of failures in the window.
+func (wd *Watchdog) failures() int {
+	failures := 0
+	for _, failure := range wd.window {
+		if failure {
+			failures++
+		}
+	}
+	return failures
+}
+
+// watchdogState is the state of the watchdog in the controllerState.
+type watchdogState struct {
+	// Window contains the recorded events from the oldest to the newest, true for a failure.
+	Window            []bool `json:"window"`
+	Failures          int    `json:"failures"`
+	Threshold         int    `json:"threshold"`
+	CooldownRemaining int    `json:"cooldownRemaining"`
+	// FailureRatio, FailureRatioThreshold and CooldownUntil are only set for a time-based watchdog.
+	FailureRatio          float64    `json:"failureRatio,omitempty"`
+	FailureRatioThreshold float64    `json:"failureRatioThreshold,omitempty"`
+	CooldownUntil         *time.Time `json:"cooldownUntil,omitempty"`
+}
+
+func (wd *Watchdog) state() *watchdogState {
+	wd.lock.Lock()
+	defer wd.lock.Unlock()
+	if wd.timed != nil {
+		return wd.timed.state()
+	}
+	return &watchdogState{
+		Window:            append(slices.Clone(wd.window[wd.windowPos:]), wd.window[:wd.windowPos]...),
+		Failures:          wd.failures(),
+		Threshold:         wd.threshold,
+		CooldownRemaining: wd.cooldownCount,
+	}
+}
+
+// timeWindow is the sliding window of a time-based watchdog.
+type timeWindow struct {
+	clock        clock.PassiveClock
+	window       time.Duration
+	failureRatio float64
+	cooldown     time.Duration
+	events       []timedEvent
+	// start is the time from which on events are recorded, i.e. the creation of the watchdog or the end of the cooldown.
+	start         time.Time
+	cooldownUntil time.Time
+	// healthySince is the time of the first success since the last failure or the end of the cooldown, zero if none.
+	healthySince time.Time
+}
+
+type timedEvent struct {
+	time    time.Time
+	failure bool
+}
+
+// record records the event and returns whether the watchdog is triggered.
+func (w *timeWindow) record(failure bool) bool {
+	now := w.clock.Now()
+	if now.Before(w.cooldownUntil) {
+		return false
+	}
+	w.events = append(w.events, timedEvent{time: now, failure: failure})
+	w.prune(now)
+	if failure {
+		w.healthySince = time.Time{}
+	} else if w.healthySince.IsZero() {
+		w.healthySince = now
+	}
+	if now.Sub(w.start) < w.window || w.ratio() < w.failureRatio {
+		return false
+	}
+
+	w.events = nil
+	w.healthySince = time.Time{}
+	w.cooldownUntil = now.Add(w.cooldown)
+	w.start = w.cooldownUntil
+	return true
+}
+
+// prune removes the events which are older than the window.
+func (w *timeWindow) prune(now time.Time) {
+	oldest := now.Add(-w.window)
+	i := 0
+	for i < len(w.events) && !w.events[i].time.After(oldest) {
+		i++
+	}
+	w.events = w.events[i:]
+}
+
+func (w *timeWindow) failures() int {
+	failures := 0
+	for _, event := range w.events {
+		if event.failure {
+			failures++
+		}
+	}
+	return failures
+}
+
+// ratio returns the ratio of failures among the events in the window, 0 without events.
+func (w *timeWindow) ratio() float64 {
+	if len(w.events) == 0 {
+		return 0
+	}
+	return float64(w.failures()) / float64(len(w.events))
+}
+
+// healthy checks if only successes have been recorded for a whole window.
+func (w *timeWindow) healthy() bool {
+	return !w.healthySince.IsZero() && w.clock.Since(w.healthySince) >= w.window
+}
+
+func (w *timeWindow) cooldownRemaining() time.Duration {
+	return max(w.cooldownUntil.Sub(w.clock.Now()), 0)
+}
+
+func (w *timeWindow) state() *watchdogState {
+	state := &watchdogState{
+		Window:                []bool{},
+		Failures:              w.failures(),
+		FailureRatio:          w.ratio(),
+		FailureRatioThreshold: w.failureRatio,
+	}
+	for _, event := range w.events {
+		state.Window = append(state.Window, event.failure)
+	}
+	if w.cooldownRemaining() > 0 {
+		cooldownUntil := w.cooldownUntil
+		state.CooldownUntil = &cooldownUntil
+	}
+	return state
+}
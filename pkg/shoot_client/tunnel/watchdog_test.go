@@ -6,16 +6,18 @@ package tunnel
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/go-logr/logr"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	testclock "k8s.io/utils/clock/testing"
 )
 
 var _ = Describe("Watchdog", func() {
 	Describe("NewWatchdog", func() {
 		It("returns a valid watchdog with correct parameters", func() {
-			wd, err := NewWatchdog(logr.Discard(), 5, 3, 2, func() error { return nil })
+			wd, err := NewWatchdog(logr.Discard(), 5, 3, 2, ActionFunc(func() error { return nil }))
 			Expect(err).NotTo(HaveOccurred())
 			Expect(wd).NotTo(BeNil())
 			Expect(wd.window).To(HaveLen(5))
@@ -25,42 +27,42 @@ var _ = Describe("Watchdog", func() {
 		})
 
 		It("returns an error when windowsize is zero", func() {
-			_, err := NewWatchdog(logr.Discard(), 0, 1, 1, func() error { return nil })
+			_, err := NewWatchdog(logr.Discard(), 0, 1, 1, ActionFunc(func() error { return nil }))
 			Expect(err).To(MatchError(ContainSubstring("invalid windowsize")))
 		})
 
 		It("returns an error when windowsize is negative", func() {
-			_, err := NewWatchdog(logr.Discard(), -1, 1, 1, func() error { return nil })
+			_, err := NewWatchdog(logr.Discard(), -1, 1, 1, ActionFunc(func() error { return nil }))
 			Expect(err).To(MatchError(ContainSubstring("invalid windowsize")))
 		})
 
 		It("returns an error when threshold is zero", func() {
-			_, err := NewWatchdog(logr.Discard(), 5, 0, 1, func() error { return nil })
+			_, err := NewWatchdog(logr.Discard(), 5, 0, 1, ActionFunc(func() error { return nil }))
 			Expect(err).To(MatchError(ContainSubstring("invalid threshold")))
 		})
 
 		It("returns an error when threshold is negative", func() {
-			_, err := NewWatchdog(logr.Discard(), 5, -1, 1, func() error { return nil })
+			_, err := NewWatchdog(logr.Discard(), 5, -1, 1, ActionFunc(func() error { return nil }))
 			Expect(err).To(MatchError(ContainSubstring("invalid threshold")))
 		})
 
 		It("returns an error when threshold exceeds windowsize", func() {
-			_, err := NewWatchdog(logr.Discard(), 3, 5, 1, func() error { return nil })
+			_, err := NewWatchdog(logr.Discard(), 3, 5, 1, ActionFunc(func() error { return nil }))
 			Expect(err).To(MatchError(ContainSubstring("must be <= windowsize")))
 		})
 
 		It("returns an error when cooldown is zero", func() {
-			_, err := NewWatchdog(logr.Discard(), 5, 3, 0, func() error { return nil })
+			_, err := NewWatchdog(logr.Discard(), 5, 3, 0, ActionFunc(func() error { return nil }))
 			Expect(err).To(MatchError(ContainSubstring("invalid cooldown")))
 		})
 
 		It("returns an error when cooldown is negative", func() {
-			_, err := NewWatchdog(logr.Discard(), 5, 3, -1, func() error { return nil })
+			_, err := NewWatchdog(logr.Discard(), 5, 3, -1, ActionFunc(func() error { return nil }))
 			Expect(err).To(MatchError(ContainSubstring("invalid cooldown")))
 		})
 
 		It("allows threshold equal to windowsize", func() {
-			wd, err := NewWatchdog(logr.Discard(), 5, 5, 1, func() error { return nil })
+			wd, err := NewWatchdog(logr.Discard(), 5, 5, 1, ActionFunc(func() error { return nil }))
 			Expect(err).NotTo(HaveOccurred())
 			Expect(wd).NotTo(BeNil())
 		})
@@ -81,10 +83,10 @@ var _ = Describe("Watchdog", func() {
 		JustBeforeEach(func() {
 			var err error
 			// windowsize=5, threshold=3, cooldown=3
-			wd, err = NewWatchdog(logr.Discard(), 5, 3, 3, func() error {
+			wd, err = NewWatchdog(logr.Discard(), 5, 3, 3, ActionFunc(func() error {
 				actionCount++
 				return actionErr
-			})
+			}))
 			Expect(err).NotTo(HaveOccurred())
 		})
 
@@ -204,4 +206,120 @@ var _ = Describe("Watchdog", func() {
 			Expect(actionCount).To(Equal(2))
 		})
 	})
+
+	Describe("NewTimeWatchdog", func() {
+		var fakeClock *testclock.FakeClock
+
+		BeforeEach(func() {
+			fakeClock = testclock.NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+		})
+
+		DescribeTable("validates the parameters",
+			func(window time.Duration, failureRatio float64, cooldown time.Duration, expectedErr string) {
+				wd, err := NewTimeWatchdog(logr.Discard(), fakeClock, window, failureRatio, cooldown, ActionFunc(func() error { return nil }))
+				if expectedErr == "" {
+					Expect(err).NotTo(HaveOccurred())
+					Expect(wd).NotTo(BeNil())
+					return
+				}
+				Expect(err).To(MatchError(expectedErr))
+				Expect(wd).To(BeNil())
+			},
+			Entry("valid parameters", 10*time.Second, 0.5, 20*time.Second, ""),
+			Entry("failure ratio of 1", 10*time.Second, 1.0, 20*time.Second, ""),
+			Entry("zero window", time.Duration(0), 0.5, 20*time.Second, "invalid window 0s, must be > 0"),
+			Entry("negative window", -time.Second, 0.5, 20*time.Second, "invalid window -1s, must be > 0"),
+			Entry("zero failure ratio", 10*time.Second, 0.0, 20*time.Second, "invalid failure ratio 0, must be > 0 and <= 1"),
+			Entry("failure ratio above 1", 10*time.Second, 1.5, 20*time.Second, "invalid failure ratio 1.5, must be > 0 and <= 1"),
+			Entry("zero cooldown", 10*time.Second, 0.5, time.Duration(0), "invalid cooldown 0s, must be > 0"),
+		)
+
+		// events records an event every 2 seconds in a watchdog with a window of 10 seconds, a failure ratio of 0.5 and
+		// a cooldown of 20 seconds. Each character of the pattern is an event, 'F' a failure and 'S' a success. The
+		// expected triggers are the 1-based positions of the events which trigger the action.
+		DescribeTable("records the events over time",
+			func(pattern string, expectedTriggers []int) {
+				var triggers []int
+				event := 0
+				wd, err := NewTimeWatchdog(logr.Discard(), fakeClock, 10*time.Second, 0.5, 20*time.Second, ActionFunc(func() error {
+					triggers = append(triggers, event)
+					return nil
+				}))
+				Expect(err).NotTo(HaveOccurred())
+
+				for i, r := range pattern {
+					event = i + 1
+					fakeClock.Step(2 * time.Second)
+					if r == 'F' {
+						Expect(wd.Fail()).To(Succeed())
+					} else {
+						Expect(wd.Succeed()).To(Succeed())
+					}
+				}
+				Expect(triggers).To(Equal(expectedTriggers))
+			},
+			Entry("does not trigger before a whole window has passed", "FFFF", nil),
+			Entry("triggers once a whole window of failures has passed", "FFFFF", []int{5}),
+			Entry("does not trigger on successes", "SSSSSSSSSS", nil),
+			Entry("does not trigger below the failure ratio", "FFSSSFSSFS", nil),
+			Entry("triggers when the failure ratio is reached", "SSSFFF", []int{6}),
+			// the failures at 12s..28s are ignored during the cooldown, the failure at 30s is pruned from the window of
+			// the event at 40s, which is the first to be evaluated after the cooldown
+			Entry("ignores events during the cooldown and waits for a whole window after it", "FFFFFFFFFFFFFFFFFFFF", []int{5, 20}),
+		)
+
+		It("reports the cooldown in its state", func() {
+			wd, err := NewTimeWatchdog(logr.Discard(), fakeClock, 10*time.Second, 0.5, 20*time.Second, ActionFunc(func() error { return nil }))
+			Expect(err).NotTo(HaveOccurred())
+
+			fakeClock.Step(10 * time.Second)
+			Expect(wd.Fail()).To(Succeed())
+			Expect(wd.inCooldown()).To(BeTrue())
+			cooldownUntil := fakeClock.Now().Add(20 * time.Second)
+			Expect(wd.state()).To(Equal(&watchdogState{
+				Window:                []bool{},
+				FailureRatioThreshold: 0.5,
+				CooldownUntil:         &cooldownUntil,
+			}))
+
+			fakeClock.Step(20 * time.Second)
+			Expect(wd.inCooldown()).To(BeFalse())
+			Expect(wd.Succeed()).To(Succeed())
+			Expect(wd.Fail()).To(Succeed())
+			Expect(wd.state()).To(Equal(&watchdogState{
+				Window:                []bool{false, true},
+				Failures:              1,
+				FailureRatio:          0.5,
+				FailureRatioThreshold: 0.5,
+			}))
+		})
+
+		It("is healthy once only successes have been recorded for a whole window", func() {
+			wd, err := NewTimeWatchdog(logr.Discard(), fakeClock, 10*time.Second, 1, 20*time.Second, ActionFunc(func() error { return nil }))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(wd.healthy()).To(BeFalse())
+
+			Expect(wd.Succeed()).To(Succeed())
+			fakeClock.Step(8 * time.Second)
+			Expect(wd.Fail()).To(Succeed())
+			fakeClock.Step(2 * time.Second)
+			Expect(wd.Succeed()).To(Succeed())
+			fakeClock.Step(8 * time.Second)
+			Expect(wd.Succeed()).To(Succeed())
+			Expect(wd.healthy()).To(BeFalse())
+
+			fakeClock.Step(2 * time.Second)
+			Expect(wd.healthy()).To(BeTrue())
+		})
+
+		It("returns the action error when the action fails", func() {
+			wd, err := NewTimeWatchdog(logr.Discard(), fakeClock, time.Second, 1, time.Second, ActionFunc(func() error {
+				return fmt.Errorf("action failed")
+			}))
+			Expect(err).NotTo(HaveOccurred())
+
+			fakeClock.Step(time.Second)
+			Expect(wd.Fail()).To(MatchError("action failed"))
+		})
+	})
 })
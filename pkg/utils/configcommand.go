@@ -0,0 +1,64 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package utils
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/gardener/vpn2/pkg/config"
+)
+
+// NewConfigCommand creates the `config` command of a component with its `validate` subcommand.
+// The kind of the configuration is taken from the --kind flag, the configuration file, or defaultKind in this order.
+func NewConfigCommand(name, defaultKind string) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "inspect and validate the configuration of the component",
+		Args:  cobra.NoArgs,
+	}
+
+	var file, kind string
+	validateCmd := &cobra.Command{
+		Use:   "validate",
+		Short: "validate the configuration file and environment and print all errors",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			log, err := InitRun(cmd, name+"-config-validate")
+			if err != nil {
+				return err
+			}
+			if err := UseFile(file); err != nil {
+				return err
+			}
+			if kind == "" {
+				kind = defaultKind
+				if path := os.Getenv(config.FileEnvVar); path != "" {
+					if kind, err = config.ReadKind(path); err != nil {
+						return err
+					}
+				}
+			}
+
+			errs := config.Errors(config.Validate(log, kind))
+			out := cmd.OutOrStdout()
+			for _, err := range errs {
+				_, _ = fmt.Fprintf(out, "- %s\n", err)
+			}
+			if len(errs) > 0 {
+				return fmt.Errorf("%s is invalid: %d error(s) found", kind, len(errs))
+			}
+			_, _ = fmt.Fprintf(out, "%s is valid\n", kind)
+			return nil
+		},
+	}
+	AddFileFlag(validateCmd, &file, "validate")
+	validateCmd.Flags().StringVar(&kind, "kind", "", "kind of the configuration to validate (defaults to the kind of the configuration file or "+defaultKind+")")
+
+	cmd.AddCommand(validateCmd)
+	return cmd
+}
@@ -0,0 +1,32 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package utils
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/gardener/vpn2/pkg/config"
+)
+
+// AddFileFlag adds the --file flag for the configuration file to the command, the usage describes what the file is
+// used for, e.g. "render".
+func AddFileFlag(cmd *cobra.Command, file *string, usage string) {
+	cmd.Flags().StringVar(file, "file", "", "configuration file to "+usage+" (defaults to $"+config.FileEnvVar+")")
+}
+
+// UseFile makes the configuration be read from the given file by exporting it as $CONFIG_FILE.
+// Nothing is done if the file is empty, i.e. the --file flag is not set.
+func UseFile(file string) error {
+	if file == "" {
+		return nil
+	}
+	if err := os.Setenv(config.FileEnvVar, file); err != nil {
+		return fmt.Errorf("setting %s environment variable failed: %w", config.FileEnvVar, err)
+	}
+	return nil
+}
@@ -23,12 +23,14 @@ import (
 func InitRun(cmd *cobra.Command, name string) (logr.Logger, error) {
 	verflag.PrintAndExitIfRequested()
 
-	logLevel := "info"
-	logFormat := "text"
-	log, err := logger.NewZapLogger(logLevel, logFormat, zap.StacktraceLevel(zapcore.PanicLevel))
+	// the level is validated by NewZapLogger but replaced by the atomic level to allow changing it at runtime
+	log, err := logger.NewZapLogger(logLevel, logFormat, zap.StacktraceLevel(zapcore.PanicLevel), zap.Level(atomicLevel))
 	if err != nil {
 		return logr.Discard(), fmt.Errorf("error instantiating zap logger: %w", err)
 	}
+	if err := atomicLevel.UnmarshalText([]byte(logLevel)); err != nil {
+		return logr.Discard(), fmt.Errorf("invalid log level %q: %w", logLevel, err)
+	}
 
 	logf.SetLogger(log)
 	klog.SetLogger(log)
@@ -0,0 +1,96 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package utils
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gardener/gardener/pkg/logger"
+	"github.com/go-logr/logr"
+	"github.com/spf13/pflag"
+	"go.uber.org/zap"
+)
+
+const (
+	// LogLevelEnvVar is the environment variable providing the default of the --log-level flag.
+	LogLevelEnvVar = "LOG_LEVEL"
+	// LogFormatEnvVar is the environment variable providing the default of the --log-format flag.
+	LogFormatEnvVar = "LOG_FORMAT"
+	// LogLevelPath is the path of the endpoint to get and change the log level at runtime.
+	LogLevelPath = "/log-level"
+	// DefaultLogLevelAddress is the default address of the log level endpoint of long-running controllers.
+	DefaultLogLevelAddress = "127.0.0.1:8090"
+)
+
+var (
+	logLevel  = logger.InfoLevel
+	logFormat = logger.FormatText
+	// atomicLevel is the level of the logger created by InitRun. It can be changed at runtime.
+	atomicLevel = zap.NewAtomicLevel()
+)
+
+// AddLogFlags adds the --log-level and --log-format flags. Their defaults are taken from the LOG_LEVEL and LOG_FORMAT
+// environment variables.
+func AddLogFlags(flags *pflag.FlagSet) {
+	if level := os.Getenv(LogLevelEnvVar); level != "" {
+		logLevel = level
+	}
+	if format := os.Getenv(LogFormatEnvVar); format != "" {
+		logFormat = format
+	}
+	flags.StringVar(&logLevel, "log-level", logLevel, "log level (one of debug, info, error), defaults to $"+LogLevelEnvVar)
+	flags.StringVar(&logFormat, "log-format", logFormat, "log format (one of text, json), defaults to $"+LogFormatEnvVar)
+}
+
+// OpenVPNVerbosity returns the OpenVPN `verb` setting matching the log level.
+func OpenVPNVerbosity() int {
+	switch logLevel {
+	case logger.DebugLevel:
+		return 4
+	case logger.ErrorLevel:
+		return 1
+	default:
+		return 3
+	}
+}
+
+// LogLevelHandler returns the handler to get the current log level with GET and to change it with PUT, e.g.
+// `curl -X PUT -d '{"level":"debug"}' localhost:8090/log-level`.
+func LogLevelHandler() http.Handler {
+	return atomicLevel
+}
+
+// ServeLogLevel serves the LogLevelHandler on address until the context is cancelled. An empty address disables it.
+// The debug handlers indexed by their path are served on the same address. As none of the endpoints is authenticated,
+// address should be a loopback address.
+func ServeLogLevel(ctx context.Context, log logr.Logger, address string, debug map[string]http.Handler) {
+	if address == "" {
+		return
+	}
+	mux := http.NewServeMux()
+	mux.Handle(LogLevelPath, LogLevelHandler())
+	for path, handler := range debug {
+		mux.Handle(path, handler)
+	}
+	server := &http.Server{
+		Addr:              address,
+		Handler:           mux,
+		ReadHeaderTimeout: 2 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		_ = server.Close()
+	}()
+	go func() {
+		log.Info("serving log level endpoint", "address", address, "path", LogLevelPath)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Error(err, "log level server stopped with error")
+		}
+	}()
+}
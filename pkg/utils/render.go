@@ -0,0 +1,45 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package utils
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// WriteFiles writes the content of the given files sorted by path as sections of the output of a `render` command.
+func WriteFiles(w io.Writer, files map[string]string) {
+	for _, name := range slices.Sorted(maps.Keys(files)) {
+		content := files[name]
+		if content != "" && !strings.HasSuffix(content, "\n") {
+			content += "\n"
+		}
+		_, _ = fmt.Fprintf(w, "### file %s\n%s\n", name, content)
+	}
+}
+
+// WriteSection writes the lines as section of the output of a `render` command.
+func WriteSection(w io.Writer, title string, lines []string) {
+	_, _ = fmt.Fprintf(w, "### %s\n", title)
+	if len(lines) == 0 {
+		_, _ = fmt.Fprintln(w, "# none")
+	}
+	for _, line := range lines {
+		_, _ = fmt.Fprintln(w, line)
+	}
+	_, _ = fmt.Fprintln(w)
+}
+
+// Strings returns the string representations of the given items.
+func Strings[T fmt.Stringer](items []T) []string {
+	lines := make([]string, 0, len(items))
+	for _, item := range items {
+		lines = append(lines, item.String())
+	}
+	return lines
+}
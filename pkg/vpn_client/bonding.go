@@ -8,6 +8,7 @@ import (
 	"context"
 	"fmt"
 	"net"
+	"slices"
 
 	"github.com/go-logr/logr"
 	"github.com/vishvananda/netlink"
@@ -19,6 +20,61 @@ import (
 	"github.com/gardener/vpn2/pkg/network"
 )
 
+// BondingPlan describes the links created by ConfigureBonding.
+type BondingPlan struct {
+	// TapDevices are the tap devices enslaved to the bond device, one per VPN server.
+	TapDevices []string
+	// Mode is the bonding mode of the bond device.
+	Mode string
+	// MTU is the MTU of the tap and bond devices. 0 keeps the kernel default.
+	MTU int
+	// Address is the address of the bond device. It is nil for seed clients until acquired from the kube-apiserver.
+	Address *net.IPNet
+	// Tunnels are the ip6tnl links from a seed client to each shoot client.
+	Tunnels []TunnelPlan
+}
+
+// TunnelPlan describes an ip6tnl link from the bond device address to a shoot client.
+type TunnelPlan struct {
+	Name   string
+	Remote net.IP
+}
+
+// Route returns the network routed over the bond device, or nil if the address is not known yet.
+func (p BondingPlan) Route() *net.IPNet {
+	if p.Address == nil {
+		return nil
+	}
+	return &net.IPNet{IP: p.Address.IP.Mask(p.Address.Mask), Mask: p.Address.Mask}
+}
+
+// PlanBonding computes the links ConfigureBonding creates for the given configuration and tunnel MTU.
+func PlanBonding(cfg *config.VPNClient, tunnelMTU int) (BondingPlan, error) {
+	if !slices.Contains(constants.BondingModes, cfg.BondingMode) {
+		return BondingPlan{}, fmt.Errorf("unsupported bonding mode: %s", cfg.BondingMode)
+	}
+	plan := BondingPlan{
+		Mode: cfg.BondingMode,
+		MTU:  tunnelMTU,
+	}
+	for i := range cfg.HAVPNServers {
+		plan.TapDevices = append(plan.TapDevices, fmt.Sprintf("tap%d", i))
+	}
+	if cfg.IsShootClient {
+		plan.Address = network.BondingShootClientAddress(cfg.VPNNetwork.ToIPNet(), cfg.VPNClientIndex)
+		return plan, nil
+	}
+	for i := range cfg.HAVPNClients {
+		plan.Tunnels = append(plan.Tunnels, TunnelPlan{
+			// #nosec: G115 -- overflow unlikely (max value at least 2147483647 before overflow)
+			Name: network.BondIP6TunnelLinkName(int(i)),
+			// #nosec: G115 -- overflow unlikely (max value at least 2147483647 before overflow)
+			Remote: network.BondingShootClientIP(cfg.VPNNetwork.ToIPNet(), int(i)),
+		})
+	}
+	return plan, nil
+}
+
 func ConfigureBonding(ctx context.Context, log logr.Logger, cfg *config.VPNClient) error {
 	tunnelMTU := 0
 	if cfg.AutoMTU {
@@ -29,12 +85,12 @@ func ConfigureBonding(ctx context.Context, log logr.Logger, cfg *config.VPNClien
 		}
 	}
 
-	var err error
-	var addr *net.IPNet
+	plan, err := PlanBonding(cfg, tunnelMTU)
+	if err != nil {
+		return err
+	}
 
-	if cfg.IsShootClient {
-		addr = network.BondingShootClientAddress(cfg.VPNNetwork.ToIPNet(), cfg.VPNClientIndex)
-	} else {
+	if !cfg.IsShootClient {
 		manager, err := ippool.NewPodIPPoolManager(cfg.Namespace, cfg.PodLabelSelector)
 		if err != nil {
 			return err
@@ -53,11 +109,14 @@ func ConfigureBonding(ctx context.Context, log logr.Logger, cfg *config.VPNClien
 		if ip == nil {
 			return fmt.Errorf("acquired ip %s is not a valid ipv6 nor ipv4", ip)
 		}
-		addr = network.BondingAddressForClient(ip)
+		plan.Address = network.BondingAddressForClient(ip)
 	}
 
-	for i := range cfg.HAVPNServers {
-		linkName := fmt.Sprintf("tap%d", i)
+	return applyBonding(log, plan)
+}
+
+func applyBonding(log logr.Logger, plan BondingPlan) error {
+	for _, linkName := range plan.TapDevices {
 		log.Info("deleting existing tap device if any", "link", linkName)
 		err := network.DeleteLinkByName(linkName)
 		if err != nil {
@@ -77,8 +136,8 @@ func ConfigureBonding(ctx context.Context, log logr.Logger, cfg *config.VPNClien
 			return err
 		}
 
-		if tunnelMTU > 0 {
-			if err = netlink.LinkSetMTU(linkDev, tunnelMTU); err != nil {
+		if plan.MTU > 0 {
+			if err = netlink.LinkSetMTU(linkDev, plan.MTU); err != nil {
 				return fmt.Errorf("failed to set MTU on %s: %w", linkName, err)
 			}
 		}
@@ -86,7 +145,7 @@ func ConfigureBonding(ctx context.Context, log logr.Logger, cfg *config.VPNClien
 
 	// check if bond device already exists and delete it if exists
 	log.Info("deleting existing bond device if any", "link", constants.BondDevice)
-	err = network.DeleteLinkByName(constants.BondDevice)
+	err := network.DeleteLinkByName(constants.BondDevice)
 	if err != nil {
 		return err
 	}
@@ -97,7 +156,7 @@ func ConfigureBonding(ctx context.Context, log logr.Logger, cfg *config.VPNClien
 	bond.Name = constants.BondDevice
 
 	// FeatureGate: VpnBondingModeRoundRobin
-	switch cfg.BondingMode {
+	switch plan.Mode {
 	case constants.BondingModeActiveBackup:
 		tap0Link, err := netlink.LinkByName(constants.TapDevice)
 		if err != nil {
@@ -121,7 +180,7 @@ func ConfigureBonding(ctx context.Context, log logr.Logger, cfg *config.VPNClien
 		bond.Mode = netlink.BOND_MODE_BALANCE_RR
 		bond.Miimon = 100
 	default:
-		return fmt.Errorf("unsupported bonding mode: %s", cfg.BondingMode)
+		return fmt.Errorf("unsupported bonding mode: %s", plan.Mode)
 	}
 
 	log.Info("creating new bond device", "link", constants.BondDevice)
@@ -129,9 +188,7 @@ func ConfigureBonding(ctx context.Context, log logr.Logger, cfg *config.VPNClien
 		return fmt.Errorf("failed to create %s link device: %w", constants.BondDevice, err)
 	}
 
-	for i := range cfg.HAVPNServers {
-		linkName := fmt.Sprintf("tap%d", i)
-
+	for _, linkName := range plan.TapDevices {
 		link, err := netlink.LinkByName(linkName)
 		if err != nil {
 			return fmt.Errorf("failed to get link %s: %w", linkName, err)
@@ -145,12 +202,13 @@ func ConfigureBonding(ctx context.Context, log logr.Logger, cfg *config.VPNClien
 
 	// Set bond MTU after all slaves are added; the first enslave can reset the bond MTU
 	// to the slave's default if the kernel bonding driver inherits it from the first slave.
-	if tunnelMTU > 0 {
-		if err = netlink.LinkSetMTU(bond, tunnelMTU); err != nil {
+	if plan.MTU > 0 {
+		if err = netlink.LinkSetMTU(bond, plan.MTU); err != nil {
 			return fmt.Errorf("failed to set MTU on %s: %w", constants.BondDevice, err)
 		}
 	}
 
+	addr := plan.Address
 	log.Info("setting up bond device", "link", constants.BondDevice, "address", addr.String())
 	err = netlink.LinkSetUp(bond)
 	if err != nil {
@@ -161,18 +219,13 @@ func ConfigureBonding(ctx context.Context, log logr.Logger, cfg *config.VPNClien
 		return fmt.Errorf("failed to add address %s to %s link: %w", addr, constants.BondDevice, err)
 	}
 
-	if !cfg.IsShootClient {
-		for i := range cfg.HAVPNClients {
-			// #nosec: G115 -- overflow unlikely (max value at least 2147483647 before overflow)
-			ip6tnlName := network.BondIP6TunnelLinkName(int(i))
-			// check if the link already exists and delete it if exists
-			if err := network.DeleteLinkByName(ip6tnlName); err != nil {
-				return fmt.Errorf("failed to delete link %s: %w", ip6tnlName, err)
-			}
-			// #nosec: G115 -- overflow unlikely (max value at least 2147483647 before overflow)
-			if err := network.CreateTunnel(ip6tnlName, addr.IP, network.BondingShootClientIP(cfg.VPNNetwork.ToIPNet(), int(i))); err != nil {
-				return fmt.Errorf("failed to create tunnel ip6-net link: %w", err)
-			}
+	for _, tunnel := range plan.Tunnels {
+		// check if the link already exists and delete it if exists
+		if err := network.DeleteLinkByName(tunnel.Name); err != nil {
+			return fmt.Errorf("failed to delete link %s: %w", tunnel.Name, err)
+		}
+		if err := network.CreateTunnel(tunnel.Name, addr.IP, tunnel.Remote); err != nil {
+			return fmt.Errorf("failed to create tunnel ip6-net link: %w", err)
 		}
 	}
 
@@ -38,7 +38,7 @@ var _ = Describe("ConfigureBonding", Serial, func() {
 			BondingMode:    constants.BondingModeActiveBackup,
 		}
 
-		err := EnableIPv6Networking(log)
+		err := EnableIPv6Networking(log, network.HostSysctl(""))
 		Expect(err).NotTo(HaveOccurred())
 		_ = exec.Command("mkdir", "-p", "/dev/net").Run()
 		_ = exec.Command("mknod", "/dev/net/tun", "c", "10", "200").Run()
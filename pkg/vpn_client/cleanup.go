@@ -12,6 +12,9 @@ import (
 	"github.com/vishvananda/netlink"
 	"golang.org/x/sys/unix"
 
+	"github.com/gardener/vpn2/pkg/config"
+	"github.com/gardener/vpn2/pkg/constants"
+	"github.com/gardener/vpn2/pkg/network"
 	"github.com/gardener/vpn2/pkg/openvpn"
 )
 
@@ -52,3 +55,54 @@ func Cleanup(log logr.Logger, values openvpn.ClientValues) error {
 
 	return nil
 }
+
+// RevertHostSetup undoes the changes the setup subcommand and the vpn-client made on the host: the firewall rules of
+// both firewall backends, the links created for the tunnel or the bonding (and with them their addresses and routes)
+// and, if a state file is given, the kernel parameters recorded by network.HostSysctl.
+// It is idempotent. All steps are attempted even if some of them fail.
+func RevertHostSetup(log logr.Logger, cfg config.VPNClient, sysctlStateFile string) error {
+	log.Info("Reverting VPN client host setup")
+	var errs []error
+
+	if err := network.RemoveFirewall(log, IPTablesOwner, cfg.FirewallBackend); err != nil {
+		errs = append(errs, err)
+	}
+
+	links, err := hostLinks(cfg)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	for _, name := range links {
+		log.Info("deleting link", "link", name)
+		if err := network.DeleteLinkByName(name); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if sysctlStateFile != "" {
+		if err := network.RestoreSysctls(log, sysctlStateFile, network.HostSysctl("")); err != nil {
+			errs = append(errs, err)
+		}
+	} else {
+		log.Info("not restoring kernel parameters without sysctl state file")
+	}
+	return errors.Join(errs...)
+}
+
+// hostLinks returns the names of the links created on the host for the given configuration in the order they need to
+// be deleted.
+func hostLinks(cfg config.VPNClient) ([]string, error) {
+	if !cfg.IsHA {
+		return []string{constants.TunnelDevice}, nil
+	}
+	plan, err := PlanBonding(&cfg, 0)
+	if err != nil {
+		return nil, err
+	}
+	var links []string
+	for _, tunnel := range plan.Tunnels {
+		links = append(links, tunnel.Name)
+	}
+	links = append(links, constants.BondDevice)
+	return append(links, plan.TapDevices...), nil
+}
@@ -0,0 +1,40 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package vpn_client
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/gardener/vpn2/pkg/config"
+	"github.com/gardener/vpn2/pkg/constants"
+	"github.com/gardener/vpn2/pkg/network"
+)
+
+var _ = Describe("Cleanup", func() {
+	Describe("#hostLinks", func() {
+		It("should return the tunnel device for non-HA clients", func() {
+			Expect(hostLinks(config.VPNClient{IsShootClient: true})).To(Equal([]string{constants.TunnelDevice}))
+		})
+
+		It("should return the bonding links of a seed client with tunnels first", func() {
+			cfg := config.VPNClient{
+				IsHA:         true,
+				VPNNetwork:   network.CIDR(constants.DefaultVPNNetwork),
+				HAVPNServers: 2,
+				HAVPNClients: 2,
+				BondingMode:  constants.BondingModeActiveBackup,
+			}
+			Expect(hostLinks(cfg)).To(Equal([]string{
+				network.BondIP6TunnelLinkName(0),
+				network.BondIP6TunnelLinkName(1),
+				constants.BondDevice,
+				"tap0",
+				"tap1",
+			}))
+		})
+	})
+
+})
@@ -17,7 +17,21 @@ import (
 	"github.com/gardener/vpn2/pkg/network"
 )
 
+// IPTablesOwner is the prefix of the iptables chains holding the rules of the vpn-client.
+const IPTablesOwner = "VPN-CLIENT"
+
+// SetIPTableRules reconciles the rules required by the vpn-client on the host with the configured firewall backend.
+// Rules no longer required, e.g. after a change of the shoot networks, are removed.
 func SetIPTableRules(log logr.Logger, cfg config.VPNClient) error {
+	ruleSet, err := IPTableRules(cfg)
+	if err != nil {
+		return err
+	}
+	return network.ReconcileFirewall(log, ruleSet, cfg.FirewallBackend)
+}
+
+// IPTableRules generates the iptables rules required by the vpn-client for the given configuration.
+func IPTableRules(cfg config.VPNClient) (*network.RuleSet, error) {
 	forwardDevice := constants.TunnelDevice
 	if cfg.VPNServerIndex != "" {
 		// we don't know the name of the bond0ip6tnl devices ahead of time, so we use a wildcard
@@ -27,133 +41,69 @@ func SetIPTableRules(log logr.Logger, cfg config.VPNClient) error {
 	// In HA mode, we only set up double NAT rules if there is an overlap between the seed pod network and the shoot networks.
 	overlap := network.OverLapAny(cfg.SeedPodNetwork, slices.Concat(cfg.ShootPodNetworks, cfg.ShootServiceNetworks, cfg.ShootNodeNetworks)...)
 
+	var protocols []iptables.Protocol
 	for _, family := range cfg.IPFamilies {
-		protocol := iptables.ProtocolIPv4
-		if family == constants.IPv6Family {
-			protocol = iptables.ProtocolIPv6
-		}
-		ipTable, err := network.NewIPTables(log, protocol)
-		if err != nil {
-			return err
-		}
+		protocols = append(protocols, protocolForFamily(family))
+	}
+	rules := network.NewRuleSet(IPTablesOwner)
 
+	for _, protocol := range protocols {
 		if cfg.IsShootClient {
 			if protocol == iptables.ProtocolIPv4 {
-				err = ipTable.AppendUnique("filter", "FORWARD", "--in-interface", forwardDevice, "-j", "ACCEPT")
-				if err != nil {
-					return err
-				}
+				rules.Add(protocol, "filter", "FORWARD", "--in-interface", forwardDevice, "-j", "ACCEPT")
 				if !cfg.IsHA || cfg.IsHA && overlap {
-					log.Info("setting up double NAT IPv4 iptables rules (shoot)")
 					ipv4PodNetworkMappings, ipv4ServiceNetworkMappings, ipv4NodeNetworkMappings, err := network.ShootNetworksForNetmap(cfg.ShootPodNetworks, cfg.ShootServiceNetworks, cfg.ShootNodeNetworks)
 					if err != nil {
-						return err
+						return nil, err
 					}
 
-					for src, dst := range ipv4PodNetworkMappings {
-						err = ipTable.AppendUnique("nat", "PREROUTING", "--in-interface", forwardDevice, "-d", dst.String(), "-j", "NETMAP", "--to", src.String())
-						if err != nil {
-							return err
-						}
-						err = ipTable.AppendUnique("nat", "POSTROUTING", "--out-interface", forwardDevice, "-s", src.String(), "-j", "NETMAP", "--to", dst.String())
-						if err != nil {
-							return err
-						}
-					}
-					for src, dst := range ipv4ServiceNetworkMappings {
-						err = ipTable.AppendUnique("nat", "PREROUTING", "--in-interface", forwardDevice, "-d", dst.String(), "-j", "NETMAP", "--to", src.String())
-						if err != nil {
-							return err
-						}
-						err = ipTable.AppendUnique("nat", "POSTROUTING", "--out-interface", forwardDevice, "-s", src.String(), "-j", "NETMAP", "--to", dst.String())
-						if err != nil {
-							return err
-						}
-					}
-					for src, dst := range ipv4NodeNetworkMappings {
-						err = ipTable.AppendUnique("nat", "PREROUTING", "--in-interface", forwardDevice, "-d", dst.String(), "-j", "NETMAP", "--to", src.String())
-						if err != nil {
-							return err
-						}
-						err = ipTable.AppendUnique("nat", "POSTROUTING", "--out-interface", forwardDevice, "-s", src.String(), "-j", "NETMAP", "--to", dst.String())
-						if err != nil {
-							return err
+					for _, mappings := range []map[*network.CIDR]network.CIDR{ipv4PodNetworkMappings, ipv4ServiceNetworkMappings, ipv4NodeNetworkMappings} {
+						for _, src := range network.SortedNetmapSources(mappings) {
+							dst := mappings[src]
+							rules.Add(protocol, "nat", "PREROUTING", "--in-interface", forwardDevice, "-d", dst.String(), "-j", "NETMAP", "--to", src.String())
+							rules.Add(protocol, "nat", "POSTROUTING", "--out-interface", forwardDevice, "-s", src.String(), "-j", "NETMAP", "--to", dst.String())
 						}
 					}
 				}
 			}
 
-			err = ipTable.AppendUnique("mangle", "POSTROUTING", "-p", "tcp", "--tcp-flags", "SYN,RST", "SYN", "-j", "TCPMSS", "--clamp-mss-to-pmtu")
-			if err != nil {
-				return err
-			}
-
-			err = ipTable.AppendUnique("nat", "POSTROUTING", "--out-interface", "eth0", "-j", "MASQUERADE")
-			if err != nil {
-				return err
-			}
+			rules.Add(protocol, "mangle", "POSTROUTING", "-p", "tcp", "--tcp-flags", "SYN,RST", "SYN", "-j", "TCPMSS", "--clamp-mss-to-pmtu")
+			rules.Add(protocol, "nat", "POSTROUTING", "--out-interface", "eth0", "-j", "MASQUERADE")
 		} else {
 			if protocol == iptables.ProtocolIPv4 {
 				// Seed client only exists in HA VPN mode, so we don't need to check for IsHA
 				if overlap {
-					log.Info("setting up double NAT IPv4 iptables rules (seed)")
-					ipTable, err := network.NewIPTables(log, iptables.ProtocolIPv4)
-					if err != nil {
-						return err
-					}
-
 					ipv4PodNetworkMappings, ipv4ServiceNetworkMappings, ipv4NodeNetworkMappings, err := network.ShootNetworksForNetmap(cfg.ShootPodNetworks, cfg.ShootServiceNetworks, cfg.ShootNodeNetworks)
 					if err != nil {
-						return err
+						return nil, err
 					}
 
-					for src, dst := range ipv4PodNetworkMappings {
-						err = ipTable.AppendUnique("nat", "OUTPUT", "-m", "owner", "--gid-owner", strconv.Itoa(constants.EnvoyVPNGroupId), "-d", src.String(), "-j", "NETMAP", "--to", dst.String())
-						if err != nil {
-							return err
-						}
-					}
-					for src, dst := range ipv4ServiceNetworkMappings {
-						err = ipTable.AppendUnique("nat", "OUTPUT", "-m", "owner", "--gid-owner", strconv.Itoa(constants.EnvoyVPNGroupId), "-d", src.String(), "-j", "NETMAP", "--to", dst.String())
-						if err != nil {
-							return err
-						}
-					}
-					for src, dst := range ipv4NodeNetworkMappings {
-						err = ipTable.AppendUnique("nat", "OUTPUT", "-m", "owner", "--gid-owner", strconv.Itoa(constants.EnvoyVPNGroupId), "-d", src.String(), "-j", "NETMAP", "--to", dst.String())
-						if err != nil {
-							return err
+					for _, mappings := range []map[*network.CIDR]network.CIDR{ipv4PodNetworkMappings, ipv4ServiceNetworkMappings, ipv4NodeNetworkMappings} {
+						for _, src := range network.SortedNetmapSources(mappings) {
+							rules.Add(protocol, "nat", "OUTPUT", "-m", "owner", "--gid-owner", strconv.Itoa(constants.EnvoyVPNGroupId), "-d", src.String(), "-j", "NETMAP", "--to", mappings[src].String())
 						}
 					}
 
 					if cfg.SeedPodNetwork.IsIPv4() {
-						err = ipTable.AppendUnique("nat", "PREROUTING", "--in-interface", forwardDevice, "-d", constants.SeedPodNetworkMapped, "-j", "NETMAP", "--to", cfg.SeedPodNetwork.String())
-						if err != nil {
-							return err
-						}
-						err = ipTable.AppendUnique("nat", "POSTROUTING", "--out-interface", forwardDevice, "-s", cfg.SeedPodNetwork.String(), "-j", "NETMAP", "--to", constants.SeedPodNetworkMapped)
-						if err != nil {
-							return err
-						}
+						rules.Add(protocol, "nat", "PREROUTING", "--in-interface", forwardDevice, "-d", constants.SeedPodNetworkMapped, "-j", "NETMAP", "--to", cfg.SeedPodNetwork.String())
+						rules.Add(protocol, "nat", "POSTROUTING", "--out-interface", forwardDevice, "-s", cfg.SeedPodNetwork.String(), "-j", "NETMAP", "--to", constants.SeedPodNetworkMapped)
 					}
 				}
 			}
 			if protocol == iptables.ProtocolIPv6 {
 				// allow icmp6 for Neighbor Discovery Protocol
-				err = ipTable.AppendUnique("filter", "INPUT", "-i", forwardDevice, "-p", "icmpv6", "-j", "ACCEPT")
-				if err != nil {
-					return err
-				}
-			}
-			err = ipTable.AppendUnique("filter", "INPUT", "-m", "state", "--state", "RELATED,ESTABLISHED", "-i", forwardDevice, "-j", "ACCEPT")
-			if err != nil {
-				return err
-			}
-			err = ipTable.AppendUnique("filter", "INPUT", "-i", forwardDevice, "-j", "DROP")
-			if err != nil {
-				return err
+				rules.Add(protocol, "filter", "INPUT", "-i", forwardDevice, "-p", "icmpv6", "-j", "ACCEPT")
 			}
+			rules.Add(protocol, "filter", "INPUT", "-m", "state", "--state", "RELATED,ESTABLISHED", "-i", forwardDevice, "-j", "ACCEPT")
+			rules.Add(protocol, "filter", "INPUT", "-i", forwardDevice, "-j", "DROP")
 		}
 	}
-	return nil
+	return rules, nil
+}
+
+func protocolForFamily(family string) iptables.Protocol {
+	if family == constants.IPv6Family {
+		return iptables.ProtocolIPv6
+	}
+	return iptables.ProtocolIPv4
 }
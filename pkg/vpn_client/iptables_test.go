@@ -0,0 +1,84 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package vpn_client
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/gardener/vpn2/pkg/config"
+	"github.com/gardener/vpn2/pkg/constants"
+	"github.com/gardener/vpn2/pkg/network"
+	"github.com/gardener/vpn2/pkg/utils"
+)
+
+var _ = Describe("IPTableRules", func() {
+	var cfg config.VPNClient
+
+	BeforeEach(func() {
+		cfg = config.VPNClient{
+			IPFamilies:           []string{constants.IPv4Family},
+			IsShootClient:        true,
+			VPNNetwork:           network.CIDR(constants.DefaultVPNNetwork),
+			SeedPodNetwork:       network.ParseIPNetIgnoreError("100.64.0.0/12"),
+			ShootPodNetworks:     []network.CIDR{network.ParseIPNetIgnoreError("100.96.0.0/11")},
+			ShootServiceNetworks: []network.CIDR{network.ParseIPNetIgnoreError("100.64.0.0/13")},
+			ShootNodeNetworks:    []network.CIDR{network.ParseIPNetIgnoreError("10.250.0.0/16")},
+			HAVPNServers:         2,
+			HAVPNClients:         2,
+			BondingMode:          constants.BondingModeActiveBackup,
+		}
+	})
+
+	It("should render the double NAT rules of a shoot client in a stable order", func() {
+		rules, err := IPTableRules(cfg)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(utils.Strings(rules.Rules())).To(Equal([]string{
+			"iptables -t filter -A FORWARD --in-interface tun0 -j ACCEPT",
+			"iptables -t nat -A PREROUTING --in-interface tun0 -d 244.0.0.0/11 -j NETMAP --to 100.96.0.0/11",
+			"iptables -t nat -A POSTROUTING --out-interface tun0 -s 100.96.0.0/11 -j NETMAP --to 244.0.0.0/11",
+			"iptables -t nat -A PREROUTING --in-interface tun0 -d 243.0.0.0/13 -j NETMAP --to 100.64.0.0/13",
+			"iptables -t nat -A POSTROUTING --out-interface tun0 -s 100.64.0.0/13 -j NETMAP --to 243.0.0.0/13",
+			"iptables -t nat -A PREROUTING --in-interface tun0 -d 242.0.0.0/16 -j NETMAP --to 10.250.0.0/16",
+			"iptables -t nat -A POSTROUTING --out-interface tun0 -s 10.250.0.0/16 -j NETMAP --to 242.0.0.0/16",
+			"iptables -t mangle -A POSTROUTING -p tcp --tcp-flags SYN,RST SYN -j TCPMSS --clamp-mss-to-pmtu",
+			"iptables -t nat -A POSTROUTING --out-interface eth0 -j MASQUERADE",
+		}))
+	})
+
+	It("should render the input rules of a seed client without overlap", func() {
+		cfg.IsShootClient = false
+		cfg.IsHA = true
+		cfg.VPNServerIndex = "0"
+		cfg.IPFamilies = []string{constants.IPv6Family}
+		cfg.SeedPodNetwork = network.ParseIPNetIgnoreError("10.0.0.0/16")
+		rules, err := IPTableRules(cfg)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(utils.Strings(rules.Rules())).To(Equal([]string{
+			"ip6tables -t filter -A INPUT -i bond0+ -p icmpv6 -j ACCEPT",
+			"ip6tables -t filter -A INPUT -m state --state RELATED,ESTABLISHED -i bond0+ -j ACCEPT",
+			"ip6tables -t filter -A INPUT -i bond0+ -j DROP",
+		}))
+	})
+
+	It("should render the double NAT rules of a seed client with overlapping networks", func() {
+		cfg.IsShootClient = false
+		cfg.IsHA = true
+		cfg.VPNServerIndex = "1"
+		cfg.ShootNodeNetworks = nil
+		cfg.ShootServiceNetworks = nil
+		cfg.SeedPodNetwork = network.ParseIPNetIgnoreError("100.96.0.0/12")
+		rules, err := IPTableRules(cfg)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(utils.Strings(rules.Rules())).To(Equal([]string{
+			"iptables -t nat -A OUTPUT -m owner --gid-owner 31415 -d 100.96.0.0/11 -j NETMAP --to 244.0.0.0/11",
+			"iptables -t nat -A PREROUTING --in-interface bond0+ -d 241.0.0.0/8 -j NETMAP --to 100.96.0.0/12",
+			"iptables -t nat -A POSTROUTING --out-interface bond0+ -s 100.96.0.0/12 -j NETMAP --to 241.0.0.0/8",
+			"iptables -t filter -A INPUT -m state --state RELATED,ESTABLISHED -i bond0+ -j ACCEPT",
+			"iptables -t filter -A INPUT -i bond0+ -j DROP",
+		}))
+		Expect(rules.Chain("OUTPUT")).To(Equal("VPN-CLIENT-OUTPUT"))
+	})
+})
@@ -0,0 +1,109 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package vpn_client
+
+import (
+	"fmt"
+
+	"github.com/go-logr/logr"
+
+	"github.com/gardener/vpn2/pkg/config"
+	"github.com/gardener/vpn2/pkg/constants"
+)
+
+// SysctlSetting is a kernel parameter set to a value.
+type SysctlSetting struct {
+	Name  string
+	Value string
+}
+
+// String returns the setting in sysctl.conf format.
+func (s SysctlSetting) String() string {
+	return s.Name + " = " + s.Value
+}
+
+// sysctlRecorder records the kernel parameters set instead of applying them.
+// Reading returns the recorded value or, if unset, assumes the most restrictive host, e.g. with IPv6 networking disabled.
+type sysctlRecorder struct {
+	settings []SysctlSetting
+}
+
+func (r *sysctlRecorder) Get(name string) (string, error) {
+	for _, s := range r.settings {
+		if s.Name == name {
+			return s.Value, nil
+		}
+	}
+	if name == "net.ipv6.conf.all.disable_ipv6" {
+		return "1", nil
+	}
+	return "0", nil
+}
+
+func (r *sysctlRecorder) Set(name, value string) error {
+	r.settings = append(r.settings, SysctlSetting{Name: name, Value: value})
+	return nil
+}
+
+// RenderKernelSettings returns the kernel parameters KernelSettings would set without changing the host.
+func RenderKernelSettings(log logr.Logger, cfg config.VPNClient) ([]SysctlSetting, error) {
+	recorder := &sysctlRecorder{}
+	if err := KernelSettings(log, cfg, recorder); err != nil {
+		return nil, err
+	}
+	return recorder.settings, nil
+}
+
+// RenderEnableIPv6Networking returns the kernel parameters EnableIPv6Networking would set on a host with IPv6 networking disabled.
+func RenderEnableIPv6Networking(log logr.Logger) ([]SysctlSetting, error) {
+	recorder := &sysctlRecorder{}
+	if err := EnableIPv6Networking(log, recorder); err != nil {
+		return nil, err
+	}
+	return recorder.settings, nil
+}
+
+// Links describes the links of the plan in `ip link` notation.
+func (p BondingPlan) Links() []string {
+	mtu := ""
+	if p.MTU > 0 {
+		mtu = fmt.Sprintf(" mtu %d", p.MTU)
+	}
+	var links []string
+	for _, tap := range p.TapDevices {
+		links = append(links, fmt.Sprintf("%s type tap%s master %s", tap, mtu, constants.BondDevice))
+	}
+	links = append(links, fmt.Sprintf("%s type bond mode %s%s address %s", constants.BondDevice, p.Mode, mtu, p.address()))
+	for _, tunnel := range p.Tunnels {
+		links = append(links, fmt.Sprintf("%s type ip6tnl local %s remote %s", tunnel.Name, p.ip(), tunnel.Remote))
+	}
+	return links
+}
+
+// Routes describes the routes implied by the plan in `ip route` notation.
+func (p BondingPlan) Routes() []string {
+	route := acquiredAddress
+	if r := p.Route(); r != nil {
+		route = r.String()
+	}
+	return []string{fmt.Sprintf("%s dev %s proto kernel scope link", route, constants.BondDevice)}
+}
+
+// acquiredAddress is rendered for the address of seed clients, which is acquired from the kube-apiserver at runtime.
+const acquiredAddress = "<acquired-from-kube-apiserver>"
+
+func (p BondingPlan) address() string {
+	if p.Address == nil {
+		return acquiredAddress
+	}
+	return p.Address.String()
+}
+
+func (p BondingPlan) ip() string {
+	if p.Address == nil {
+		return acquiredAddress
+	}
+	return p.Address.IP.String()
+}
@@ -0,0 +1,102 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package vpn_client
+
+import (
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/gardener/vpn2/pkg/config"
+	"github.com/gardener/vpn2/pkg/constants"
+	"github.com/gardener/vpn2/pkg/network"
+)
+
+var _ = Describe("Render", func() {
+	var (
+		log logr.Logger
+		cfg config.VPNClient
+	)
+
+	BeforeEach(func() {
+		log = logr.Discard()
+		cfg = config.VPNClient{
+			IPFamilies:           []string{constants.IPv4Family},
+			IsShootClient:        true,
+			VPNNetwork:           network.CIDR(constants.DefaultVPNNetwork),
+			SeedPodNetwork:       network.ParseIPNetIgnoreError("100.64.0.0/12"),
+			ShootPodNetworks:     []network.CIDR{network.ParseIPNetIgnoreError("100.96.0.0/11")},
+			ShootServiceNetworks: []network.CIDR{network.ParseIPNetIgnoreError("100.64.0.0/13")},
+			ShootNodeNetworks:    []network.CIDR{network.ParseIPNetIgnoreError("10.250.0.0/16")},
+			HAVPNServers:         2,
+			HAVPNClients:         2,
+			BondingMode:          constants.BondingModeActiveBackup,
+		}
+	})
+
+	Describe("#RenderKernelSettings", func() {
+		It("should render the settings of a shoot client", func() {
+			settings, err := RenderKernelSettings(log, cfg)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(settings).To(ContainElements(
+				SysctlSetting{Name: "net.ipv4.ip_forward", Value: "1"},
+				SysctlSetting{Name: "net.netfilter.nf_conntrack_tcp_timeout_established", Value: "600"},
+			))
+			Expect(settings).NotTo(ContainElement(HaveField("Name", "net.ipv6.conf.all.disable_ipv6")))
+		})
+
+		It("should render enabling IPv6 networking for a seed client", func() {
+			cfg.IsShootClient = false
+			settings, err := RenderKernelSettings(log, cfg)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(settings).To(ContainElement(SysctlSetting{Name: "net.ipv6.conf.all.disable_ipv6", Value: "0"}))
+			Expect(settings).NotTo(ContainElement(HaveField("Name", "net.ipv4.ip_forward")))
+			Expect(settings).NotTo(ContainElement(HaveField("Name", "net.ipv4.fib_multipath_hash_policy")))
+		})
+
+		It("should render L4 multipath hashing for a HA seed client with ECMP routing", func() {
+			cfg.IsShootClient = false
+			cfg.IsHA = true
+			cfg.ECMPRouting = true
+			settings, err := RenderKernelSettings(log, cfg)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(settings).To(ContainElements(
+				SysctlSetting{Name: "net.ipv4.fib_multipath_hash_policy", Value: "1"},
+				SysctlSetting{Name: "net.ipv6.fib_multipath_hash_policy", Value: "1"},
+			))
+		})
+	})
+
+	Describe("#PlanBonding", func() {
+		It("should plan the links of a shoot client", func() {
+			cfg.VPNClientIndex = 1
+			plan, err := PlanBonding(&cfg, 1400)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(plan.Links()).To(Equal([]string{
+				"tap0 type tap mtu 1400 master bond0",
+				"tap1 type tap mtu 1400 master bond0",
+				"bond0 type bond mode active-backup mtu 1400 address fd8f:6d53:b97a:1::b:1/104",
+			}))
+			Expect(plan.Routes()).To(Equal([]string{"fd8f:6d53:b97a:1::/104 dev bond0 proto kernel scope link"}))
+		})
+
+		It("should plan the tunnels of a seed client with unknown address", func() {
+			cfg.IsShootClient = false
+			plan, err := PlanBonding(&cfg, 0)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(plan.Address).To(BeNil())
+			Expect(plan.Links()).To(ContainElements(
+				"bond0-ip6tnl0 type ip6tnl local <acquired-from-kube-apiserver> remote fd8f:6d53:b97a:1::b:0",
+				"bond0-ip6tnl1 type ip6tnl local <acquired-from-kube-apiserver> remote fd8f:6d53:b97a:1::b:1",
+			))
+		})
+
+		It("should fail for unsupported bonding modes", func() {
+			cfg.BondingMode = "broadcast"
+			_, err := PlanBonding(&cfg, 0)
+			Expect(err).To(MatchError("unsupported bonding mode: broadcast"))
+		})
+	})
+})
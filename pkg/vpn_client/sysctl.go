@@ -9,14 +9,14 @@ import (
 	"strconv"
 
 	"github.com/go-logr/logr"
-	"github.com/lorenzosaino/go-sysctl"
 
 	"github.com/gardener/vpn2/pkg/config"
+	"github.com/gardener/vpn2/pkg/network"
 )
 
 // EnableIPv6Networking enables IPv6 networking on the system.
-func EnableIPv6Networking(log logr.Logger) error {
-	strVal, err := sysctl.Get("net.ipv6.conf.all.disable_ipv6")
+func EnableIPv6Networking(log logr.Logger, s network.Sysctl) error {
+	strVal, err := s.Get("net.ipv6.conf.all.disable_ipv6")
 	if err != nil {
 		return fmt.Errorf("failed to read net.ipv6.conf.all.disable_ipv6: %w", err)
 	}
@@ -27,7 +27,7 @@ func EnableIPv6Networking(log logr.Logger) error {
 	if value == 1 {
 		log.Info("IPv6 networking is disabled in the pod, trying to enable it")
 		// Enable IPv6 networking on the system (needed for GKE clusters)
-		if err := sysctl.Set("net.ipv6.conf.all.disable_ipv6", "0"); err != nil {
+		if err := s.Set("net.ipv6.conf.all.disable_ipv6", "0"); err != nil {
 			return fmt.Errorf("failed to enable IPv6 networking: %w (hint: container may need to be privileged)", err)
 		}
 		log.Info("IPv6 networking enabled")
@@ -36,84 +36,100 @@ func EnableIPv6Networking(log logr.Logger) error {
 }
 
 // DisableMartianLogging disables logging of packets with un-routable source addresses (martians) globally and for new interfaces.
-func DisableMartianLogging() error {
+func DisableMartianLogging(s network.Sysctl) error {
 	// Disable logging of packets with un-routable source addresses (martians) globally.
-	if err := sysctl.Set("net.ipv4.conf.all.log_martians", "0"); err != nil {
+	if err := s.Set("net.ipv4.conf.all.log_martians", "0"); err != nil {
 		return err
 	}
 	// Disable logging of packets with un-routable source addresses (martians) for new interfaces.
-	if err := sysctl.Set("net.ipv4.conf.default.log_martians", "0"); err != nil {
+	if err := s.Set("net.ipv4.conf.default.log_martians", "0"); err != nil {
 		return err
 	}
 	return nil
 }
 
 // DisableRpFilter disables reverse path filtering globally and for new interfaces.
-func DisableRpFilter() error {
+func DisableRpFilter(s network.Sysctl) error {
 	// Disable reverse path filtering globally.
-	if err := sysctl.Set("net.ipv4.conf.all.rp_filter", "0"); err != nil {
+	if err := s.Set("net.ipv4.conf.all.rp_filter", "0"); err != nil {
 		return err
 	}
 	// Disable reverse path filtering for new interfaces.
-	if err := sysctl.Set("net.ipv4.conf.default.rp_filter", "0"); err != nil {
+	if err := s.Set("net.ipv4.conf.default.rp_filter", "0"); err != nil {
 		return err
 	}
 	return nil
 }
 
 // EnableIPForwarding enables IP forwarding for both IPv4 and IPv6 on the system.
-func EnableIPForwarding() error {
+func EnableIPForwarding(s network.Sysctl) error {
 	// Enable IPv4 forwarding on the system.
-	if err := sysctl.Set("net.ipv4.ip_forward", "1"); err != nil {
+	if err := s.Set("net.ipv4.ip_forward", "1"); err != nil {
 		return err
 	}
 	// Enable IPv6 forwarding on the system.
-	if err := sysctl.Set("net.ipv6.conf.all.forwarding", "1"); err != nil {
+	if err := s.Set("net.ipv6.conf.all.forwarding", "1"); err != nil {
 		return err
 	}
 	return nil
 }
 
+// MultipathHashPolicies are the kernel parameters set to MultipathHashPolicyL4 by MultipathHashSettings.
+var MultipathHashPolicies = []string{"net.ipv4.fib_multipath_hash_policy", "net.ipv6.fib_multipath_hash_policy"}
+
+// MultipathHashPolicyL4 is the multipath hash policy hashing by the L4 five-tuple.
+const MultipathHashPolicyL4 = "1"
+
+// MultipathHashSettings hashes multipath routes by the L4 five-tuple, so that a flow sticks to one nexthop.
+func MultipathHashSettings(s network.Sysctl) error {
+	for _, name := range MultipathHashPolicies {
+		if err := s.Set(name, MultipathHashPolicyL4); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // ConntrackSettings adjusts vpn-shoot for optimized performance with high connection churn and NAT.
-func ConntrackSettings() error {
+func ConntrackSettings(s network.Sysctl) error {
 	// Increase local port range
-	if err := sysctl.Set("net.ipv4.ip_local_port_range", "1024 65535"); err != nil {
+	if err := s.Set("net.ipv4.ip_local_port_range", "1024 65535"); err != nil {
 		return err
 	}
 	// Reuse time_wait connections
-	if err := sysctl.Set("net.ipv4.tcp_tw_reuse", "1"); err != nil {
+	if err := s.Set("net.ipv4.tcp_tw_reuse", "1"); err != nil {
 		return err
 	}
 	// Reduce tcp fin timeout (from 60s)
-	if err := sysctl.Set("net.ipv4.tcp_fin_timeout", "30"); err != nil {
+	if err := s.Set("net.ipv4.tcp_fin_timeout", "30"); err != nil {
 		return err
 	}
 	// Reduce tcp_timeout_established to 10m (from 5 days)
-	if err := sysctl.Set("net.netfilter.nf_conntrack_tcp_timeout_established", "600"); err != nil {
+	if err := s.Set("net.netfilter.nf_conntrack_tcp_timeout_established", "600"); err != nil {
 		return err
 	}
 	// Reduce syn timeouts (from 120s)
-	if err := sysctl.Set("net.netfilter.nf_conntrack_tcp_timeout_syn_sent", "30"); err != nil {
+	if err := s.Set("net.netfilter.nf_conntrack_tcp_timeout_syn_sent", "30"); err != nil {
 		return err
 	}
-	if err := sysctl.Set("net.netfilter.nf_conntrack_tcp_timeout_syn_recv", "30"); err != nil {
+	if err := s.Set("net.netfilter.nf_conntrack_tcp_timeout_syn_recv", "30"); err != nil {
 		return err
 	}
 	// Reduce time_wait etc. cleanup time (from 120s/60s)
-	if err := sysctl.Set("net.netfilter.nf_conntrack_tcp_timeout_fin_wait", "30"); err != nil {
+	if err := s.Set("net.netfilter.nf_conntrack_tcp_timeout_fin_wait", "30"); err != nil {
 		return err
 	}
-	if err := sysctl.Set("net.netfilter.nf_conntrack_tcp_timeout_time_wait", "30"); err != nil {
+	if err := s.Set("net.netfilter.nf_conntrack_tcp_timeout_time_wait", "30"); err != nil {
 		return err
 	}
-	if err := sysctl.Set("net.netfilter.nf_conntrack_tcp_timeout_close_wait", "30"); err != nil {
+	if err := s.Set("net.netfilter.nf_conntrack_tcp_timeout_close_wait", "30"); err != nil {
 		return err
 	}
 	// Reduce retransmission timeouts (from 300s)
-	if err := sysctl.Set("net.netfilter.nf_conntrack_tcp_timeout_unacknowledged", "60"); err != nil {
+	if err := s.Set("net.netfilter.nf_conntrack_tcp_timeout_unacknowledged", "60"); err != nil {
 		return err
 	}
-	if err := sysctl.Set("net.netfilter.nf_conntrack_tcp_timeout_max_retrans", "120"); err != nil {
+	if err := s.Set("net.netfilter.nf_conntrack_tcp_timeout_max_retrans", "120"); err != nil {
 		return err
 	}
 
@@ -123,14 +139,14 @@ func ConntrackSettings() error {
 // BufferSettings adjusts socket buffer sizes to suit OpenVPN better.
 // Note: all buffer sizes must be within net.core.wmem_max / net.core.rmem_max as defined in
 // https://github.com/gardener/gardener/blob/master/pkg/component/extensions/operatingsystemconfig/original/components/kernelconfig/component.go#L100-L103
-func BufferSettings() error {
+func BufferSettings(s network.Sysctl) error {
 	// Increase minimum send buffer to 64k (from 4k)
-	if err := sysctl.Set("net.ipv4.tcp_wmem", "65536\t12582912\t16777216"); err != nil {
+	if err := s.Set("net.ipv4.tcp_wmem", "65536\t12582912\t16777216"); err != nil {
 		return err
 	}
 
 	// Increase minimum receive buffer to 64k (from 4k)
-	if err := sysctl.Set("net.ipv4.tcp_rmem", "65536\t12582912\t16777216"); err != nil {
+	if err := s.Set("net.ipv4.tcp_rmem", "65536\t12582912\t16777216"); err != nil {
 		return err
 	}
 
@@ -138,29 +154,36 @@ func BufferSettings() error {
 }
 
 // KernelSettings sets the kernel parameters required for the VPN tunnel to function properly.
-func KernelSettings(log logr.Logger, cfg config.VPNClient) error {
+func KernelSettings(log logr.Logger, cfg config.VPNClient, s network.Sysctl) error {
 	// Disable martian logging on both sides.
-	if err := DisableMartianLogging(); err != nil {
+	if err := DisableMartianLogging(s); err != nil {
 		return err
 	}
 	// Disable reverse path filtering on both sides.
-	if err := DisableRpFilter(); err != nil {
+	if err := DisableRpFilter(s); err != nil {
 		return err
 	}
 	// Adjust buffer sizes on both sides
-	if err := BufferSettings(); err != nil {
+	if err := BufferSettings(s); err != nil {
 		return err
 	}
 	// For seed clients, we need to enable IPv6 networking to be able to use IPv6 addresses for the tunnel.
 	if !cfg.IsShootClient {
-		return EnableIPv6Networking(log)
+		if err := EnableIPv6Networking(log, s); err != nil {
+			return err
+		}
+		// The path-controller spreads the flows over all shoot clients with ECMP routes.
+		if cfg.IsHA && cfg.ECMPRouting {
+			return MultipathHashSettings(s)
+		}
+		return nil
 	}
 
 	// Configure conntrack for nat on the shoot clients
-	if err := ConntrackSettings(); err != nil {
+	if err := ConntrackSettings(s); err != nil {
 		return err
 	}
 
 	// For shoot clients, we need to enable IP forwarding to be able to route traffic from the tunnel to the shoot cluster and back.
-	return EnableIPForwarding()
+	return EnableIPForwarding(s)
 }
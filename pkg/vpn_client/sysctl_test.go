@@ -7,6 +7,7 @@ import (
 	. "github.com/onsi/gomega"
 
 	"github.com/gardener/vpn2/pkg/config"
+	"github.com/gardener/vpn2/pkg/network"
 )
 
 var _ = Describe("EnableIPv6Networking", func() {
@@ -25,7 +26,7 @@ var _ = Describe("EnableIPv6Networking", func() {
 			Expect(err).NotTo(HaveOccurred())
 
 			// Enable IPv6
-			err = EnableIPv6Networking(log)
+			err = EnableIPv6Networking(log, network.HostSysctl(""))
 			Expect(err).NotTo(HaveOccurred())
 
 			// Verify IPv6 is enabled
@@ -43,7 +44,7 @@ var _ = Describe("EnableIPv6Networking", func() {
 		})
 
 		It("should not error and leave IPv6 enabled", func() {
-			err := EnableIPv6Networking(log)
+			err := EnableIPv6Networking(log, network.HostSysctl(""))
 			Expect(err).NotTo(HaveOccurred())
 
 			value, err := sysctl.Get("net.ipv6.conf.all.disable_ipv6")
@@ -56,7 +57,7 @@ var _ = Describe("EnableIPv6Networking", func() {
 		It("should return error for invalid sysctl key", func() {
 			// This test verifies error handling when sysctl key doesn't exist
 			// Note: This may not fail in all environments, so adjust as needed
-			err := EnableIPv6Networking(log)
+			err := EnableIPv6Networking(log, network.HostSysctl(""))
 			// Either succeeds or fails gracefully
 			Expect(err == nil || err != nil).To(BeTrue())
 		})
@@ -96,7 +97,7 @@ var _ = Describe("KernelSettings", func() {
 		})
 
 		It("should enable IPv6 networking", func() {
-			err := KernelSettings(log, cfg)
+			err := KernelSettings(log, cfg, network.HostSysctl(""))
 			Expect(err).NotTo(HaveOccurred())
 
 			value, err := sysctl.Get("net.ipv6.conf.all.disable_ipv6")
@@ -105,7 +106,7 @@ var _ = Describe("KernelSettings", func() {
 		})
 
 		It("should disable logging of martian packets", func() {
-			err := KernelSettings(log, cfg)
+			err := KernelSettings(log, cfg, network.HostSysctl(""))
 			Expect(err).NotTo(HaveOccurred())
 
 			value, err := sysctl.Get("net.ipv4.conf.all.log_martians")
@@ -118,7 +119,7 @@ var _ = Describe("KernelSettings", func() {
 		})
 
 		It("should adjust buffer sizes", func() {
-			err := KernelSettings(log, cfg)
+			err := KernelSettings(log, cfg, network.HostSysctl(""))
 			Expect(err).NotTo(HaveOccurred())
 
 			value, err := sysctl.Get("net.ipv4.tcp_rmem")
@@ -149,7 +150,7 @@ var _ = Describe("KernelSettings", func() {
 		})
 
 		It("should enable IPv4 and IPv6 forwarding", func() {
-			err := KernelSettings(log, cfg)
+			err := KernelSettings(log, cfg, network.HostSysctl(""))
 			Expect(err).NotTo(HaveOccurred())
 
 			// Verify IPv4 forwarding is enabled
@@ -168,7 +169,7 @@ var _ = Describe("KernelSettings", func() {
 			err := sysctl.Set("net.ipv6.conf.all.disable_ipv6", "1")
 			Expect(err).NotTo(HaveOccurred())
 
-			err = KernelSettings(log, cfg)
+			err = KernelSettings(log, cfg, network.HostSysctl(""))
 			Expect(err).NotTo(HaveOccurred())
 
 			// For shoot clients, IPv6 disable should not be modified by KernelSettings
@@ -179,7 +180,7 @@ var _ = Describe("KernelSettings", func() {
 		})
 
 		It("should disable logging of martian packets", func() {
-			err := KernelSettings(log, cfg)
+			err := KernelSettings(log, cfg, network.HostSysctl(""))
 			Expect(err).NotTo(HaveOccurred())
 
 			value, err := sysctl.Get("net.ipv4.conf.all.log_martians")
@@ -192,7 +193,7 @@ var _ = Describe("KernelSettings", func() {
 		})
 
 		It("should disable reverse path filtering", func() {
-			err := KernelSettings(log, cfg)
+			err := KernelSettings(log, cfg, network.HostSysctl(""))
 			Expect(err).NotTo(HaveOccurred())
 
 			value, err := sysctl.Get("net.ipv4.conf.all.rp_filter")
@@ -205,7 +206,7 @@ var _ = Describe("KernelSettings", func() {
 		})
 
 		It("should apply conntrack optimizations", func() {
-			err := KernelSettings(log, cfg)
+			err := KernelSettings(log, cfg, network.HostSysctl(""))
 			Expect(err).NotTo(HaveOccurred())
 
 			value, err := sysctl.Get("net.ipv4.ip_local_port_range")
@@ -254,7 +255,7 @@ var _ = Describe("KernelSettings", func() {
 		})
 
 		It("should adjust buffer sizes", func() {
-			err := KernelSettings(log, cfg)
+			err := KernelSettings(log, cfg, network.HostSysctl(""))
 			Expect(err).NotTo(HaveOccurred())
 
 			value, err := sysctl.Get("net.ipv4.tcp_rmem")
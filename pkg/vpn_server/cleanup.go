@@ -0,0 +1,43 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package vpn_server
+
+import (
+	"errors"
+
+	"github.com/go-logr/logr"
+
+	"github.com/gardener/vpn2/pkg/config"
+	"github.com/gardener/vpn2/pkg/network"
+)
+
+// RevertHostSetup undoes the changes the setup subcommand, the vpn-server and its firewall subcommand made on the
+// host: the firewall rules of both firewall backends, the tunnel device (and with it the routes to the shoot networks)
+// and, if a state file is given, the kernel parameters recorded by network.HostSysctl.
+// It is idempotent. All steps are attempted even if some of them fail.
+func RevertHostSetup(log logr.Logger, cfg config.VPNServer, device, sysctlStateFile string) error {
+	log.Info("Reverting VPN server host setup")
+	var errs []error
+
+	for _, owner := range []string{IPTablesOwner, FirewallIPTablesOwner} {
+		if err := network.RemoveFirewall(log, owner, cfg.FirewallBackend); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	log.Info("deleting link", "link", device)
+	if err := network.DeleteLinkByName(device); err != nil {
+		errs = append(errs, err)
+	}
+
+	if sysctlStateFile != "" {
+		if err := network.RestoreSysctls(log, sysctlStateFile, network.HostSysctl("")); err != nil {
+			errs = append(errs, err)
+		}
+	} else {
+		log.Info("not restoring kernel parameters without sysctl state file")
+	}
+	return errors.Join(errs...)
+}
@@ -11,37 +11,37 @@ import (
 	"github.com/gardener/vpn2/pkg/network"
 )
 
+const (
+	// IPTablesOwner is the prefix of the iptables chains holding the rules of the vpn-server.
+	IPTablesOwner = "VPN-SERVER"
+	// FirewallIPTablesOwner is the prefix of the iptables chains holding the rules of the firewall subcommand.
+	FirewallIPTablesOwner = "VPN-FIREWALL"
+)
+
+// SetIPTableRules reconciles the rules required by the vpn-server on the host with the configured firewall backend.
+// Rules no longer required, e.g. after a change of the shoot networks, are removed.
 func SetIPTableRules(log logr.Logger, cfg config.VPNServer) error {
-	if !cfg.IsHA {
-		log.Info("setting up double NAT IPv4 iptables rules (seed-server)")
-		ipTable, err := network.NewIPTables(log, iptables.ProtocolIPv4)
-		if err != nil {
-			return err
-		}
+	ruleSet, err := IPTableRules(cfg)
+	if err != nil {
+		return err
+	}
+	return network.ReconcileFirewall(log, ruleSet, cfg.FirewallBackend)
+}
 
+// IPTableRules generates the iptables rules required by the vpn-server for the given configuration.
+func IPTableRules(cfg config.VPNServer) (*network.RuleSet, error) {
+	rules := network.NewRuleSet(IPTablesOwner)
+	if !cfg.IsHA {
 		ipv4PodNetworkMappings, ipv4ServiceNetworkMappings, ipv4NodeNetworkMappings, err := network.ShootNetworksForNetmap(cfg.ShootPodNetworks, cfg.ShootServiceNetworks, cfg.ShootNodeNetworks)
 		if err != nil {
-			return err
+			return nil, err
 		}
 
-		for src, dst := range ipv4PodNetworkMappings {
-			err = ipTable.AppendUnique("nat", "OUTPUT", "-m", "owner", "--gid-owner", strconv.Itoa(constants.EnvoyVPNGroupId), "-d", src.String(), "-j", "NETMAP", "--to", dst.String())
-			if err != nil {
-				return err
-			}
-		}
-		for src, dst := range ipv4ServiceNetworkMappings {
-			err = ipTable.AppendUnique("nat", "OUTPUT", "-m", "owner", "--gid-owner", strconv.Itoa(constants.EnvoyVPNGroupId), "-d", src.String(), "-j", "NETMAP", "--to", dst.String())
-			if err != nil {
-				return err
-			}
-		}
-		for src, dst := range ipv4NodeNetworkMappings {
-			err = ipTable.AppendUnique("nat", "OUTPUT", "-m", "owner", "--gid-owner", strconv.Itoa(constants.EnvoyVPNGroupId), "-d", src.String(), "-j", "NETMAP", "--to", dst.String())
-			if err != nil {
-				return err
+		for _, mappings := range []map[*network.CIDR]network.CIDR{ipv4PodNetworkMappings, ipv4ServiceNetworkMappings, ipv4NodeNetworkMappings} {
+			for _, src := range network.SortedNetmapSources(mappings) {
+				rules.Add(iptables.ProtocolIPv4, "nat", "OUTPUT", "-m", "owner", "--gid-owner", strconv.Itoa(constants.EnvoyVPNGroupId), "-d", src.String(), "-j", "NETMAP", "--to", mappings[src].String())
 			}
 		}
 	}
-	return nil
+	return rules, nil
 }
@@ -0,0 +1,45 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package vpn_server_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/gardener/vpn2/pkg/config"
+	"github.com/gardener/vpn2/pkg/network"
+	"github.com/gardener/vpn2/pkg/utils"
+	"github.com/gardener/vpn2/pkg/vpn_server"
+)
+
+var _ = Describe("IPTableRules", func() {
+	var cfg config.VPNServer
+
+	BeforeEach(func() {
+		cfg = config.VPNServer{
+			ShootPodNetworks:     []network.CIDR{network.ParseIPNetIgnoreError("100.96.0.0/11"), network.ParseIPNetIgnoreError("2001:db8:1::/48")},
+			ShootServiceNetworks: []network.CIDR{network.ParseIPNetIgnoreError("100.64.0.0/13")},
+			ShootNodeNetworks:    []network.CIDR{network.ParseIPNetIgnoreError("10.250.0.0/16")},
+		}
+	})
+
+	It("should map the IPv4 shoot networks in non-HA mode", func() {
+		rules, err := vpn_server.IPTableRules(cfg)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(utils.Strings(rules.Rules())).To(Equal([]string{
+			"iptables -t nat -A OUTPUT -m owner --gid-owner 31415 -d 100.96.0.0/11 -j NETMAP --to 244.0.0.0/11",
+			"iptables -t nat -A OUTPUT -m owner --gid-owner 31415 -d 100.64.0.0/13 -j NETMAP --to 243.0.0.0/13",
+			"iptables -t nat -A OUTPUT -m owner --gid-owner 31415 -d 10.250.0.0/16 -j NETMAP --to 242.0.0.0/16",
+		}))
+	})
+
+	It("should not generate rules in HA mode", func() {
+		cfg.IsHA = true
+		rules, err := vpn_server.IPTableRules(cfg)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rules.Rules()).To(BeEmpty())
+		Expect(rules.Commands()).To(BeEmpty())
+	})
+})
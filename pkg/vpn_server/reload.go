@@ -0,0 +1,200 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package vpn_server
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/vishvananda/netlink"
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	"github.com/gardener/vpn2/pkg/config"
+	"github.com/gardener/vpn2/pkg/network"
+	"github.com/gardener/vpn2/pkg/openvpn"
+	"github.com/gardener/vpn2/pkg/openvpn/management"
+)
+
+// DefaultDisconnectBackoff is the backoff for disconnecting clients with the OpenVPN management interface. OpenVPN
+// accepts only one connection to it at a time, which is also used by the health checks.
+var DefaultDisconnectBackoff = wait.Backoff{
+	Duration: 500 * time.Millisecond,
+	Factor:   2,
+	Jitter:   0.1,
+	Steps:    5,
+}
+
+// ReloadPlan describes how to bring a running OpenVPN server from the values it has been configured with to new
+// values without restarting it.
+type ReloadPlan struct {
+	// AddedRoutes are the shoot networks to route to the tunnel device.
+	AddedRoutes []network.CIDR
+	// RemovedRoutes are the shoot networks no longer routed to the tunnel device.
+	RemovedRoutes []network.CIDR
+	// Reconnect are the common names of the clients whose client-config-dir file changed.
+	// They need to reconnect to pick up their new iroutes.
+	Reconnect []string
+	// RestartRequired are the changed settings or files which only take effect after restarting OpenVPN.
+	RestartRequired []string
+}
+
+// PlanReload computes the changes needed to apply the desired values to an OpenVPN server running with the current
+// values.
+func PlanReload(current, desired openvpn.SeedServerValues) (ReloadPlan, error) {
+	plan := ReloadPlan{}
+
+	currentFiles, err := openvpn.ServerConfigFiles(current)
+	if err != nil {
+		return plan, err
+	}
+	desiredFiles, err := openvpn.ServerConfigFiles(desired)
+	if err != nil {
+		return plan, err
+	}
+	for _, name := range slices.Sorted(maps.Keys(desiredFiles)) {
+		if commonName, ok := openvpn.ClientCommonName(name); ok && currentFiles[name] != desiredFiles[name] {
+			plan.Reconnect = append(plan.Reconnect, commonName)
+		}
+	}
+
+	plan.AddedRoutes = missingNetworks(desired.ShootNetworks, current.ShootNetworks)
+	plan.RemovedRoutes = missingNetworks(current.ShootNetworks, desired.ShootNetworks)
+
+	for name, changed := range map[string]bool{
+		"device":             current.Device != desired.Device,
+		"openVPNNetwork":     current.OpenVPNNetwork.String() != desired.OpenVPNNetwork.String(),
+		"isHA":               current.IsHA != desired.IsHA,
+		"vpnIndex":           current.VPNIndex != desired.VPNIndex,
+		"haVPNClients":       current.HAVPNClients != desired.HAVPNClients,
+		"localNodeIP":        current.LocalNodeIP != desired.LocalNodeIP,
+		"statusPath":         current.StatusPath != desired.StatusPath,
+		"tunMTU":             current.TunMTU != desired.TunMTU,
+		"maxRoutesPerClient": current.MaxRoutesPerClient != desired.MaxRoutesPerClient,
+		"firewallBackend":    current.FirewallBackend != desired.FirewallBackend,
+		"managementPort":     current.ManagementPort != desired.ManagementPort,
+	} {
+		if changed {
+			plan.RestartRequired = append(plan.RestartRequired, name)
+		}
+	}
+	slices.Sort(plan.RestartRequired)
+	return plan, nil
+}
+
+// PlanStartup computes the changes needed to apply the desired values to the host as it is found, as the configuration
+// may have changed since OpenVPN has been started. applied are the files generated by openvpn.ServerConfigFiles as read
+// from disk and routed are the networks routed to the tunnel device. Routes within the VPN network are left to OpenVPN.
+func PlanStartup(desired openvpn.SeedServerValues, applied map[string]string, routed []network.CIDR) (ReloadPlan, error) {
+	plan := ReloadPlan{}
+
+	desiredFiles, err := openvpn.ServerConfigFiles(desired)
+	if err != nil {
+		return plan, err
+	}
+	for _, name := range slices.Sorted(maps.Keys(desiredFiles)) {
+		if applied[name] == desiredFiles[name] {
+			continue
+		}
+		if commonName, ok := openvpn.ClientCommonName(name); ok {
+			plan.Reconnect = append(plan.Reconnect, commonName)
+		} else {
+			plan.RestartRequired = append(plan.RestartRequired, name)
+		}
+	}
+
+	routed = slices.DeleteFunc(slices.Clone(routed), func(nw network.CIDR) bool {
+		return desired.OpenVPNNetwork.ToIPNet().Contains(nw.IP)
+	})
+	plan.AddedRoutes = missingNetworks(desired.ShootNetworks, routed)
+	plan.RemovedRoutes = missingNetworks(routed, desired.ShootNetworks)
+	return plan, nil
+}
+
+// missingNetworks returns the networks of a which are not part of b.
+func missingNetworks(a, b []network.CIDR) []network.CIDR {
+	var missing []network.CIDR
+	for _, nw := range a {
+		if !slices.ContainsFunc(b, nw.Equal) {
+			missing = append(missing, nw)
+		}
+	}
+	return missing
+}
+
+// ApplyReload applies the plan to the host: it writes the configuration files and reconciles the NETMAP rules and the
+// routes. The clients whose client-config-dir file changed must be disconnected with DisconnectClients afterwards.
+func ApplyReload(log logr.Logger, cfg config.VPNServer, desired openvpn.SeedServerValues, plan ReloadPlan) error {
+	// the client-config-dir files must be written before the clients reconnect
+	if err := openvpn.WriteServerConfigFiles(desired); err != nil {
+		return fmt.Errorf("failed to write configuration files: %w", err)
+	}
+	if err := SetIPTableRules(log, cfg); err != nil {
+		return err
+	}
+
+	if len(plan.AddedRoutes) > 0 || len(plan.RemovedRoutes) > 0 {
+		dev, err := netlink.LinkByName(desired.Device)
+		if err != nil {
+			return fmt.Errorf("failed to get link %s: %w", desired.Device, err)
+		}
+		for _, nw := range plan.AddedRoutes {
+			if err := network.ReplaceRoute(log, nw.ToIPNet(), dev); err != nil {
+				return err
+			}
+		}
+		for _, nw := range plan.RemovedRoutes {
+			if err := network.DeleteRoute(log, nw.ToIPNet(), dev); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// DisconnectClients disconnects the clients with the given common names using the OpenVPN management interface at
+// address, so that they reconnect with their new client-config-dir file. Clients which are not connected are skipped.
+// As the management interface may be in use by another client, the attempts are repeated with the backoff. If they
+// all fail, the common names of the clients which have not been disconnected are returned with the error.
+func DisconnectClients(log logr.Logger, address string, commonNames []string, backoff wait.Backoff) ([]string, error) {
+	pending := slices.Clone(commonNames)
+	var lastErr error
+	if err := wait.ExponentialBackoff(backoff, func() (bool, error) {
+		pending, lastErr = disconnectClients(log, address, pending)
+		if lastErr != nil {
+			log.Info("failed to disconnect clients, retrying", "pending", pending, "error", lastErr.Error())
+			return false, nil
+		}
+		return true, nil
+	}); err != nil {
+		return pending, fmt.Errorf("failed to disconnect clients %v: %w", pending, lastErr)
+	}
+	return nil, nil
+}
+
+// disconnectClients disconnects the clients in a single connection to the management interface and returns the
+// common names of the clients which have not been disconnected if it fails.
+func disconnectClients(log logr.Logger, address string, commonNames []string) ([]string, error) {
+	client, err := management.Dial(address, 0)
+	if err != nil {
+		return commonNames, err
+	}
+	defer client.Close()
+
+	for i, commonName := range commonNames {
+		var commandErr *management.CommandError
+		if err := client.Kill(commonName); errors.As(err, &commandErr) {
+			log.Info("client not disconnected", "commonName", commonName, "reason", commandErr.Message)
+			continue
+		} else if err != nil {
+			return commonNames[i:], fmt.Errorf("failed to disconnect %s: %w", commonName, err)
+		}
+		log.Info("client disconnected to reconnect with new configuration", "commonName", commonName)
+	}
+	return nil, nil
+}
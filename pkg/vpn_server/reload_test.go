@@ -0,0 +1,199 @@
+// SPDX-FileCopyrightText: 2024 SAP SE or an SAP affiliate company and Gardener contributors
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package vpn_server_test
+
+import (
+	"time"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	"github.com/gardener/vpn2/pkg/config"
+	"github.com/gardener/vpn2/pkg/constants"
+	"github.com/gardener/vpn2/pkg/network"
+	"github.com/gardener/vpn2/pkg/openvpn"
+	"github.com/gardener/vpn2/pkg/openvpn/management/fake"
+	"github.com/gardener/vpn2/pkg/vpn_server"
+)
+
+var _ = Describe("Reload", func() {
+	Describe("#PlanReload", func() {
+		var cfg config.VPNServer
+
+		values := func(cfg config.VPNServer) openvpn.SeedServerValues {
+			v, err := vpn_server.BuildValues(cfg)
+			Expect(err).NotTo(HaveOccurred())
+			return v
+		}
+
+		BeforeEach(func() {
+			cfg = config.VPNServer{
+				StatusPath:           "/srv/status/openvpn.status",
+				VPNNetwork:           network.ParseIPNetIgnoreError("2001:db8::/96"),
+				SeedPodNetwork:       network.ParseIPNetIgnoreError("10.0.0.0/8"),
+				ShootPodNetworks:     []network.CIDR{network.ParseIPNetIgnoreError("100.96.0.0/11")},
+				ShootServiceNetworks: []network.CIDR{network.ParseIPNetIgnoreError("100.64.0.0/13")},
+			}
+		})
+
+		It("should not change anything if the networks are unchanged", func() {
+			plan, err := vpn_server.PlanReload(values(cfg), values(cfg))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(plan).To(Equal(vpn_server.ReloadPlan{}))
+		})
+
+		It("should only update the NETMAP rules if a mapped IPv4 network changes", func() {
+			current := values(cfg)
+			cfg.ShootPodNetworks = []network.CIDR{network.ParseIPNetIgnoreError("100.112.0.0/12")}
+
+			plan, err := vpn_server.PlanReload(current, values(cfg))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(plan.Reconnect).To(BeEmpty())
+			Expect(plan.AddedRoutes).To(BeEmpty())
+			Expect(plan.RemovedRoutes).To(BeEmpty())
+		})
+
+		It("should route a new network and reconnect the shoot client", func() {
+			current := values(cfg)
+			cfg.ShootPodNetworks = append(cfg.ShootPodNetworks, network.ParseIPNetIgnoreError("2001:db8:1::/48"))
+			cfg.ShootNodeNetworks = []network.CIDR{network.ParseIPNetIgnoreError("10.250.0.0/16")}
+
+			plan, err := vpn_server.PlanReload(current, values(cfg))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(plan.Reconnect).To(Equal([]string{openvpn.ShootClientPrefix}))
+			Expect(plan.AddedRoutes).To(ConsistOf(
+				network.ParseIPNetIgnoreError("2001:db8:1::/48"),
+				network.ParseIPNetIgnoreError(constants.ShootNodeNetworkMapped),
+			))
+			Expect(plan.RemovedRoutes).To(BeEmpty())
+			Expect(plan.RestartRequired).To(BeEmpty())
+		})
+
+		It("should remove routes of networks no longer present", func() {
+			cfg.ShootNodeNetworks = []network.CIDR{network.ParseIPNetIgnoreError("10.250.0.0/16")}
+			current := values(cfg)
+			cfg.ShootNodeNetworks = nil
+
+			plan, err := vpn_server.PlanReload(current, values(cfg))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(plan.RemovedRoutes).To(ConsistOf(network.ParseIPNetIgnoreError(constants.ShootNodeNetworkMapped)))
+			Expect(plan.Reconnect).To(Equal([]string{openvpn.ShootClientPrefix}))
+		})
+
+		It("should report settings which require a restart", func() {
+			current := values(cfg)
+			desired := values(cfg)
+			desired.TunMTU = 1300
+
+			plan, err := vpn_server.PlanReload(current, desired)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(plan.RestartRequired).To(Equal([]string{"tunMTU"}))
+		})
+	})
+
+	Describe("#PlanStartup", func() {
+		var desired openvpn.SeedServerValues
+
+		BeforeEach(func() {
+			var err error
+			desired, err = vpn_server.BuildValues(config.VPNServer{
+				StatusPath:           "/srv/status/openvpn.status",
+				VPNNetwork:           network.ParseIPNetIgnoreError("2001:db8::/96"),
+				SeedPodNetwork:       network.ParseIPNetIgnoreError("10.0.0.0/8"),
+				ShootPodNetworks:     []network.CIDR{network.ParseIPNetIgnoreError("100.96.0.0/11")},
+				ShootServiceNetworks: []network.CIDR{network.ParseIPNetIgnoreError("100.64.0.0/13")},
+			})
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("should not change anything if the host is up to date", func() {
+			applied, err := openvpn.ServerConfigFiles(desired)
+			Expect(err).NotTo(HaveOccurred())
+
+			plan, err := vpn_server.PlanStartup(desired, applied, desired.ShootNetworks)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(plan).To(Equal(vpn_server.ReloadPlan{}))
+		})
+
+		It("should reconcile the routes and reconnect the clients with outdated files", func() {
+			applied, err := openvpn.ServerConfigFiles(desired)
+			Expect(err).NotTo(HaveOccurred())
+			applied["/client-config-dir/vpn-shoot-client"] = "iroute 10.250.0.0 255.255.0.0\n"
+			routed := []network.CIDR{
+				desired.ShootNetworks[0],
+				network.ParseIPNetIgnoreError(constants.ShootNodeNetworkMapped),
+				// routes within the VPN network are left to openvpn
+				network.ParseIPNetIgnoreError("2001:db8::/96"),
+			}
+
+			plan, err := vpn_server.PlanStartup(desired, applied, routed)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(plan.Reconnect).To(Equal([]string{openvpn.ShootClientPrefix}))
+			Expect(plan.AddedRoutes).To(Equal(desired.ShootNetworks[1:]))
+			Expect(plan.RemovedRoutes).To(ConsistOf(network.ParseIPNetIgnoreError(constants.ShootNodeNetworkMapped)))
+			Expect(plan.RestartRequired).To(BeEmpty())
+		})
+
+		It("should report a changed openvpn configuration file and missing client files", func() {
+			plan, err := vpn_server.PlanStartup(desired, map[string]string{}, desired.ShootNetworks)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(plan.Reconnect).To(Equal([]string{openvpn.ShootClientPrefix}))
+			Expect(plan.RestartRequired).To(Equal([]string{"/openvpn-server.config"}))
+		})
+	})
+
+	Describe("#DisconnectClients", func() {
+		var server *fake.Server
+
+		BeforeEach(func() {
+			var err error
+			server, err = fake.NewServer()
+			Expect(err).NotTo(HaveOccurred())
+			DeferCleanup(server.Close)
+			server.SetClients([]string{"vpn-shoot-client"}, nil)
+		})
+
+		backoff := wait.Backoff{Duration: 50 * time.Millisecond, Factor: 1, Steps: 5}
+
+		It("should kill the clients by common name and skip unknown clients", func() {
+			pending, err := vpn_server.DisconnectClients(logr.Discard(), server.Addr(), []string{"vpn-shoot-client", "vpn-shoot-client-0"}, backoff)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(pending).To(BeEmpty())
+			Expect(server.Commands()).To(Equal([]string{"kill vpn-shoot-client", "kill vpn-shoot-client-0"}))
+		})
+
+		It("should retry while the management interface is busy", func() {
+			Expect(server.SetBusy(true)).To(Succeed())
+			time.AfterFunc(120*time.Millisecond, func() {
+				defer GinkgoRecover()
+				Expect(server.SetBusy(false)).To(Succeed())
+			})
+
+			pending, err := vpn_server.DisconnectClients(logr.Discard(), server.Addr(), []string{"vpn-shoot-client"}, backoff)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(pending).To(BeEmpty())
+			Expect(server.Commands()).To(Equal([]string{"kill vpn-shoot-client"}))
+		})
+
+		It("should return the pending clients if the management interface stays busy", func() {
+			Expect(server.SetBusy(true)).To(Succeed())
+
+			pending, err := vpn_server.DisconnectClients(logr.Discard(), server.Addr(), []string{"vpn-shoot-client", "vpn-shoot-client-0"}, backoff)
+			Expect(err).To(MatchError(ContainSubstring("failed to disconnect clients [vpn-shoot-client vpn-shoot-client-0]")))
+			Expect(err).To(MatchError(ContainSubstring("connection refused")))
+			Expect(pending).To(Equal([]string{"vpn-shoot-client", "vpn-shoot-client-0"}))
+			Expect(server.Commands()).To(BeEmpty())
+		})
+
+		It("should fail if the management interface is not reachable", func() {
+			address := server.Addr()
+			Expect(server.Close()).To(Succeed())
+			_, err := vpn_server.DisconnectClients(logr.Discard(), address, []string{"vpn-shoot-client"}, backoff)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
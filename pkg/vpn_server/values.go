@@ -20,7 +20,9 @@ import (
 
 func BuildValues(cfg config.VPNServer) (openvpn.SeedServerValues, error) {
 	v := openvpn.SeedServerValues{
-		StatusPath: cfg.StatusPath,
+		StatusPath:      cfg.StatusPath,
+		FirewallBackend: cfg.FirewallBackend,
+		ManagementPort:  cfg.ManagementPort,
 	}
 
 	if cfg.VPNNetwork.IP == nil {